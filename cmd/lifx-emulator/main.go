@@ -0,0 +1,70 @@
+// Command lifx-emulator runs emulated LIFX devices for development.
+//
+// Point the bridge at it with LIFX_BROADCAST_ADDR, eg:
+//
+//	go run ./cmd/lifx-emulator -addr 127.0.0.1:56800 -lights 3 -switches 1 -tiles 1
+//	LIFX_BROADCAST_ADDR=127.0.0.1:56800 go run ./cmd/lifx-mqtt
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/emulator"
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"go.yhsif.com/lifxlan"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:56800", "address to answer discovery on")
+	lights := flag.Int("lights", 2, "number of color lights")
+	switches := flag.Int("switches", 1, "number of switches")
+	tiles := flag.Int("tiles", 0, "number of tile chains (5 tiles each)")
+	latency := flag.Duration("latency", 0, "delay before every reply")
+	loss := flag.Float64("loss", 0, "chance (0 to 1) of ignoring a packet")
+	flag.Parse()
+
+	logging.Init(nil, logging.DefaultFlags)
+
+	network, err := emulator.NewNetwork(*addr)
+	if err != nil {
+		logging.Error("Error starting network %s", err)
+		os.Exit(1)
+	}
+	defer network.Close()
+
+	add := func(label string, cfg emulator.Config) {
+		cfg.Label = label
+		cfg.Group = "Emulated"
+		cfg.Latency = *latency
+		cfg.PacketLoss = *loss
+		d, err := network.Add(cfg)
+		if err != nil {
+			logging.Error("Error starting %s %s", label, err)
+			os.Exit(1)
+		}
+		logging.With("target", d.Target(), "addr", d.Addr()).Info("Started %s", label)
+	}
+	for i := 1; i <= *lights; i++ {
+		add(fmt.Sprintf("Light %d", i), emulator.Config{
+			Version: emulator.ProductA19,
+			Color:   lifxlan.Color{Brightness: 0xffff, Kelvin: 3500},
+		})
+	}
+	for i := 1; i <= *switches; i++ {
+		add(fmt.Sprintf("Switch %d", i), emulator.Config{Version: emulator.ProductSwitch})
+	}
+	for i := 1; i <= *tiles; i++ {
+		add(fmt.Sprintf("Tiles %d", i), emulator.Config{Version: emulator.ProductTile, Tiles: 5})
+	}
+
+	logging.Info("Answering discovery on %s", network.Addr())
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	<-signalChan
+	logging.Info("Exit signal received")
+}
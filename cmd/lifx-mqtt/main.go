@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -15,6 +16,9 @@ import (
 	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
 	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
 	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"github.com/denwilliams/go-lifx-mqtt/internal/schedule"
+	"github.com/denwilliams/go-lifx-mqtt/internal/solar"
+	"github.com/denwilliams/go-lifx-mqtt/internal/tracing"
 	"github.com/denwilliams/go-lifx-mqtt/internal/web"
 	"github.com/joho/godotenv"
 )
@@ -27,6 +31,8 @@ func init() {
 	if err != nil {
 		logging.Warn("Unable to load .env")
 	}
+
+	logging.Configure(loggingConfig())
 }
 
 func main() {
@@ -41,19 +47,84 @@ func main() {
 	if err != nil {
 		logging.Error("Error parsing HTTP_PORT %s", err)
 	}
+	pollInterval := parseDuration("FAST_POLL_INTERVAL")
+
+	if tracing.Enabled() {
+		shutdown, err := tracing.Init(context.Background(), "lifx-mqtt")
+		if err != nil {
+			logging.Error("Error starting tracing %s", err)
+		} else {
+			logging.Info("Exporting traces over OTLP")
+			defer shutdown(context.Background())
+		}
+	}
 
 	mc := mqtt.NewMQTTClient(mu, baseTopic, subscribeTopic)
-	lc := lifx.NewClient(mqtt.NewMqttStatusEmitter(mc))
+	hub := web.NewHub()
+	lc := lifx.NewClient(lifx.NewMultiEmitter(mqtt.NewMqttStatusEmitter(mc), hub))
+	if addr := os.Getenv("LIFX_BROADCAST_ADDR"); addr != "" {
+		lc.SetBroadcastAddr(addr)
+	}
+	lc.SetTransitions(transitionConfig())
+	if path := os.Getenv("RELAYS_FILE"); path != "" {
+		names, err := lifx.LoadRelayNames(path)
+		if err != nil {
+			logging.Error("Error loading RELAYS_FILE %s", err)
+		} else {
+			lc.SetRelayNames(names)
+		}
+	}
+	if v := os.Getenv("EFFECT_FPS"); v != "" {
+		fps, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			logging.Error("Error parsing EFFECT_FPS %s", err)
+		} else {
+			lc.SetEffectFrameRate(fps)
+		}
+	}
+	coords := coordinates()
+	lc.SetCoordinates(coords)
+
+	scheduleCfg := schedule.Config{Path: os.Getenv("SCHEDULE_FILE"), Coordinates: coords}
+	scheduler, err := schedule.New(lc, scheduleCfg)
+	if err != nil {
+		// Carry on without saving, rather than overwrite the file
+		logging.Error("Error loading SCHEDULE_FILE %s", err)
+		scheduleCfg.Path = ""
+		scheduler, _ = schedule.New(lc, scheduleCfg)
+	}
+	scheduler.OnChange(func(entries []schedule.Entry) {
+		mc.PublishRetained("/status/schedule", entries)
+	})
+	mc.Handle("schedule", scheduler.HandleMessage)
+	mc.Handle("image", func(ctx context.Context, id string, payload []byte) error {
+		return lc.HandleCommand(ctx, id, &mqtt.Command{Image: &mqtt.Image{Data: payload}})
+	})
+	mc.Handle("text", func(ctx context.Context, id string, payload []byte) error {
+		return lc.HandleCommand(ctx, id, &mqtt.Command{Text: &mqtt.Text{Text: string(payload)}})
+	})
+
 	mc.Connect(lc)
 	defer mc.Disconnect()
+	mc.PublishRetained("/status/schedule", scheduler.Entries())
 
 	go loadDevices(lc)
 	go updateCache(lc)
+	go updateInfo(lc)
 	go discoverLoop(lc)
+	go runScheduler(scheduler)
+	go adjustAdaptive(lc)
+	if pollInterval > 0 {
+		go pollDevices(lc, pollInterval)
+		go listenForState(lc)
+	} else {
+		logging.Info("FAST_POLL_INTERVAL isn't set, so LIFX Switch relay toggle events won't be published")
+	}
 	// NOTE: can use AddDevice to avoid having to rediscover each startup
 	// err = lc.AddDevice("1.2.3.4:1234", "0:73:d5:01:23:45")
 	if serverPort > 0 {
-		go startServer(serverPort)
+		health := web.NewHealth(lc, mc, readinessConfig())
+		go startServer(serverPort, lc, hub, health, scheduler)
 	}
 
 	logging.Info("Ready")
@@ -145,9 +216,196 @@ func updateCache(lc *lifx.LIFXClient) {
 	}
 }
 
-func startServer(port int) {
+func updateInfo(lc *lifx.LIFXClient) {
+	// Set up a channel to receive OS signals so we can gracefully exit
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+
+	// Only devices without info, or with stale info, are queried on each tick
+	tick := time.Tick(1 * time.Minute)
+
+	for {
+		select {
+		case <-tick:
+			lc.RefreshInfo()
+		case <-signalChan:
+			// Stop the loop when an interrupt signal is received
+			logging.Info("Background device info updater interrupted, exiting")
+			return
+		}
+	}
+}
+
+func pollDevices(lc *lifx.LIFXClient, interval time.Duration) {
+	// Set up a channel to receive OS signals so we can gracefully exit
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+
+	logging.Info("Polling devices for changes every %s", interval)
+	tick := time.Tick(interval)
+
+	for {
+		select {
+		case <-tick:
+			lc.PollDevices()
+		case <-signalChan:
+			// Stop the loop when an interrupt signal is received
+			logging.Info("Background device poller interrupted, exiting")
+			return
+		}
+	}
+}
+
+func listenForState(lc *lifx.LIFXClient) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	lc.ListenForState(ctx)
+	logging.Info("Background state listener interrupted, exiting")
+}
+
+func adjustAdaptive(lc *lifx.LIFXClient) {
+	// Set up a channel to receive OS signals so we can gracefully exit
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+
+	tick := time.Tick(1 * time.Minute)
+
+	for {
+		select {
+		case <-tick:
+			lc.AdjustAdaptive()
+		case <-signalChan:
+			// Stop the loop when an interrupt signal is received
+			logging.Info("Background adaptive adjuster interrupted, exiting")
+			return
+		}
+	}
+}
+
+func runScheduler(s *schedule.Scheduler) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	s.Run(ctx)
+	logging.Info("Scheduler interrupted, exiting")
+}
+
+// loggingConfig reads LOG_LEVEL and LOG_FORMAT, falling back to info level
+// text output.
+func loggingConfig() logging.Config {
+	cfg := logging.Config{Flags: logging.DefaultFlags, Level: logging.LevelInfo, Format: logging.FormatText}
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		level, err := logging.ParseLevel(v)
+		if err != nil {
+			logging.Error("Error parsing LOG_LEVEL %s", err)
+		} else {
+			cfg.Level = level
+		}
+	}
+	if v := os.Getenv("LOG_FORMAT"); v != "" {
+		format, err := logging.ParseFormat(v)
+		if err != nil {
+			logging.Error("Error parsing LOG_FORMAT %s", err)
+		} else {
+			cfg.Format = format
+		}
+	}
+	return cfg
+}
+
+// readinessConfig reads the /readyz criteria, falling back to the defaults.
+func readinessConfig() web.ReadinessConfig {
+	cfg := web.DefaultReadinessConfig
+	if v := os.Getenv("READY_REQUIRE_MQTT"); v != "" {
+		requireMQTT, err := strconv.ParseBool(v)
+		if err != nil {
+			logging.Error("Error parsing READY_REQUIRE_MQTT %s", err)
+		} else {
+			cfg.RequireMQTT = requireMQTT
+		}
+	}
+	if v := os.Getenv("READY_MIN_DEVICES"); v != "" {
+		minDevices, err := strconv.Atoi(v)
+		if err != nil {
+			logging.Error("Error parsing READY_MIN_DEVICES %s", err)
+		} else {
+			cfg.MinDevices = minDevices
+		}
+	}
+	if os.Getenv("READY_MAX_REFRESH_AGE") != "" {
+		cfg.MaxRefreshAge = parseDuration("READY_MAX_REFRESH_AGE")
+	}
+	return cfg
+}
+
+// transitionConfig reads the default transitions from TRANSITIONS_FILE, with
+// DEFAULT_DURATION, POWER_ON_DURATION and POWER_OFF_DURATION overriding its
+// defaults.
+func transitionConfig() lifx.TransitionConfig {
+	var cfg lifx.TransitionConfig
+	if path := os.Getenv("TRANSITIONS_FILE"); path != "" {
+		loaded, err := lifx.LoadTransitionConfig(path)
+		if err != nil {
+			logging.Error("Error loading TRANSITIONS_FILE %s", err)
+		} else {
+			cfg = *loaded
+		}
+	}
+	override := func(key string, field **mqtt.Duration) {
+		value := os.Getenv(key)
+		if value == "" {
+			return
+		}
+		d, err := mqtt.ParseDuration(value)
+		if err != nil {
+			logging.Error("Error parsing %s %s", key, err)
+			return
+		}
+		*field = &d
+	}
+	override("DEFAULT_DURATION", &cfg.Default.Duration)
+	override("POWER_ON_DURATION", &cfg.Default.PowerOn)
+	override("POWER_OFF_DURATION", &cfg.Default.PowerOff)
+	return cfg
+}
+
+// coordinates reads LATITUDE and LONGITUDE, for solar events and adaptive
+// lights, returning nil if they aren't set.
+func coordinates() *solar.Coordinates {
+	lat, lon := os.Getenv("LATITUDE"), os.Getenv("LONGITUDE")
+	if lat == "" && lon == "" {
+		return nil
+	}
+	latitude, err := strconv.ParseFloat(lat, 64)
+	if err != nil || latitude < -90 || latitude > 90 {
+		logging.Error("Error parsing LATITUDE %q", lat)
+		return nil
+	}
+	longitude, err := strconv.ParseFloat(lon, 64)
+	if err != nil || longitude < -180 || longitude > 180 {
+		logging.Error("Error parsing LONGITUDE %q", lon)
+		return nil
+	}
+	return &solar.Coordinates{Latitude: latitude, Longitude: longitude}
+}
+
+func parseDuration(key string) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		logging.Error("Error parsing %s %s", key, err)
+		return 0
+	}
+	return d
+}
+
+func startServer(port int, lc *lifx.LIFXClient, hub *web.Hub, health *web.Health, scheduler *schedule.Scheduler) {
 	logging.Info("Creating HTTP server")
-	handler := web.CreateHandler()
+	handler := web.CreateHandler(lc, hub, health, scheduler)
 	server := http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
 		Handler: handler,
@@ -0,0 +1,372 @@
+// Command lifxctl controls and inspects LIFX devices directly over the LAN,
+// without going through MQTT. It is handy when the bridge itself is suspect.
+//
+//	lifxctl list
+//	lifxctl -json get "Kitchen Light"
+//	lifxctl power d073d5012345 on
+//	lifxctl -ip 192.168.1.20 color d073d5012345 '#ff8800'
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+	lifxlight "github.com/denwilliams/go-lifx-mqtt/internal/lifx/light"
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"github.com/icza/gox/imagex/colorx"
+	"go.yhsif.com/lifxlan"
+)
+
+const usage = `Usage: lifxctl [flags] <command> [args]
+
+Commands:
+  list                          discover devices and list them
+  get <device>                  show the current state of a device
+  power <device> on|off         turn a device on or off
+  color <device> <#rrggbb>      set the color of a light
+  white <device> <brightness> <kelvin>
+                                set a light to white, brightness 1-100
+  waveform <device> <#rrggbb>   run a waveform effect on a light, see
+                                lifxctl waveform -h for its flags
+  relay <device> <relay> on|off turn a switch relay, by index or name, on or off
+  board <device> <file|->       set a tile board from a JSON file of rows
+                                of hex colors, top row first
+
+power, color, white and board accept -duration before the device, eg:
+lifxctl white -duration 2s Kitchen 80 2700
+
+A device is its id (eg: d073d5012345 or d0:73:d5:01:23:45) or its label.
+
+Flags:
+`
+
+var (
+	jsonOutput = flag.Bool("json", false, "print JSON instead of a table")
+	broadcast  = flag.String("addr", os.Getenv("LIFX_BROADCAST_ADDR"), "address to send discovery messages to")
+	ip         = flag.String("ip", "", "IP address of the device, skipping discovery")
+	timeout    = flag.Duration("timeout", 3*time.Second, "how long to discover devices for")
+	verbose    = flag.Bool("v", false, "log debug messages")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	level := logging.LevelWarn
+	if *verbose {
+		level = logging.LevelDebug
+	}
+	logging.Configure(logging.Config{Out: os.Stderr, Level: level, Format: logging.FormatText})
+
+	if err := run(os.Stdout, flag.Arg(0), flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "lifxctl: %s\n", err)
+		if errors.Is(err, errUsage) {
+			flag.Usage()
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+var errUsage = errors.New("invalid arguments")
+
+// run runs command, printing any devices to w.
+func run(w io.Writer, command string, args []string) error {
+	switch command {
+	case "list":
+		if len(args) != 0 {
+			return errUsage
+		}
+		lc, err := discover()
+		if err != nil {
+			return err
+		}
+		refreshAll(lc)
+		return printDevices(w, lc.Devices())
+	case "get":
+		if len(args) != 1 {
+			return errUsage
+		}
+		lc, id, err := connect(args[0])
+		if err != nil {
+			return err
+		}
+		if err := lc.Refresh(context.Background(), id); err != nil {
+			return err
+		}
+		return printDevices(w, []*lifx.DeviceState{lc.Device(id)})
+	case "waveform":
+		return runWaveform(args)
+	}
+
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	var duration mqtt.Duration
+	fs.Func("duration", "transition time, eg: 2s or PT5M", func(s string) (err error) {
+		duration, err = mqtt.ParseDuration(s)
+		return err
+	})
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		return errUsage
+	}
+	c := &mqtt.Command{Duration: &duration}
+
+	switch {
+	case command == "power" && len(args) == 2:
+		power, err := parsePower(args[1])
+		if err != nil {
+			return err
+		}
+		c.Power = &power
+	case command == "color" && len(args) == 2:
+		if _, err := colorx.ParseHexColor(args[1]); err != nil {
+			return err
+		}
+		c.Color = &args[1]
+	case command == "white" && len(args) == 3:
+		brightness, err := strconv.ParseUint(args[1], 10, 16)
+		if err != nil || brightness < 1 || brightness > 100 {
+			return fmt.Errorf("brightness must be 1-100, got %q", args[1])
+		}
+		kelvin, err := strconv.ParseUint(args[2], 10, 16)
+		if err != nil || kelvin == 0 {
+			return fmt.Errorf("invalid kelvin %q", args[2])
+		}
+		b, k := uint16(brightness), uint16(kelvin)
+		c.Brightness = &b
+		c.Temperature = &k
+	case command == "relay" && len(args) == 3:
+		power, err := parsePower(args[2])
+		if err != nil {
+			return err
+		}
+		c.Relays = map[string]bool{args[1]: power}
+	case command == "board" && len(args) == 2:
+		board, err := readBoard(args[1])
+		if err != nil {
+			return err
+		}
+		c.Board = board
+	case command == "power" || command == "color" || command == "white" || command == "relay" || command == "board":
+		return errUsage
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+
+	lc, id, err := connect(args[0])
+	if err != nil {
+		return err
+	}
+	return lc.HandleCommand(context.Background(), id, c)
+}
+
+func runWaveform(args []string) error {
+	fs := flag.NewFlagSet("waveform", flag.ContinueOnError)
+	waveform := fs.String("waveform", "sine", "saw, sine, half-sine, triangle or pulse")
+	period := fs.Duration("period", time.Second, "duration of a cycle")
+	cycles := fs.Float64("cycles", 1, "number of cycles")
+	skew := fs.Float64("skew", 0.5, "time spent on the original color in each cycle (0 to 1), for pulse")
+	kelvin := fs.Uint("kelvin", 3500, "kelvin of the color")
+	transient := fs.Bool("transient", true, "return to the original color afterwards")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != 2 {
+		return errUsage
+	}
+
+	w, err := parseWaveform(*waveform)
+	if err != nil {
+		return err
+	}
+	c, err := colorx.ParseHexColor(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	lc, id, err := connect(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return lc.SetWaveform(context.Background(), id, &lifxlight.SetWaveformArgs{
+		Transient: *transient,
+		Color:     lifxlan.FromColor(c, uint16(*kelvin)),
+		Period:    *period,
+		Cycles:    float32(*cycles),
+		Waveform:  w,
+		SkewRatio: *skew,
+	})
+}
+
+// discover finds and loads the devices on the network.
+func discover() (*lifx.LIFXClient, error) {
+	lc := lifx.NewClient(lifx.NewMultiEmitter())
+	if *broadcast != "" {
+		lc.SetBroadcastAddr(*broadcast)
+	}
+	if lc.DiscoverWithTimeout(*timeout) == 0 {
+		return nil, errors.New("no devices found")
+	}
+	lc.LoadDevicesAndWait()
+	return lc, nil
+}
+
+// refreshAll queries the current state of every loaded device. Failures are
+// recorded in each device's state.
+func refreshAll(lc *lifx.LIFXClient) {
+	var wg sync.WaitGroup
+	for _, s := range lc.Devices() {
+		if !s.Loaded {
+			continue
+		}
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			lc.Refresh(context.Background(), id)
+		}(s.ID)
+	}
+	wg.Wait()
+}
+
+// connect finds the device named by name, returning its id.
+func connect(name string) (*lifx.LIFXClient, string, error) {
+	if *ip != "" {
+		mac := normalizeID(name)
+		if len(mac) == 12 {
+			mac = strings.Join([]string{mac[0:2], mac[2:4], mac[4:6], mac[6:8], mac[8:10], mac[10:12]}, ":")
+		}
+		lc := lifx.NewClient(lifx.NewMultiEmitter())
+		if err := lc.AddDevice(*ip, mac); err != nil {
+			return nil, "", err
+		}
+		return lc, normalizeID(name), nil
+	}
+
+	lc, err := discover()
+	if err != nil {
+		return nil, "", err
+	}
+	id := normalizeID(name)
+	for _, s := range lc.Devices() {
+		if s.ID == id || strings.EqualFold(s.Label, name) {
+			return lc, s.ID, nil
+		}
+	}
+	return nil, "", fmt.Errorf("%w: device %s", lifx.ErrNotFound, name)
+}
+
+// normalizeID turns a MAC address into a device id, eg: d073d5012345.
+func normalizeID(s string) string {
+	return strings.ToLower(strings.NewReplacer(":", "", "-", "").Replace(s))
+}
+
+func parsePower(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "on", "true", "1":
+		return true, nil
+	case "off", "false", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("power must be on or off, got %q", s)
+}
+
+func parseWaveform(s string) (lifxlight.Waveform, error) {
+	switch strings.ToLower(s) {
+	case "saw":
+		return lifxlight.WaveformSaw, nil
+	case "sine":
+		return lifxlight.WaveformSine, nil
+	case "half-sine":
+		return lifxlight.WaveformHalfSine, nil
+	case "triangle":
+		return lifxlight.WaveformTriangle, nil
+	case "pulse":
+		return lifxlight.WaveformPulse, nil
+	}
+	return 0, fmt.Errorf("unknown waveform %q", s)
+}
+
+// readBoard reads rows of hex colors from a JSON file, or stdin if path is -.
+func readBoard(path string) ([][]string, error) {
+	r := os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var board [][]string
+	if err := json.NewDecoder(r).Decode(&board); err != nil {
+		return nil, fmt.Errorf("reading board: %w", err)
+	}
+	return board, nil
+}
+
+func printDevices(w io.Writer, devices []*lifx.DeviceState) error {
+	if *jsonOutput {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if len(devices) == 1 {
+			return enc.Encode(devices[0])
+		}
+		return enc.Encode(devices)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tLABEL\tPRODUCT\tTYPE\tADDRESS\tPOWER\tSTATE")
+	for _, s := range devices {
+		power := "off"
+		if s.Power {
+			power = "on"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.ID, s.Label, s.Product, s.Type, s.Address, power, describe(s))
+	}
+	return tw.Flush()
+}
+
+// describe summarises the type specific state of a device.
+func describe(s *lifx.DeviceState) string {
+	var parts []string
+	if s.Color != nil {
+		parts = append(parts, fmt.Sprintf("hue=%d sat=%d bri=%d%% kelvin=%d", s.Color.Hue, s.Color.Saturation, s.Color.Brightness, s.Color.Kelvin))
+	}
+	for i, on := range s.Relays {
+		if i < len(s.RelayNames) && s.RelayNames[i] != "" {
+			parts = append(parts, fmt.Sprintf("relay%d(%s)=%v", i, s.RelayNames[i], on))
+		} else {
+			parts = append(parts, fmt.Sprintf("relay%d=%v", i, on))
+		}
+	}
+	if s.Width > 0 {
+		parts = append(parts, fmt.Sprintf("board=%dx%d", s.Width, s.Height))
+	}
+	if s.Error != nil {
+		parts = append(parts, "error="+strconv.Quote(s.Error.Message))
+	}
+	return strings.Join(parts, " ")
+}
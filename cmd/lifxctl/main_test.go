@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/emulator"
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"go.yhsif.com/lifxlan"
+)
+
+func TestCommands(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	logging.Init(&strings.Builder{}, 0)
+
+	network, err := emulator.NewNetwork(emulator.ListenAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { network.Close() })
+
+	add := func(cfg emulator.Config) *emulator.Device {
+		t.Helper()
+		d, err := network.Add(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	bulb := add(emulator.Config{
+		Label:   "Kitchen",
+		Version: emulator.ProductA19,
+		Power:   lifxlan.PowerOn,
+		Color:   lifxlan.Color{Brightness: 0xffff, Kelvin: 2700},
+	})
+	sw := add(emulator.Config{Label: "Switch", Version: emulator.ProductSwitch})
+	tiles := add(emulator.Config{Label: "Tiles", Version: emulator.ProductTile})
+	id := func(d *emulator.Device) string {
+		return strings.Replace(d.Target().String(), ":", "", -1)
+	}
+
+	defer func(addr string, d time.Duration) {
+		*broadcast, *timeout = addr, d
+	}(*broadcast, *timeout)
+	*broadcast = network.Addr()
+	*timeout = 500 * time.Millisecond
+
+	// lifxctl runs a command, returning what it printed.
+	lifxctl := func(t *testing.T, asJSON bool, command string, args ...string) (string, error) {
+		t.Helper()
+		defer func(v bool) { *jsonOutput = v }(*jsonOutput)
+		*jsonOutput = asJSON
+		var out strings.Builder
+		err := run(&out, command, args)
+		return out.String(), err
+	}
+
+	t.Run("List", func(t *testing.T) {
+		out, err := lifxctl(t, false, "list")
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		if len(lines) != 4 {
+			t.Fatalf("Expected a header and 3 devices, got:\n%s", out)
+		}
+		if fields := strings.Fields(lines[0]); strings.Join(fields, " ") != "ID LABEL PRODUCT TYPE ADDRESS POWER STATE" {
+			t.Errorf("Unexpected header %q", lines[0])
+		}
+		for _, want := range []struct {
+			d     *emulator.Device
+			parts []string
+		}{
+			{bulb, []string{"Kitchen", "light", " on ", "bri=100% kelvin=2700"}},
+			{sw, []string{"Switch", "switch", " off ", "relay0=false", "relay3=false"}},
+			{tiles, []string{"Tiles", "matrix", "board=8x8"}},
+		} {
+			var line string
+			for _, l := range lines[1:] {
+				if strings.HasPrefix(l, id(want.d)) {
+					line = l
+				}
+			}
+			if line == "" {
+				t.Errorf("Expected a row for %s, got:\n%s", want.d.Label(), out)
+				continue
+			}
+			for _, part := range want.parts {
+				if !strings.Contains(line, part) {
+					t.Errorf("Expected %q in the row %q", part, line)
+				}
+			}
+		}
+	})
+
+	t.Run("ListJSON", func(t *testing.T) {
+		out, err := lifxctl(t, true, "list")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var devices []*lifx.DeviceState
+		if err := json.Unmarshal([]byte(out), &devices); err != nil {
+			t.Fatalf("Expected a JSON list of devices, got %v:\n%s", err, out)
+		}
+		types := map[string]string{}
+		for _, s := range devices {
+			types[s.ID] = s.Type
+		}
+		want := map[string]string{id(bulb): "light", id(sw): "switch", id(tiles): "matrix"}
+		if len(types) != len(want) {
+			t.Fatalf("Expected %v, got %v", want, types)
+		}
+		for k, v := range want {
+			if types[k] != v {
+				t.Errorf("Expected %s to be a %s, got %q", k, v, types[k])
+			}
+		}
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		// By label, case insensitively
+		out, err := lifxctl(t, false, "get", "kitchen")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[1], id(bulb)) {
+			t.Errorf("Expected a header and the bulb, got:\n%s", out)
+		}
+
+		// By MAC address
+		out, err = lifxctl(t, true, "get", bulb.Target().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s lifx.DeviceState
+		if err := json.Unmarshal([]byte(out), &s); err != nil {
+			t.Fatalf("Expected a JSON device, got %v:\n%s", err, out)
+		}
+		if s.ID != id(bulb) || s.Label != "Kitchen" || !s.Power || s.Color == nil || s.Color.Kelvin != 2700 {
+			t.Errorf("Unexpected state %+v", s)
+		}
+	})
+
+	t.Run("Power", func(t *testing.T) {
+		if _, err := lifxctl(t, false, "power", id(bulb), "off"); err != nil {
+			t.Fatal(err)
+		}
+		if p := bulb.Power(); p != lifxlan.PowerOff {
+			t.Errorf("Expected the bulb to be off, got %v", p)
+		}
+	})
+
+	t.Run("Color", func(t *testing.T) {
+		if _, err := lifxctl(t, false, "color", "Kitchen", "#0000ff"); err != nil {
+			t.Fatal(err)
+		}
+		if c := bulb.Color(); c.Hue == 0 || c.Saturation != 0xffff {
+			t.Errorf("Expected the bulb to be blue, got %+v", c)
+		}
+	})
+
+	t.Run("Relay", func(t *testing.T) {
+		if _, err := lifxctl(t, false, "relay", id(sw), "2", "on"); err != nil {
+			t.Fatal(err)
+		}
+		if p := sw.RelayPower(2); p != lifxlan.PowerOn {
+			t.Errorf("Expected relay 2 to be on, got %v", p)
+		}
+
+		out, err := lifxctl(t, true, "get", id(sw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s lifx.DeviceState
+		if err := json.Unmarshal([]byte(out), &s); err != nil {
+			t.Fatal(err)
+		}
+		if want := []bool{false, false, true, false}; !reflect.DeepEqual(s.Relays, want) {
+			t.Errorf("Expected relays %v, got %v", want, s.Relays)
+		}
+	})
+
+	t.Run("Board", func(t *testing.T) {
+		row := `["#ff0000","#ff0000","#ff0000","#ff0000","#ff0000","#ff0000","#ff0000","#ff0000"]`
+		rows := make([]string, 8)
+		for i := range rows {
+			rows[i] = row
+		}
+		path := filepath.Join(t.TempDir(), "board.json")
+		if err := os.WriteFile(path, []byte("["+strings.Join(rows, ",")+"]"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := lifxctl(t, false, "board", "Tiles", path); err != nil {
+			t.Fatal(err)
+		}
+		for i, c := range tiles.TileColors(0) {
+			if c.Brightness == 0 || c.Saturation != 0xffff {
+				t.Fatalf("Expected pixel %d to be red, got %+v", i, c)
+			}
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		if _, err := lifxctl(t, false, "power", "Missing", "on"); !errors.Is(err, lifx.ErrNotFound) {
+			t.Errorf("Expected an unknown device to be not found, got %v", err)
+		}
+		if _, err := lifxctl(t, false, "power", id(bulb)); !errors.Is(err, errUsage) {
+			t.Errorf("Expected a missing power to be a usage error, got %v", err)
+		}
+		if _, err := lifxctl(t, false, "power", id(bulb), "dim"); err == nil {
+			t.Errorf("Expected an invalid power to fail")
+		}
+		if _, err := lifxctl(t, false, "explode", id(bulb)); err == nil || !strings.Contains(err.Error(), "unknown command") {
+			t.Errorf("Expected an unknown command to fail, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,252 @@
+package lifx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"github.com/denwilliams/go-lifx-mqtt/internal/solar"
+)
+
+var (
+	// adaptiveTransition is how long each adaptive adjustment takes
+	adaptiveTransition = 5 * time.Second
+	// adaptiveKelvinStep and adaptiveBrightnessStep are the smallest
+	// changes worth sending to a light
+	adaptiveKelvinStep     = 25
+	adaptiveBrightnessStep = 1
+	// adaptiveDarkElevation is the sun's elevation in degrees, the end of
+	// civil twilight, at and below which lights are warmest
+	adaptiveDarkElevation = -6.0
+	// defaultKelvinRange is used for devices whose range isn't known
+	defaultKelvinRange = [2]uint16{2500, 9000}
+)
+
+// ErrInvalidAdaptive is returned for adaptive settings that can't be used.
+var ErrInvalidAdaptive = errors.New("invalid adaptive settings")
+
+// SetCoordinates sets where the lights are, which adaptive color
+// temperature needs.
+func (lc *LIFXClient) SetCoordinates(c *solar.Coordinates) {
+	lc.adaptiveMu.Lock()
+	defer lc.adaptiveMu.Unlock()
+	lc.coordinates = c
+}
+
+// StartAdaptive adjusts a light's color temperature, and optionally
+// brightness, with the height of the sun while it is on, replacing any
+// adaptive settings it already has. The light is adjusted straight away if
+// it is on.
+func (lc *LIFXClient) StartAdaptive(ctx context.Context, id string, settings mqtt.Adaptive) error {
+	l := lc.devices.Get(id)
+	if l == nil {
+		return fmt.Errorf("%w: device %s", ErrNotFound, id)
+	}
+	if err := validateAdaptive(&settings); err != nil {
+		return err
+	}
+
+	lc.adaptiveMu.Lock()
+	if lc.coordinates == nil {
+		lc.adaptiveMu.Unlock()
+		return fmt.Errorf("%w: adaptive needs a latitude and longitude", ErrInvalidAdaptive)
+	}
+	if lc.adaptive == nil {
+		lc.adaptive = make(map[string]mqtt.Adaptive)
+	}
+	_, existed := lc.adaptive[id]
+	lc.adaptive[id] = settings
+	lc.adaptiveMu.Unlock()
+
+	l.logger().With("settings", settings).Info("Started adaptive")
+	if !existed {
+		lc.emitter.EmitRetainedStatus(ctx, id, "adaptive", true)
+	}
+	return lc.adjust(ctx, l, time.Duration(lc.transition(id, transitionChange))*time.Millisecond)
+}
+
+// StopAdaptive stops adjusting a light, leaving it as it is. It returns true
+// if the light was adaptive.
+func (lc *LIFXClient) StopAdaptive(ctx context.Context, id string) bool {
+	lc.adaptiveMu.Lock()
+	_, ok := lc.adaptive[id]
+	delete(lc.adaptive, id)
+	lc.adaptiveMu.Unlock()
+
+	if ok {
+		logging.With("device", id).Info("Stopped adaptive")
+		lc.emitter.EmitRetainedStatus(ctx, id, "adaptive", false)
+	}
+	return ok
+}
+
+// Adaptive returns true if a light's color temperature is adaptive.
+func (lc *LIFXClient) Adaptive(id string) bool {
+	_, ok := lc.adaptiveSettings(id)
+	return ok
+}
+
+func (lc *LIFXClient) adaptiveSettings(id string) (mqtt.Adaptive, bool) {
+	lc.adaptiveMu.Lock()
+	defer lc.adaptiveMu.Unlock()
+	settings, ok := lc.adaptive[id]
+	return settings, ok
+}
+
+// handleAdaptive starts or stops adaptive for a command's adaptive setting.
+func (lc *LIFXClient) handleAdaptive(ctx context.Context, id string, command *mqtt.Command) error {
+	if !command.Adaptive.Enabled {
+		lc.StopAdaptive(ctx, id)
+		return nil
+	}
+	if overridesAdaptive(command, *command.Adaptive) {
+		return fmt.Errorf("%w: adaptive can't be combined with a color", ErrInvalidAdaptive)
+	}
+	return lc.StartAdaptive(ctx, id, *command.Adaptive)
+}
+
+// AdjustAdaptive moves every adaptive light that is on towards where it
+// should be for the current height of the sun.
+func (lc *LIFXClient) AdjustAdaptive() {
+	lc.adaptiveMu.Lock()
+	ids := make([]string, 0, len(lc.adaptive))
+	for id := range lc.adaptive {
+		ids = append(ids, id)
+	}
+	lc.adaptiveMu.Unlock()
+
+	for _, id := range ids {
+		l := lc.devices.Get(id)
+		if l == nil {
+			continue
+		}
+		go func() {
+			if err := lc.adjust(context.Background(), l, adaptiveTransition); err != nil {
+				l.logger().Warn("Error adjusting adaptive %s", err)
+			}
+		}()
+	}
+}
+
+// adjust sets an adaptive light to its current target if it is on and isn't
+// already close to it.
+func (lc *LIFXClient) adjust(ctx context.Context, l *lifxdevice, transition time.Duration) error {
+	kelvin, brightness, ok := lc.adaptiveWhite(l.id)
+	if !ok {
+		return nil
+	}
+
+	l.stateMu.RLock()
+	on := l.power.On()
+	color := l.color
+	l.stateMu.RUnlock()
+	if !on {
+		return nil
+	}
+	if color != nil && color.Saturation == 0 && math.Abs(float64(color.Kelvin)-float64(kelvin)) < float64(adaptiveKelvinStep) &&
+		(brightness == 0 || math.Abs(float64(uint16toPercent(color.Brightness))-float64(brightness)) < float64(adaptiveBrightnessStep)) {
+		return nil
+	}
+
+	l.logger().With("kelvin", kelvin, "brightness", brightness).Debug("Adjusting adaptive")
+	return lc.run(ctx, l, "AdjustWhite", func(ctx context.Context) error {
+		return l.AdjustWhite(ctx, lc.emitter, brightness, kelvin, uint32(transition.Milliseconds()))
+	})
+}
+
+// adaptiveWhite returns the color temperature and brightness percentage an
+// adaptive light should be now, or false if it isn't adaptive. Brightness is
+// 0 if it isn't adjusted.
+func (lc *LIFXClient) adaptiveWhite(id string) (uint16, uint16, bool) {
+	lc.adaptiveMu.Lock()
+	settings, ok := lc.adaptive[id]
+	coordinates := lc.coordinates
+	lc.adaptiveMu.Unlock()
+	l := lc.devices.Get(id)
+	if !ok || coordinates == nil || l == nil {
+		return 0, 0, false
+	}
+
+	low, high := l.kelvinRange()
+	if settings.MinTemperature > low && settings.MinTemperature <= high {
+		low = settings.MinTemperature
+	}
+	if settings.MaxTemperature != 0 && settings.MaxTemperature < high && settings.MaxTemperature >= low {
+		high = settings.MaxTemperature
+	}
+
+	f := sunProgress(time.Now(), *coordinates)
+	kelvin := interpolateUint16(low, high, f)
+
+	var brightness uint16
+	if settings.AdjustsBrightness() {
+		minBrightness, maxBrightness := uint16(1), uint16(100)
+		if settings.MinBrightness != nil {
+			minBrightness = *settings.MinBrightness
+		}
+		if settings.MaxBrightness != nil {
+			maxBrightness = *settings.MaxBrightness
+		}
+		brightness = interpolateUint16(minBrightness, maxBrightness, f)
+	}
+	return kelvin, brightness, true
+}
+
+// sunProgress returns how high the sun is at t, from 0 at or below civil
+// twilight to 1 at solar noon.
+func sunProgress(t time.Time, c solar.Coordinates) float64 {
+	highest := solar.Elevation(solar.TimesOn(t, c).Noon, c)
+	if highest <= adaptiveDarkElevation {
+		return 0
+	}
+	f := (solar.Elevation(t, c) - adaptiveDarkElevation) / (highest - adaptiveDarkElevation)
+	return math.Max(0, math.Min(1, f))
+}
+
+// onlyAdaptive returns true if a command does nothing but set adaptive.
+func onlyAdaptive(command *mqtt.Command) bool {
+	return command.Power == nil && command.Brightness == nil && command.Color == nil && command.Temperature == nil &&
+		command.Board == nil && command.Image == nil && command.Text == nil && command.Fade == nil && command.Effect == nil &&
+		len(command.Relays) == 0 && command.Buttons == nil
+}
+
+// overridesAdaptive returns true if a command sets the color of an adaptive
+// light, so it should stop being adaptive.
+func overridesAdaptive(command *mqtt.Command, settings mqtt.Adaptive) bool {
+	return command.Color != nil || command.Temperature != nil || command.Board != nil || command.Image != nil || command.Text != nil || command.Fade != nil || command.Effect != nil ||
+		(command.Brightness != nil && *command.Brightness != 0 && settings.AdjustsBrightness())
+}
+
+func validateAdaptive(a *mqtt.Adaptive) error {
+	if a.MinTemperature != 0 && a.MaxTemperature != 0 && a.MinTemperature > a.MaxTemperature {
+		return fmt.Errorf("%w: min_temp %d is over max_temp %d", ErrInvalidAdaptive, a.MinTemperature, a.MaxTemperature)
+	}
+	for _, b := range []*uint16{a.MinBrightness, a.MaxBrightness} {
+		if b != nil && (*b == 0 || *b > 100) {
+			return fmt.Errorf("%w: brightness %d is not between 1 and 100", ErrInvalidAdaptive, *b)
+		}
+	}
+	if a.MinBrightness != nil && a.MaxBrightness != nil && *a.MinBrightness > *a.MaxBrightness {
+		return fmt.Errorf("%w: min_brightness %d is over max_brightness %d", ErrInvalidAdaptive, *a.MinBrightness, *a.MaxBrightness)
+	}
+	return nil
+}
+
+// kelvinRange returns the range of color temperatures the device supports,
+// from its firmware's features if they're known.
+func (l *lifxdevice) kelvinRange() (uint16, uint16) {
+	l.stateMu.RLock()
+	defer l.stateMu.RUnlock()
+
+	if l.info != nil && l.info.Features != nil && l.info.Features.TemperatureRange.Valid() {
+		return l.info.Features.TemperatureRange.Min(), l.info.Features.TemperatureRange.Max()
+	}
+	if l.product != nil && l.product.Features.TemperatureRange.Valid() {
+		return l.product.Features.TemperatureRange.Min(), l.product.Features.TemperatureRange.Max()
+	}
+	return defaultKelvinRange[0], defaultKelvinRange[1]
+}
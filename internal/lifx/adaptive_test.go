@@ -0,0 +1,177 @@
+package lifx_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/emulator"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"github.com/denwilliams/go-lifx-mqtt/internal/solar"
+)
+
+// equatorAt returns coordinates on the equator where it is about the given
+// local solar time now.
+func equatorAt(hour float64) *solar.Coordinates {
+	now := time.Now().UTC()
+	utc := float64(now.Hour()) + float64(now.Minute())/60
+	lon := math.Mod((hour-utc)*15+540, 360) - 180
+	return &solar.Coordinates{Latitude: 0, Longitude: lon}
+}
+
+func TestAdaptive(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	lc, emitter, devices := startClient(t, emulator.Config{Label: "Bulb", Version: emulator.ProductA19})
+	bulb := devices[0]
+	id := deviceID(bulb)
+	ctx := context.Background()
+
+	command := func(t *testing.T, payload string) error {
+		t.Helper()
+		var c mqtt.Command
+		if err := json.Unmarshal([]byte(payload), &c); err != nil {
+			t.Fatal(err)
+		}
+		return lc.HandleCommand(ctx, id, &c)
+	}
+
+	t.Run("NoCoordinates", func(t *testing.T) {
+		if err := command(t, `{"adaptive": true}`); !errors.Is(err, lifx.ErrInvalidAdaptive) {
+			t.Errorf("Expected ErrInvalidAdaptive, got %v", err)
+		}
+	})
+
+	// The A19's range is 2500K to 9000K
+	lc.SetCoordinates(equatorAt(0))
+	if err := command(t, `{"power": true, "brightness": 50, "temp": 4000, "duration": 0}`); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the power to be cached", func() bool {
+		return lc.Device(id).Power
+	})
+
+	t.Run("Night", func(t *testing.T) {
+		if err := command(t, `{"adaptive": true}`); err != nil {
+			t.Fatal(err)
+		}
+		if !lc.Adaptive(id) || !lc.Device(id).Adaptive || !emitter.has(id, "adaptive", true) {
+			t.Errorf("Expected the bulb to be adaptive")
+		}
+		eventually(t, "the warmest white", func() bool {
+			return bulb.Color().Kelvin == 2500
+		})
+	})
+
+	t.Run("Noon", func(t *testing.T) {
+		lc.SetCoordinates(equatorAt(12))
+		lc.AdjustAdaptive()
+		eventually(t, "a cool white", func() bool {
+			return bulb.Color().Kelvin > 8000
+		})
+		if got := bulb.Transition(); got != 5*time.Second {
+			t.Errorf("Expected a 5s transition, got %s", got)
+		}
+		if c := bulb.Color(); c.Saturation != 0 || c.Brightness != 0x7fff {
+			t.Errorf("Expected brightness to stay 50%%, got %+v", c)
+		}
+	})
+
+	t.Run("OnlyWhileOn", func(t *testing.T) {
+		if err := command(t, `{"power": false, "duration": 0}`); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, "the power to be cached", func() bool {
+			return !lc.Device(id).Power
+		})
+
+		lc.SetCoordinates(equatorAt(0))
+		lc.AdjustAdaptive()
+		time.Sleep(200 * time.Millisecond)
+		if bulb.Power().On() || bulb.Color().Kelvin < 8000 {
+			t.Errorf("Expected the bulb to stay off and unchanged, got %+v", bulb.Color())
+		}
+
+		// Turning on goes straight to the adaptive temperature
+		if err := command(t, `{"power": true, "duration": 0}`); err != nil {
+			t.Fatal(err)
+		}
+		if !bulb.Power().On() || bulb.Color().Kelvin != 2500 {
+			t.Errorf("Expected the bulb to turn on at 2500K, got %+v", bulb.Color())
+		}
+		eventually(t, "the power to be cached", func() bool {
+			return lc.Device(id).Power
+		})
+	})
+
+	t.Run("Brightness", func(t *testing.T) {
+		if err := command(t, `{"adaptive": {"min_temp": 2700, "max_temp": 6500, "min_brightness": 20, "max_brightness": 80}}`); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, "a dim warm white", func() bool {
+			c := bulb.Color()
+			return c.Kelvin == 2700 && c.Brightness == 0x3333
+		})
+
+		// Manual brightness takes over when brightness is adaptive
+		if err := command(t, `{"brightness": 60, "duration": 0}`); err != nil {
+			t.Fatal(err)
+		}
+		if lc.Adaptive(id) {
+			t.Errorf("Expected the bulb to stop being adaptive")
+		}
+	})
+
+	t.Run("ColorOverrides", func(t *testing.T) {
+		if err := command(t, `{"adaptive": true}`); err != nil {
+			t.Fatal(err)
+		}
+		// Brightness alone keeps the adaptive temperature
+		if err := command(t, `{"brightness": 40, "duration": 0}`); err != nil {
+			t.Fatal(err)
+		}
+		if !lc.Adaptive(id) || bulb.Color().Kelvin != 2500 {
+			t.Errorf("Expected the bulb to stay adaptive at 2500K, got %+v", bulb.Color())
+		}
+
+		if err := command(t, `{"color": "#ff0000", "duration": 0}`); err != nil {
+			t.Fatal(err)
+		}
+		if lc.Adaptive(id) || !emitter.has(id, "adaptive", false) {
+			t.Errorf("Expected the bulb to stop being adaptive")
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := map[string]string{
+			"WithColor":        `{"adaptive": true, "temp": 3000}`,
+			"TemperatureOrder": `{"adaptive": {"min_temp": 6000, "max_temp": 3000}}`,
+			"Brightness":       `{"adaptive": {"max_brightness": 101}}`,
+		}
+		for name, payload := range tests {
+			t.Run(name, func(t *testing.T) {
+				if err := command(t, payload); !errors.Is(err, lifx.ErrInvalidAdaptive) {
+					t.Errorf("Expected ErrInvalidAdaptive, got %v", err)
+				}
+			})
+		}
+	})
+
+	t.Run("Disable", func(t *testing.T) {
+		if err := command(t, `{"adaptive": true}`); err != nil {
+			t.Fatal(err)
+		}
+		if err := command(t, `{"adaptive": false}`); err != nil {
+			t.Fatal(err)
+		}
+		if lc.Adaptive(id) {
+			t.Errorf("Expected the bulb to stop being adaptive")
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package lifx
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"time"
+
+	lifxtile "github.com/denwilliams/go-lifx-mqtt/internal/lifx/tile"
+)
+
+// boardTimeout limits reading a board, which waits for a reply from every
+// tile, so a lost reply doesn't hold up the rest of a refresh.
+const boardTimeout = 2 * time.Second
+
+// boardPayload is what a matrix device is showing, and how its tiles are
+// laid out, for drawing a preview.
+type boardPayload struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// Board is rows of hex colors, top row first, like the board command.
+	// Points that aren't on a tile are empty strings.
+	Board [][]string    `json:"board"`
+	Tiles []tilePayload `json:"tiles"`
+}
+
+type tilePayload struct {
+	UserX    float32 `json:"user_x"`
+	UserY    float32 `json:"user_y"`
+	Width    uint8   `json:"width"`
+	Height   uint8   `json:"height"`
+	Rotation string  `json:"rotation"`
+}
+
+// getBoard reads the colors of a matrix device's board. The caller must hold
+// l.mu.
+func (l *lifxdevice) getBoard(ctx context.Context, conn net.Conn) (*boardPayload, error) {
+	ctx, cancel := context.WithTimeout(ctx, boardTimeout)
+	defer cancel()
+
+	cb, err := l.tile.GetColors(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	return toBoardPayload(l.tile, cb), nil
+}
+
+// setBoard updates the cached board, emitting a status if it changed. The
+// caller must hold l.mu.
+func (l *lifxdevice) setBoard(ctx context.Context, emitter StatusEmitter, board *boardPayload) {
+	l.stateMu.Lock()
+	changed := !reflect.DeepEqual(l.board, board)
+	l.board = board
+	l.stateMu.Unlock()
+
+	if !changed {
+		return
+	}
+	l.logger().With("width", board.Width, "height", board.Height).Debug("Refreshed board")
+	emitter.EmitStatus(ctx, l.id, "board", board)
+}
+
+// toBoardPayload converts the colors read from a matrix device into rows of
+// hex colors, along with the device's tiles.
+func toBoardPayload(d lifxtile.Device, cb lifxtile.ColorBoard) *boardPayload {
+	width, height := d.Width(), d.Height()
+	payload := &boardPayload{
+		Width:  width,
+		Height: height,
+		Board:  make([][]string, height),
+	}
+	for row := range payload.Board {
+		payload.Board[row] = make([]string, width)
+		// The board's origin is the bottom left corner
+		y := height - 1 - row
+		for x := 0; x < width; x++ {
+			if c := cb.GetColor(x, y); c != nil {
+				payload.Board[row][x] = toHexColor(*c)
+			}
+		}
+	}
+	for _, t := range d.Tiles() {
+		payload.Tiles = append(payload.Tiles, tilePayload{
+			UserX:    t.UserX,
+			UserY:    t.UserY,
+			Width:    t.Width,
+			Height:   t.Height,
+			Rotation: t.Rotation.String(),
+		})
+	}
+	return payload
+}
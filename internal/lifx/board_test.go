@@ -0,0 +1,92 @@
+package lifx_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/emulator"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/tile"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+)
+
+func TestBoardStatus(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	lc, emitter, devices := startClient(t, emulator.Config{
+		Label:     "Tiles",
+		Version:   emulator.ProductTile,
+		Rotations: []tile.Rotation{tile.RotationRightSideUp, tile.RotationUpsideDown},
+	})
+	tiles := devices[0]
+	id := deviceID(tiles)
+	ctx := context.Background()
+
+	var board struct {
+		Width  int        `json:"width"`
+		Height int        `json:"height"`
+		Board  [][]string `json:"board"`
+		Tiles  []struct {
+			UserX    float32 `json:"user_x"`
+			Width    uint8   `json:"width"`
+			Height   uint8   `json:"height"`
+			Rotation string  `json:"rotation"`
+		} `json:"tiles"`
+	}
+	refresh := func(t *testing.T) {
+		t.Helper()
+		if err := lc.Refresh(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(emitter.last(id, "board"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, &board); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("Geometry", func(t *testing.T) {
+		refresh(t)
+		if board.Width != 16 || board.Height != 8 || len(board.Board) != 8 || len(board.Board[0]) != 16 {
+			t.Fatalf("Expected a 16x8 board, got %dx%d", board.Width, board.Height)
+		}
+		if len(board.Tiles) != 2 {
+			t.Fatalf("Expected 2 tiles, got %d", len(board.Tiles))
+		}
+		second := board.Tiles[1]
+		if second.UserX != 1 || second.Width != 8 || second.Height != 8 || second.Rotation != "UpsideDown" {
+			t.Errorf("Expected an upside down 8x8 tile at x 1, got %+v", second)
+		}
+	})
+
+	t.Run("Colors", func(t *testing.T) {
+		// Red in the top left corner and green in the bottom right
+		rows := make([][]string, 8)
+		rows[0] = []string{"#ff0000"}
+		rows[7] = make([]string, 16)
+		rows[7][15] = "#00ff00"
+		duration := mqtt.Duration(0)
+		if err := lc.HandleCommand(ctx, id, &mqtt.Command{Board: rows, Duration: &duration}); err != nil {
+			t.Fatal(err)
+		}
+		// The top left pixel of the upside down tile
+		if c := tiles.TileColors(1)[0]; c.Brightness == 0 {
+			t.Errorf("Expected the bottom right to be lit, got %+v", c)
+		}
+
+		refresh(t)
+		if got := board.Board[0][0]; got != "#ff0000" {
+			t.Errorf("Expected the top left to be red, got %q", got)
+		}
+		if got := board.Board[7][15]; got != "#00ff00" {
+			t.Errorf("Expected the bottom right to be green, got %q", got)
+		}
+		if got := board.Board[3][8]; got != "#000000" {
+			t.Errorf("Expected the rest to be off, got %q", got)
+		}
+	})
+}
@@ -0,0 +1,332 @@
+package lifx
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+
+	lifxrelay "github.com/denwilliams/go-lifx-mqtt/internal/lifx/relay"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"go.yhsif.com/lifxlan"
+)
+
+// ErrInvalidButtons is returned for button configuration that can't be set.
+var ErrInvalidButtons = errors.New("invalid button configuration")
+
+var (
+	buttonGestures = map[string]lifxrelay.ButtonGesture{
+		"press":       lifxrelay.GesturePress,
+		"hold":        lifxrelay.GestureHold,
+		"press_press": lifxrelay.GesturePressPress,
+		"press_hold":  lifxrelay.GesturePressHold,
+		"hold_hold":   lifxrelay.GestureHoldHold,
+	}
+	buttonTargets = map[string]lifxrelay.ButtonTargetType{
+		"relays":        lifxrelay.TargetRelays,
+		"device":        lifxrelay.TargetDevice,
+		"device_relays": lifxrelay.TargetDeviceRelays,
+		"location":      lifxrelay.TargetLocation,
+		"group":         lifxrelay.TargetGroup,
+		"scene":         lifxrelay.TargetScene,
+	}
+)
+
+// buttonChanges is a parsed button configuration command. Nil fields are
+// left unchanged.
+type buttonChanges struct {
+	hapticDuration *uint16
+	backlightOn    *lifxlan.Color
+	backlightOff   *lifxlan.Color
+	// buttons has the new actions of each button by index
+	buttons map[int]lifxrelay.RawButton
+}
+
+// parseButtonConfig converts a button configuration command.
+func parseButtonConfig(cfg *mqtt.ButtonConfig) (*buttonChanges, error) {
+	changes := &buttonChanges{}
+	if cfg.HapticDuration != nil {
+		if *cfg.HapticDuration > math.MaxUint16 {
+			return nil, fmt.Errorf("%w: haptic duration %s is too long", ErrInvalidButtons, cfg.HapticDuration)
+		}
+		d := uint16(*cfg.HapticDuration)
+		changes.hapticDuration = &d
+	}
+
+	backlight := func(name string, s string) (*lifxlan.Color, error) {
+		if s == "" {
+			return nil, nil
+		}
+		c, err := parseHexColor(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s %q: %s", ErrInvalidButtons, name, s, err)
+		}
+		return lifxlan.FromColor(c, 3500), nil
+	}
+	var err error
+	if changes.backlightOn, err = backlight("backlight_on", cfg.BacklightOn); err != nil {
+		return nil, err
+	}
+	if changes.backlightOff, err = backlight("backlight_off", cfg.BacklightOff); err != nil {
+		return nil, err
+	}
+
+	for i, b := range cfg.Buttons {
+		if b == nil {
+			continue
+		}
+		if len(b.Actions) > lifxrelay.MaxButtonActions {
+			return nil, fmt.Errorf("%w: button %d has %d actions, over %d", ErrInvalidButtons, i, len(b.Actions), lifxrelay.MaxButtonActions)
+		}
+		actions := make([]lifxrelay.RawButtonAction, len(b.Actions))
+		for j, a := range b.Actions {
+			action, err := parseButtonAction(a)
+			if err != nil {
+				return nil, fmt.Errorf("button %d: %w", i, err)
+			}
+			actions[j] = action
+		}
+		if changes.buttons == nil {
+			changes.buttons = make(map[int]lifxrelay.RawButton)
+		}
+		changes.buttons[i] = lifxrelay.MakeButton(actions...)
+	}
+	return changes, nil
+}
+
+func parseButtonAction(a mqtt.ButtonAction) (lifxrelay.RawButtonAction, error) {
+	var none lifxrelay.RawButtonAction
+	gesture, ok := buttonGestures[strings.ToLower(a.Gesture)]
+	if !ok {
+		return none, fmt.Errorf("%w: unknown gesture %q", ErrInvalidButtons, a.Gesture)
+	}
+	target, ok := buttonTargets[strings.ToLower(a.Target)]
+	if !ok {
+		return none, fmt.Errorf("%w: unknown target %q", ErrInvalidButtons, a.Target)
+	}
+
+	relays := make([]uint8, len(a.Relays))
+	for i, r := range a.Relays {
+		if r < 0 || r > math.MaxUint8 {
+			return none, fmt.Errorf("%w: relay %d", ErrInvalidButtons, r)
+		}
+		relays[i] = uint8(r)
+	}
+
+	switch target {
+	case lifxrelay.TargetRelays:
+		if len(relays) == 0 || len(relays) > lifxrelay.MaxRelays {
+			return none, fmt.Errorf("%w: %d relays", ErrInvalidButtons, len(relays))
+		}
+		return lifxrelay.RelaysAction(gesture, relays...), nil
+
+	case lifxrelay.TargetDevice, lifxrelay.TargetDeviceRelays:
+		serial, err := parseSerial(a.Device)
+		if err != nil {
+			return none, err
+		}
+		if target == lifxrelay.TargetDevice {
+			return lifxrelay.DeviceAction(gesture, serial), nil
+		}
+		if len(relays) == 0 || len(relays) > lifxrelay.MaxDeviceRelays {
+			return none, fmt.Errorf("%w: %d relays", ErrInvalidButtons, len(relays))
+		}
+		return lifxrelay.DeviceRelaysAction(gesture, serial, relays...), nil
+	}
+
+	var uuid [16]byte
+	b, err := hex.DecodeString(strings.ReplaceAll(a.ID, "-", ""))
+	if err != nil || len(b) != len(uuid) {
+		return none, fmt.Errorf("%w: id %q is not a uuid", ErrInvalidButtons, a.ID)
+	}
+	copy(uuid[:], b)
+	return lifxrelay.UUIDAction(gesture, target, uuid), nil
+}
+
+// parseSerial converts a device id like d073d5000001 into its target.
+func parseSerial(id string) (lifxlan.Target, error) {
+	b, err := hex.DecodeString(strings.Replace(id, ":", "", -1))
+	if err != nil || len(b) != 6 {
+		return 0, fmt.Errorf("%w: device %q", ErrInvalidButtons, id)
+	}
+	var t lifxlan.Target
+	for i, v := range b {
+		t |= lifxlan.Target(v) << (8 * i)
+	}
+	return t, nil
+}
+
+// SetButtonConfig changes the haptic feedback, backlight or actions of a
+// switch's buttons.
+func (lc *LIFXClient) SetButtonConfig(ctx context.Context, id string, cfg *mqtt.ButtonConfig) error {
+	l := lc.devices.Get(id)
+	if l == nil {
+		return fmt.Errorf("%w: device %s", ErrNotFound, id)
+	}
+	if l.relay == nil {
+		return fmt.Errorf("%w: device %s is not a switch", ErrInvalidButtons, id)
+	}
+	changes, err := parseButtonConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	devicesControlled.WithLabelValues("relay", "buttons").Inc()
+	return lc.run(ctx, l, "SetButtonConfig", func(ctx context.Context) error {
+		return l.SetButtonConfig(ctx, lc.emitter, changes)
+	})
+}
+
+// SetButtonConfig applies changes on top of the current button
+// configuration, then publishes the result.
+func (l *lifxdevice) SetButtonConfig(ctx context.Context, emitter StatusEmitter, changes *buttonChanges) error {
+	l.lock(ctx)
+	defer l.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	conn, err := l.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if changes.hapticDuration != nil || changes.backlightOn != nil || changes.backlightOff != nil {
+		var config *lifxrelay.RawButtonConfig
+		err := l.request(ctx, "GetButtonConfig", func(ctx context.Context) (err error) {
+			config, err = l.relay.GetButtonConfig(ctx, conn)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if changes.hapticDuration != nil {
+			config.HapticDuration = *changes.hapticDuration
+		}
+		if changes.backlightOn != nil {
+			config.BacklightOn = *changes.backlightOn
+		}
+		if changes.backlightOff != nil {
+			config.BacklightOff = *changes.backlightOff
+		}
+		err = l.request(ctx, "SetButtonConfig", func(ctx context.Context) error {
+			return l.relay.SetButtonConfig(ctx, conn, config, true)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(changes.buttons) > 0 {
+		var buttons []lifxrelay.RawButton
+		err := l.request(ctx, "GetButtons", func(ctx context.Context) (err error) {
+			buttons, err = l.relay.GetButtons(ctx, conn)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		for i, b := range changes.buttons {
+			if i >= len(buttons) {
+				return fmt.Errorf("%w: button %d of %d", ErrInvalidButtons, i, len(buttons))
+			}
+			buttons[i] = b
+		}
+		for start := 0; start < len(buttons); start += lifxrelay.MaxButtons {
+			end := start + lifxrelay.MaxButtons
+			if end > len(buttons) {
+				end = len(buttons)
+			}
+			err := l.request(ctx, "SetButtons", func(ctx context.Context) error {
+				return l.relay.SetButtons(ctx, conn, uint8(start), buttons[start:end], true)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return l.updateButtons(ctx, emitter, conn)
+}
+
+// updateButtons reads a switch's button configuration, emitting it as a
+// retained status if it changed. The caller must hold l.mu.
+func (l *lifxdevice) updateButtons(ctx context.Context, emitter StatusEmitter, conn net.Conn) error {
+	var config *lifxrelay.RawButtonConfig
+	err := l.request(ctx, "GetButtonConfig", func(ctx context.Context) (err error) {
+		config, err = l.relay.GetButtonConfig(ctx, conn)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	var buttons []lifxrelay.RawButton
+	err = l.request(ctx, "GetButtons", func(ctx context.Context) (err error) {
+		buttons, err = l.relay.GetButtons(ctx, conn)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	payload := toButtonConfigPayload(config, buttons)
+
+	l.stateMu.Lock()
+	changed := !reflect.DeepEqual(l.buttons, payload)
+	l.buttons = payload
+	l.stateMu.Unlock()
+
+	if !changed {
+		return nil
+	}
+	l.logger().With("buttons", len(payload.Buttons)).Debug("Refreshed buttons")
+	return emitter.EmitRetainedStatus(ctx, l.id, "buttons", payload)
+}
+
+// toButtonConfigPayload converts a switch's button configuration into the
+// command that sets it.
+func toButtonConfigPayload(config *lifxrelay.RawButtonConfig, buttons []lifxrelay.RawButton) *mqtt.ButtonConfig {
+	haptic := mqtt.Duration(config.HapticDuration)
+	payload := &mqtt.ButtonConfig{
+		HapticDuration: &haptic,
+		BacklightOn:    toHexColor(config.BacklightOn),
+		BacklightOff:   toHexColor(config.BacklightOff),
+	}
+	for _, b := range buttons {
+		button := &mqtt.Button{Actions: []mqtt.ButtonAction{}}
+		for _, a := range b.ActionList() {
+			action := mqtt.ButtonAction{Gesture: a.Gesture.String(), Target: a.TargetType.String()}
+			switch a.TargetType {
+			case lifxrelay.TargetRelays:
+				action.Relays = toInts(a.Relays())
+			case lifxrelay.TargetDevice:
+				action.Device = toDeviceID(a.Serial())
+			case lifxrelay.TargetDeviceRelays:
+				action.Device = toDeviceID(a.Serial())
+				action.Relays = toInts(a.Relays())
+			default:
+				action.ID = hex.EncodeToString(a.Target[:])
+			}
+			button.Actions = append(button.Actions, action)
+		}
+		payload.Buttons = append(payload.Buttons, button)
+	}
+	return payload
+}
+
+func toDeviceID(t lifxlan.Target) string {
+	return strings.Replace(t.String(), ":", "", -1)
+}
+
+func toInts(relays []uint8) []int {
+	ints := make([]int, len(relays))
+	for i, r := range relays {
+		ints[i] = int(r)
+	}
+	return ints
+}
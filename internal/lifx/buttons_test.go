@@ -0,0 +1,128 @@
+package lifx_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/emulator"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/relay"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+)
+
+func TestButtons(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	lc, emitter, devices := startClient(t,
+		emulator.Config{Label: "Switch", Version: emulator.ProductSwitch},
+		emulator.Config{Label: "Bulb", Version: emulator.ProductA19},
+	)
+	sw, bulb := devices[0], devices[1]
+	id := deviceID(sw)
+	ctx := context.Background()
+
+	command := func(t *testing.T, d *emulator.Device, payload string) error {
+		t.Helper()
+		var c mqtt.Command
+		if err := json.Unmarshal([]byte(payload), &c); err != nil {
+			t.Fatal(err)
+		}
+		return lc.HandleCommand(ctx, deviceID(d), &c)
+	}
+	status := func(t *testing.T) *mqtt.ButtonConfig {
+		t.Helper()
+		cfg, ok := emitter.last(id, "buttons").(*mqtt.ButtonConfig)
+		if !ok {
+			t.Fatalf("Expected a buttons status, got %+v", emitter.last(id, "buttons"))
+		}
+		return cfg
+	}
+
+	t.Run("Status", func(t *testing.T) {
+		lc.RefreshInfo()
+		eventually(t, "the buttons status", func() bool {
+			return emitter.has(id, "buttons", nil)
+		})
+		cfg := status(t)
+		if len(cfg.Buttons) != 4 {
+			t.Fatalf("Expected 4 buttons, got %d", len(cfg.Buttons))
+		}
+		expected := []mqtt.ButtonAction{{Gesture: "press", Target: "relays", Relays: []int{2}}}
+		if actions := cfg.Buttons[2].Actions; !reflect.DeepEqual(actions, expected) {
+			t.Errorf("Expected button 2 to toggle relay 2, got %+v", actions)
+		}
+	})
+
+	t.Run("Set", func(t *testing.T) {
+		payload := `{"buttons": {
+			"haptic_duration": 40,
+			"backlight_on": "#ff0000",
+			"buttons": [null, {"actions": [
+				{"gesture": "hold", "target": "relays", "relays": [0, 1]},
+				{"gesture": "press_press", "target": "device_relays", "device": "d073d5000123", "relays": [3]},
+				{"gesture": "hold_hold", "target": "group", "id": "00112233445566778899aabbccddeeff"}
+			]}]
+		}}`
+		if err := command(t, sw, payload); err != nil {
+			t.Fatal(err)
+		}
+
+		config := sw.ButtonConfig()
+		if config.HapticDuration != 40 || config.BacklightOn.Saturation != 0xffff || config.BacklightOn.Brightness != 0xffff {
+			t.Errorf("Expected 40ms haptics and a red backlight, got %+v", config)
+		}
+		buttons := sw.Buttons()
+		if actions := buttons[0].ActionList(); len(actions) != 1 || actions[0].Gesture != relay.GesturePress {
+			t.Errorf("Expected button 0 to be unchanged, got %+v", actions)
+		}
+		actions := buttons[1].ActionList()
+		if len(actions) != 3 {
+			t.Fatalf("Expected 3 actions, got %+v", actions)
+		}
+		if actions[0].Gesture != relay.GestureHold || !reflect.DeepEqual(actions[0].Relays(), []uint8{0, 1}) {
+			t.Errorf("Expected holding to toggle relays 0 and 1, got %+v", actions[0])
+		}
+
+		// Published in the same form
+		var expected mqtt.Command
+		if err := json.Unmarshal([]byte(payload), &expected); err != nil {
+			t.Fatal(err)
+		}
+		cfg := status(t)
+		if *cfg.HapticDuration != 40 || cfg.BacklightOn != "#ff0000" {
+			t.Errorf("Expected the config to be published, got %+v", cfg)
+		}
+		if !reflect.DeepEqual(cfg.Buttons[1], expected.Buttons.Buttons[1]) {
+			t.Errorf("Expected %+v, got %+v", expected.Buttons.Buttons[1], cfg.Buttons[1])
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			device  *emulator.Device
+			payload string
+		}{
+			{"Bulb", bulb, `{"buttons": {"haptic_duration": 40}}`},
+			{"Haptics", sw, `{"buttons": {"haptic_duration": "2m"}}`},
+			{"Backlight", sw, `{"buttons": {"backlight_off": "dark"}}`},
+			{"Gesture", sw, `{"buttons": {"buttons": [{"actions": [{"gesture": "tap", "target": "relays", "relays": [0]}]}]}}`},
+			{"NoRelays", sw, `{"buttons": {"buttons": [{"actions": [{"gesture": "press", "target": "relays"}]}]}}`},
+			{"Device", sw, `{"buttons": {"buttons": [{"actions": [{"gesture": "press", "target": "device", "device": "kitchen"}]}]}}`},
+			{"UUID", sw, `{"buttons": {"buttons": [{"actions": [{"gesture": "press", "target": "scene", "id": "1234"}]}]}}`},
+			{"Button", sw, `{"buttons": {"buttons": [null, null, null, null, {"actions": []}]}}`},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if err := command(t, tt.device, tt.payload); !errors.Is(err, lifx.ErrInvalidButtons) {
+					t.Errorf("Expected ErrInvalidButtons, got %v", err)
+				}
+			})
+		}
+	})
+}
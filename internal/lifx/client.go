@@ -2,30 +2,88 @@ package lifx
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
 	"net"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	lifxlight "github.com/denwilliams/go-lifx-mqtt/internal/lifx/light"
+	lifxtile "github.com/denwilliams/go-lifx-mqtt/internal/lifx/tile"
 	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
 	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
-	"github.com/icza/gox/imagex/colorx"
+	"github.com/denwilliams/go-lifx-mqtt/internal/solar"
+	"github.com/denwilliams/go-lifx-mqtt/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.yhsif.com/lifxlan"
 )
 
+const groupPrefix = "group/"
+
+// ErrNotFound is returned when a command targets an unknown device or group.
+var ErrNotFound = errors.New("not found")
+
 var (
 	defaultDuration uint32 = 1500
+	pollTimeout            = 2 * time.Second
+	infoInterval           = 6 * time.Hour
 )
 
 func NewClient(emitter StatusEmitter) *LIFXClient {
-	lights := make(deviceMap)
-	return &LIFXClient{devices: lights, emitter: emitter}
+	return &LIFXClient{devices: newDeviceMap(), emitter: emitter}
 }
 
 type LIFXClient struct {
-	devices     deviceMap
-	discovering bool
+	devices     *deviceMap
+	discovering atomic.Bool
 	emitter     StatusEmitter
+	// broadcastAddr overrides where discovery messages are sent
+	broadcastAddr string
+	// listenAddr overrides where state messages are listened for
+	listenAddr string
+	// portMu guards the LIFX port, shared by discovery and ListenForState
+	portMu sync.Mutex
+	// fadeMu guards fades, the fade running on each device
+	fadeMu sync.Mutex
+	fades  map[string]*fade
+	// adaptiveMu guards adaptive, the settings of each adaptive light, and
+	// coordinates
+	adaptiveMu  sync.Mutex
+	adaptive    map[string]mqtt.Adaptive
+	coordinates *solar.Coordinates
+	// effectMu guards effects, the effect running on each device, and
+	// effectFPS
+	effectMu  sync.Mutex
+	effects   map[string]*runningEffect
+	effectFPS float64
+	// transitionMu guards transitions
+	transitionMu sync.RWMutex
+	transitions  TransitionConfig
+	// relayNamesMu guards relayNames
+	relayNamesMu sync.Mutex
+	relayNames   RelayNames
+	// statusMu guards lastDiscovery
+	statusMu      sync.Mutex
+	lastDiscovery time.Time
+	// metricsMu guards products, the products in the device count gauges
+	metricsMu sync.Mutex
+	products  map[string]bool
+}
+
+// SetBroadcastAddr sends discovery messages to addr (host:port) instead of
+// the default broadcast address, eg: a directed broadcast like
+// 192.168.1.255:56700, or an emulated network.
+func (lc *LIFXClient) SetBroadcastAddr(addr string) {
+	lc.broadcastAddr = addr
+}
+
+// SetListenAddr listens for state messages on addr (host:port) instead of
+// the LIFX port, eg: to test ListenForState without the real port.
+func (lc *LIFXClient) SetListenAddr(addr string) {
+	lc.listenAddr = addr
 }
 
 func (lc *LIFXClient) AddDevice(ip string, mac string) error {
@@ -34,11 +92,16 @@ func (lc *LIFXClient) AddDevice(ip string, mac string) error {
 	if err != nil {
 		return err
 	}
-	logging.Debug("Adding device %s %s %s", key, ip, t)
+	logging.With("device", key, "ip", ip, "target", t).Debug("Adding device")
 	addr := net.JoinHostPort(ip, lifxlan.DefaultBroadcastPort)
-	d := lifxlan.NewDevice(addr, lifxlan.ServiceUDP, t)
+	return lc.Add(lifxlan.NewDevice(addr, lifxlan.ServiceUDP, t))
+}
 
-	l := newDevice(key, d)
+// Add loads and registers a device that was found some other way than
+// discovery, eg: at a known address.
+func (lc *LIFXClient) Add(d lifxlan.Device) error {
+	key := strings.Replace(d.Target().String(), ":", "", -1)
+	l := lc.newDevice(key, d)
 	lc.devices.Set(key, l)
 	return l.Load()
 }
@@ -51,23 +114,27 @@ func (lc *LIFXClient) Discover() {
 func (lc *LIFXClient) DiscoverWithTimeout(timeout time.Duration) int {
 	numDiscovered := 0
 
-	if lc.discovering {
+	if !lc.discovering.CompareAndSwap(false, true) {
 		logging.Warn("Aborted - already discovering")
+		discoveryRuns.WithLabelValues("aborted").Inc()
 		return 0
 	}
 
-	lc.discovering = true
+	lc.portMu.Lock()
+	defer lc.portMu.Unlock()
 
+	start := time.Now()
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
 	deviceChan := make(chan lifxlan.Device)
+	errChan := make(chan error, 1)
 
 	go func() {
-		if err := lifxlan.Discover(ctx, deviceChan, ""); err != nil {
-			if err != nil && err != context.Canceled && err != context.DeadlineExceeded {
-				log.Fatalf("Discover failed: %v", err)
-			}
+		if lc.broadcastAddr != "" {
+			errChan <- discoverAt(ctx, deviceChan, lc.broadcastAddr)
+		} else {
+			errChan <- lifxlan.Discover(ctx, deviceChan, "")
 		}
 	}()
 
@@ -79,114 +146,322 @@ func (lc *LIFXClient) DiscoverWithTimeout(timeout time.Duration) int {
 			continue
 		}
 
-		ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
+		labelCtx, labelCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := device.GetLabel(labelCtx, nil)
+		labelCancel()
 
-		if err := device.GetLabel(ctx, nil); err != nil {
-			logging.Warn("Couldn't get label for device=%s err=%s", t, err.Error())
+		if err != nil {
+			logging.With("device", key).Warn("Couldn't get label %s", err)
 			continue
 		}
 
-		l := newDevice(key, device)
+		l := lc.newDevice(key, device)
 		lc.devices.Set(key, l)
 		numDiscovered++
-		logging.Info("Found device label=\"%s\" target=%s", device.Label(), t)
+		logging.With("device", key, "label", device.Label().String(), "target", t).Info("Found device")
+	}
+
+	result := "ok"
+	if err := <-errChan; err != nil && err != context.Canceled && err != context.DeadlineExceeded {
+		logging.Error("Discover failed: %v", err)
+		result = "error"
 	}
+	discoveryRuns.WithLabelValues(result).Inc()
+	discoveryDuration.Observe(time.Since(start).Seconds())
+	discoveryFound.Add(float64(numDiscovered))
+
+	lc.statusMu.Lock()
+	lc.lastDiscovery = time.Now()
+	lc.statusMu.Unlock()
 
-	logging.Debug("Total lights discovered: %d", len(lc.devices))
-	lc.discovering = false
+	logging.With("total", lc.devices.Len()).Debug("Discovery finished")
+	lc.discovering.Store(false)
 
 	return numDiscovered
 }
 
 func (lc *LIFXClient) LoadDevices() {
-	for _, l := range lc.devices {
-		if !l.loaded {
+	for _, l := range lc.devices.All() {
+		if !l.loaded.Load() {
 			go l.Load()
 		}
 	}
 }
 
+// LoadDevicesAndWait loads every device that isn't loaded yet, returning
+// once they have all been tried.
+func (lc *LIFXClient) LoadDevicesAndWait() {
+	var wg sync.WaitGroup
+	for _, l := range lc.devices.All() {
+		if l.loaded.Load() {
+			continue
+		}
+		wg.Add(1)
+		go func(l *lifxdevice) {
+			defer wg.Done()
+			l.Load()
+		}(l)
+	}
+	wg.Wait()
+}
+
+// Refresh queries the current state of a device, emitting status for
+// anything that changed.
+func (lc *LIFXClient) Refresh(ctx context.Context, id string) error {
+	l := lc.devices.Get(id)
+	if l == nil {
+		return fmt.Errorf("%w: device %s", ErrNotFound, id)
+	}
+	return l.recordError(l.Refresh(ctx, lc.emitter))
+}
+
 func (lc *LIFXClient) RefreshDevices() {
-	for _, l := range lc.devices {
-		l.QueueRefresh(lc.emitter, 0)
+	for _, l := range lc.devices.All() {
+		l.QueueRefresh(context.Background(), lc.emitter, 0)
 	}
+	lc.updateDeviceMetrics()
 }
 
-func (lc *LIFXClient) TurnOn(id string, duration uint32) error {
+// RefreshInfo publishes the info of any loaded device that has no info yet,
+// or whose info is older than infoInterval.
+func (lc *LIFXClient) RefreshInfo() {
+	for _, l := range lc.devices.All() {
+		s := l.State()
+		if !s.Loaded {
+			continue
+		}
+		if s.Info != nil && time.Since(s.Info.UpdatedAt) < infoInterval {
+			continue
+		}
+		go l.UpdateInfo(lc.emitter)
+	}
+}
+
+// PollDevices does a quick poll of every loaded device to pick up changes
+// made outside of the bridge.
+func (lc *LIFXClient) PollDevices() {
+	for _, l := range lc.devices.All() {
+		if l.loaded.Load() {
+			go l.Poll(lc.emitter, pollTimeout)
+		}
+	}
+}
+
+func (lc *LIFXClient) TurnOn(ctx context.Context, id string, duration uint32) error {
 	l := lc.devices.Get(id)
 	if l == nil {
-		logging.Warn("No light found for id=%s", id)
+		logging.With("device", id).Warn("No light found")
 		return nil
 	}
 
 	devicesControlled.WithLabelValues("light", "on").Inc()
-	return l.TurnOn(lc.emitter, duration)
+	return lc.run(ctx, l, "TurnOn", func(ctx context.Context) error {
+		return l.TurnOn(ctx, lc.emitter, duration)
+	})
 }
 
-func (lc *LIFXClient) TurnOff(id string, duration uint32) error {
+func (lc *LIFXClient) TurnOff(ctx context.Context, id string, duration uint32) error {
 	l := lc.devices.Get(id)
 	if l == nil {
-		logging.Warn("No light found for id=%s", id)
+		logging.With("device", id).Warn("No light found")
 		return nil
 	}
 
 	devicesControlled.WithLabelValues("light", "off").Inc()
-	return l.TurnOff(lc.emitter, duration)
+	return lc.run(ctx, l, "TurnOff", func(ctx context.Context) error {
+		return l.TurnOff(ctx, lc.emitter, duration)
+	})
 }
 
-func (lc *LIFXClient) SetWhite(id string, brightness uint16, kelvin uint16, duration uint32) error {
+func (lc *LIFXClient) SetWhite(ctx context.Context, id string, brightness uint16, kelvin uint16, duration uint32) error {
 	l := lc.devices.Get(id)
 	if l == nil {
-		logging.Warn("No light found for id=%s", id)
+		logging.With("device", id).Warn("No light found")
 		return nil
 	}
 
 	devicesControlled.WithLabelValues("light", "on").Inc()
-	return l.SetWhite(lc.emitter, brightness, kelvin, duration)
+	return lc.run(ctx, l, "SetWhite", func(ctx context.Context) error {
+		return l.SetWhite(ctx, lc.emitter, brightness, kelvin, duration)
+	})
 }
 
-func (lc *LIFXClient) SetColor(id string, hsbk *lifxlan.Color, duration uint32) error {
+func (lc *LIFXClient) SetColor(ctx context.Context, id string, hsbk *lifxlan.Color, duration uint32) error {
 	l := lc.devices.Get(id)
 	if l == nil {
-		logging.Warn("No light found for id=%s", id)
+		logging.With("device", id).Warn("No light found")
 		return nil
 	}
 
 	devicesControlled.WithLabelValues("light", "on").Inc()
-	return l.SetColor(lc.emitter, hsbk, duration)
+	return lc.run(ctx, l, "SetColor", func(ctx context.Context) error {
+		return l.SetColor(ctx, lc.emitter, hsbk, duration)
+	})
 }
 
-func (lc *LIFXClient) SetRelay(id string, index uint8, power bool) error {
+func (lc *LIFXClient) SetWaveform(ctx context.Context, id string, args *lifxlight.SetWaveformArgs) error {
 	l := lc.devices.Get(id)
 	if l == nil {
-		logging.Warn("No device found for id=%s", id)
+		logging.With("device", id).Warn("No light found")
+		return nil
+	}
+
+	devicesControlled.WithLabelValues("light", "on").Inc()
+	return lc.run(ctx, l, "SetWaveform", func(ctx context.Context) error {
+		return l.SetWaveform(ctx, lc.emitter, args)
+	})
+}
+
+func (lc *LIFXClient) SetBoard(ctx context.Context, id string, cb lifxtile.ColorBoard, duration uint32) error {
+	l := lc.devices.Get(id)
+	if l == nil {
+		logging.With("device", id).Warn("No tile device found")
+		return nil
+	}
+
+	devicesControlled.WithLabelValues("tile", "on").Inc()
+	return lc.run(ctx, l, "SetBoard", func(ctx context.Context) error {
+		return l.SetBoard(ctx, lc.emitter, cb, duration)
+	})
+}
+
+func (lc *LIFXClient) SetRelay(ctx context.Context, id string, index uint8, power bool) error {
+	l := lc.devices.Get(id)
+	if l == nil {
+		logging.With("device", id).Warn("No device found")
 		return nil
 	}
 
 	devicesControlled.WithLabelValues("relay", getPowerLabel(power)).Inc()
-	return l.SetRelay(lc.emitter, index, power)
+	return lc.run(ctx, l, "SetRelay", func(ctx context.Context) error {
+		return l.SetRelay(ctx, lc.emitter, index, power)
+	})
 }
 
-func (lc *LIFXClient) HandleCommand(id string, command *mqtt.Command) error {
+func (lc *LIFXClient) HandleCommand(ctx context.Context, id string, command *mqtt.Command) (err error) {
+	ctx, span := tracing.Start(ctx, "lifx.HandleCommand", trace.WithAttributes(attribute.String("lifx.device.id", id)))
+	defer func() { tracing.End(span, err) }()
+
 	if id == "discover" {
 		go lc.Discover()
 		return nil
 	}
 
+	if strings.HasPrefix(id, groupPrefix) {
+		return lc.handleGroupCommand(ctx, strings.TrimPrefix(id, groupPrefix), command)
+	}
+
 	if command == nil {
 		return nil
 	}
 
-	dur := defaultDuration
+	logger := logging.With("device", id)
+
+	// A new command takes over from any fade or effect. New effects and
+	// animations replace a running effect themselves, so the light isn't put
+	// back in between.
+	if lc.StopFade(id) {
+		logger.Info("Stopped fade")
+	}
+	if !replacesEffect(command) && lc.StopEffect(id) {
+		logger.Info("Stopped effect")
+	}
+	if (command.Effect == nil || !isFirmwareEffect(command.Effect.Name)) && lc.StopFirmwareEffect(ctx, id) {
+		logger.Info("Stopped device effect")
+	}
+
+	if command.Adaptive != nil {
+		if err := lc.handleAdaptive(ctx, id, command); err != nil {
+			logger.Warn("Error setting adaptive %s", err)
+			return err
+		}
+		if onlyAdaptive(command) {
+			return nil
+		}
+	} else if settings, ok := lc.adaptiveSettings(id); ok && overridesAdaptive(command, settings) {
+		// A manual color takes over from adaptive
+		lc.StopAdaptive(ctx, id)
+	}
+
+	if command.Effect != nil && isFirmwareEffect(command.Effect.Name) {
+		logger.With("effect", command.Effect.Name).Info("Start device effect")
+		return lc.StartFirmwareEffect(ctx, id, command.Effect)
+	}
+	if command.Effect != nil {
+		effect, err := parseEffect(command.Effect)
+		if err != nil {
+			logger.Warn("Error parsing effect %s", err)
+			return err
+		}
+		if effect == nil {
+			if lc.StopEffect(id) {
+				logger.Info("Stopped effect")
+			}
+			return nil
+		}
+		logger.With("effect", command.Effect.Name).Info("Start effect")
+		return lc.StartEffect(ctx, id, *effect, command.Effect.FPS)
+	}
+
+	if command.Fade != nil {
+		curve, err := parseFade(command.Fade)
+		if err != nil {
+			logger.Warn("Error parsing fade %s", err)
+			return err
+		}
+		duration := defaultFadeDuration
+		if command.Duration != nil {
+			duration = command.Duration.Duration()
+		}
+		return lc.StartFade(id, curve, duration)
+	}
+
+	var dur uint32
 	if command.Duration != nil {
-		dur = *command.Duration
+		dur = uint32(*command.Duration)
+	} else {
+		dur = lc.transition(id, transitionKindOf(command))
+	}
+
+	if command.Power != nil && !*command.Power {
+		logger.Info("Set power off")
+		return lc.TurnOff(ctx, id, dur)
+	}
+	if command.Power != nil && command.Brightness == nil && command.Temperature == nil && command.Color == nil && command.Board == nil && command.Image == nil && command.Text == nil {
+		if kelvin, brightness, ok := lc.adaptiveWhite(id); ok {
+			logger.With("kelvin", kelvin, "brightness", brightness).Info("Set power on adaptive")
+			return lc.SetWhite(ctx, id, brightness, kelvin, dur)
+		}
+		// Turn on without changing the color
+		logger.Info("Set power on")
+		return lc.TurnOn(ctx, id, dur)
+	}
+
+	if command.Board != nil {
+		cb, err := parseBoard(command.Board)
+		if err != nil {
+			logger.Warn("Error parsing board %s", err)
+			return err
+		}
+		logger.With("width", len(cb), "height", len(command.Board)).Info("Set board")
+		return lc.SetBoard(ctx, id, cb, dur)
+	}
+
+	if command.Image != nil {
+		logger.With("bytes", len(command.Image.Data)).Info("Show image")
+		return lc.ShowImage(ctx, id, command.Image, dur)
+	}
+
+	if command.Text != nil {
+		logger.With("text", command.Text.Text).Info("Show text")
+		return lc.ShowText(ctx, id, command.Text, dur)
 	}
 
 	brightness := uint16(0)
 	if command.Brightness != nil {
 		brightness = *command.Brightness
 		if brightness == 0 {
-			return lc.TurnOff(id, dur)
+			return lc.TurnOff(ctx, id, dur)
 		}
 	}
 	temperature := uint16(0)
@@ -195,47 +470,87 @@ func (lc *LIFXClient) HandleCommand(id string, command *mqtt.Command) error {
 	}
 
 	if temperature > 0 {
-		logging.Info("Set light %s %dK %d%%", id, temperature, brightness)
-		lc.SetWhite(id, brightness, temperature, dur)
-		return nil
+		logger.With("kelvin", temperature, "brightness", brightness).Info("Set light")
+		return lc.SetWhite(ctx, id, brightness, temperature, dur)
 	} else if brightness > 0 {
-		logging.Info("Set light %s %dK %d%%", id, temperature, brightness)
-		lc.SetWhite(id, brightness, temperature, dur)
-		return nil
+		if kelvin, _, ok := lc.adaptiveWhite(id); ok {
+			temperature = kelvin
+		}
+		logger.With("kelvin", temperature, "brightness", brightness).Info("Set light")
+		return lc.SetWhite(ctx, id, brightness, temperature, dur)
 	}
 
 	if command.Color != nil {
 		color := *command.Color
 
-		c, err := colorx.ParseHexColor(color)
+		c, err := parseHexColor(color)
 		if err != nil {
-			logging.Warn("Error parsing color %s err=%s", command.Color, err)
-			return nil
+			logger.With("color", color).Warn("Error parsing color %s", err)
+			return err
 		}
 
 		hsbk := lifxlan.FromColor(c, temperature)
-		logging.Info("Set light %s color %v", id, *hsbk)
-		return lc.SetColor(id, hsbk, dur)
+		logger.With("color", *hsbk).Info("Set light")
+		return lc.SetColor(ctx, id, hsbk, dur)
+	}
+
+	var errs []error
+	if command.Buttons != nil {
+		logger.Info("Set buttons")
+		errs = append(errs, lc.SetButtonConfig(ctx, id, command.Buttons))
 	}
+	if len(command.Relays) > 0 {
+		errs = append(errs, lc.SetRelays(ctx, id, command.Relays))
+	}
+
+	return errors.Join(errs...)
+}
 
-	if command.Relay0 != nil {
-		logging.Info("Set relay0 %s %v", id, *command.Relay0)
-		lc.SetRelay(id, 0, *command.Relay0)
+// handleGroupCommand applies the command to every device in the group at the
+// same time.
+func (lc *LIFXClient) handleGroupCommand(ctx context.Context, name string, command *mqtt.Command) error {
+	var ids []string
+	for _, l := range lc.devices.All() {
+		if l.inGroup(name) {
+			ids = append(ids, l.id)
+		}
 	}
-	if command.Relay1 != nil {
-		logging.Info("Set relay1 %s %v", id, *command.Relay1)
-		lc.SetRelay(id, 1, *command.Relay1)
+	if len(ids) == 0 {
+		logging.With("group", name).Warn("No devices found")
+		return fmt.Errorf("%w: group %s", ErrNotFound, name)
 	}
-	if command.Relay2 != nil {
-		logging.Info("Set relay2 %s %v", id, *command.Relay2)
-		lc.SetRelay(id, 2, *command.Relay2)
+
+	logging.With("group", name, "devices", ids).Info("Set group")
+	errs := make([]error, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			errs[i] = lc.HandleCommand(ctx, id, command)
+		}(i, id)
 	}
-	if command.Relay3 != nil {
-		logging.Info("Set relay3 %s %v", id, *command.Relay3)
-		lc.SetRelay(id, 3, *command.Relay3)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// run runs a command against a device, recording metrics and the device's
+// last error.
+func (lc *LIFXClient) run(ctx context.Context, l *lifxdevice, command string, fn func(ctx context.Context) error) error {
+	ctx, span := l.startSpan(ctx, command)
+	start := time.Now()
+	err := fn(ctx)
+	if isTimeout(err) {
+		lifxTimeouts.WithLabelValues(l.id).Inc()
 	}
+	commandDuration.WithLabelValues(command).Observe(time.Since(start).Seconds())
+	tracing.End(span, err)
+	return l.recordError(err)
+}
 
-	return nil
+func isTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded)
 }
 
 func getPower(power bool) lifxlan.Power {
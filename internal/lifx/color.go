@@ -1,8 +1,13 @@
 package lifx
 
 import (
+	"errors"
+	"fmt"
+	"image/color"
 	"math"
 
+	lifxtile "github.com/denwilliams/go-lifx-mqtt/internal/lifx/tile"
+	"github.com/icza/gox/imagex/colorx"
 	"go.yhsif.com/lifxlan"
 )
 
@@ -40,6 +45,32 @@ func toColorPayload(color *lifxlan.Color) *colorPayload {
 	}
 }
 
+// toHexColor converts a color to hex like #ff0000, ignoring kelvin.
+func toHexColor(c lifxlan.Color) string {
+	h := float64(c.Hue) / 0x10000 * 6
+	s := float64(c.Saturation) / math.MaxUint16
+	v := float64(c.Brightness) / math.MaxUint16
+
+	f := h - math.Floor(h)
+	p, q, t := v*(1-s), v*(1-s*f), v*(1-s*(1-f))
+	var r, g, b float64
+	switch int(h) % 6 {
+	case 0:
+		r, g, b = v, t, p
+	case 1:
+		r, g, b = q, v, p
+	case 2:
+		r, g, b = p, v, t
+	case 3:
+		r, g, b = p, q, v
+	case 4:
+		r, g, b = t, p, v
+	default:
+		r, g, b = v, p, q
+	}
+	return fmt.Sprintf("#%02x%02x%02x", uint8(math.Round(r*255)), uint8(math.Round(g*255)), uint8(math.Round(b*255)))
+}
+
 func uint16to8(value uint16) uint8 {
 	return uint8(value >> 8)
 }
@@ -47,3 +78,42 @@ func uint16to8(value uint16) uint8 {
 func uint16toPercent(value uint16) uint8 {
 	return uint8(math.Round(float64(value) / math.MaxUint16 * 100))
 }
+
+// errEmptyColor is returned instead of letting colorx panic on "".
+var errEmptyColor = errors.New("empty color")
+
+// parseHexColor parses a color like #ff0000.
+func parseHexColor(s string) (color.RGBA, error) {
+	if s == "" {
+		return color.RGBA{}, errEmptyColor
+	}
+	return colorx.ParseHexColor(s)
+}
+
+// parseBoard converts rows of hex colors, top row first, into a ColorBoard.
+// Empty strings leave the pixel off.
+func parseBoard(rows [][]string) (lifxtile.ColorBoard, error) {
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+
+	height := len(rows)
+	cb := lifxtile.MakeColorBoard(width, height)
+	for r, row := range rows {
+		for x, hex := range row {
+			if hex == "" {
+				continue
+			}
+			c, err := parseHexColor(hex)
+			if err != nil {
+				return nil, err
+			}
+			// The board's origin is the bottom left corner
+			cb[x][height-1-r] = lifxlan.FromColor(c, 0)
+		}
+	}
+	return cb, nil
+}
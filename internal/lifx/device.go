@@ -3,32 +3,82 @@ package lifx
 import (
 	"context"
 	"log"
+	"net"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	lifxlight "github.com/denwilliams/go-lifx-mqtt/internal/lifx/light"
+	lifxmultizone "github.com/denwilliams/go-lifx-mqtt/internal/lifx/multizone"
 	lifxrelay "github.com/denwilliams/go-lifx-mqtt/internal/lifx/relay"
+	lifxtile "github.com/denwilliams/go-lifx-mqtt/internal/lifx/tile"
 	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"github.com/denwilliams/go-lifx-mqtt/internal/tracing"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.yhsif.com/lifxlan"
 )
 
 func newDevice(id string, device lifxlan.Device) *lifxdevice {
-	return &lifxdevice{id: id, device: device}
+	l := &lifxdevice{id: id, device: device}
+	if device != nil {
+		l.label = device.Label().String()
+	}
+	return l
 }
 
 type lifxdevice struct {
-	id         string
-	loaded     bool
-	device     lifxlan.Device
-	light      lifxlight.Device
-	relay      lifxrelay.Device
-	product    *lifxlan.Product
-	power      lifxlan.Power
-	color      *lifxlan.Color
-	relayPower [4]lifxlan.Power
-	mu         sync.Mutex
-	timer      *time.Timer
+	id string
+	// label is a copy of the device's label, which is only safe to read
+	// while holding mu
+	label     string
+	loaded    atomic.Bool
+	lifxType  LIFXType
+	device    lifxlan.Device
+	light     lifxlight.Device
+	relay     lifxrelay.Device
+	tile      lifxtile.Device
+	multizone lifxmultizone.Device
+	product   *lifxlan.Product
+	addr      string
+	power     lifxlan.Power
+	color     *lifxlan.Color
+	// relayPower has an entry for each relay of a switch, and relayNames
+	// their names, if configured
+	relayPower []lifxlan.Power
+	relayNames []string
+	// effect is the effect the device is running itself, for tile and
+	// multizone devices
+	effect *mqtt.Effect
+	// board is what matrix devices were last seen showing
+	board *boardPayload
+	// buttons is the button configuration of switches
+	buttons *mqtt.ButtonConfig
+	// toggled are the relays changed outside of the bridge since toggleTimer
+	// was started
+	toggled     []int
+	toggleTimer *time.Timer
+	// commanded are when the bridge last set each relay
+	commanded   map[uint8]time.Time
+	mu          sync.Mutex
+	timer       *time.Timer
+	pollConn    net.Conn
+	info        *infoPayload
+	lastSeen    time.Time
+	lastRefresh time.Time
+	lastError   *deviceError
+	// stateMu guards the cached state so it can be read without waiting on mu
+	stateMu sync.RWMutex
+	// timerMu guards timer so a refresh can be queued while holding mu
+	timerMu sync.Mutex
+	// toggleMu guards toggled, toggleTimer and commanded
+	toggleMu sync.Mutex
+}
+
+// logger returns a logger that tags messages with the device id.
+func (l *lifxdevice) logger() *logging.Logger {
+	return logging.With("device", l.id)
 }
 
 func (l *lifxdevice) Load() error {
@@ -39,7 +89,7 @@ func (l *lifxdevice) Load() error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	logging.Debug("Loading %s", l.id)
+	l.logger().Debug("Loading")
 
 	timeout := 30 * time.Second
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
@@ -58,101 +108,230 @@ func (l *lifxdevice) Load() error {
 		log.Fatal(ctx.Err())
 	}
 	if err := d.GetHardwareVersion(ctx, conn); err != nil {
-		logging.Warn("Failed to get hardware version %s", l.id)
+		l.logger().Warn("Failed to get hardware version %s", err)
 		return err
 	}
 
-	logging.Debug("Loaded %s type=%d", l.id, (d.HardwareVersion().ProductID))
+	l.logger().With("product_id", d.HardwareVersion().ProductID).Debug("Loaded")
 
 	lifxType, product := getType(d.HardwareVersion())
+
+	l.stateMu.Lock()
 	l.product = product
+	l.lifxType = lifxType
+	l.addr = conn.RemoteAddr().String()
+	l.stateMu.Unlock()
+
+	// Wrapping tiles and counting relays talk to the device, so are done
+	// before taking stateMu to keep the cached state readable
+	var (
+		td     lifxtile.Device
+		ld     lifxlight.Device
+		md     lifxmultizone.Device
+		rd     lifxrelay.Device
+		relays int
+	)
+	switch lifxType {
+	case Matrix:
+		l.logger().Debug("Wrapping tile")
+
+		td, err = lifxtile.Wrap(ctx, l.device, false)
+		if err != nil {
+			l.logger().Warn("Failed to get device chain %s", err)
+			return err
+		}
+		ld = lifxlight.Wrap(l.device)
 
-	if lifxType == Light {
-		logging.Debug("Wrapping %s light", l.id)
+	case Light:
+		l.logger().Debug("Wrapping light")
 
-		l.light = lifxlight.Wrap(l.device)
-		l.loaded = true
-		return nil
-	}
+		ld = lifxlight.Wrap(l.device)
+		if product.Features.Multizone.Get() {
+			l.logger().Debug("Wrapping multizone")
+			md = lifxmultizone.Wrap(ld)
+		}
 
-	if lifxType == Switch {
-		logging.Debug("Wrapping %s relay", l.id)
+	case Switch:
+		l.logger().Debug("Wrapping relay")
 
-		l.relay = lifxrelay.Wrap(l.device)
-		l.loaded = true
-		return nil
+		rd = lifxrelay.Wrap(l.device)
+		relays = l.countRelays(ctx, conn, rd, product)
+
+	default:
+		l.logger().With("type", int(lifxType)).Warn("Ignoring wrapping device")
 	}
 
-	logging.Warn("Ignoring wrapping device %s type=%d", l.id, lifxType)
-	l.loaded = true
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	l.tile = td
+	l.light = ld
+	l.multizone = md
+	l.relay = rd
+	if rd != nil {
+		l.relayPower = make([]lifxlan.Power, relays)
+	}
+	l.loaded.Store(true)
 	return nil
 }
 
-func (l *lifxdevice) Refresh(emitter StatusEmitter) error {
-	l.mu.Lock()
+func (l *lifxdevice) Refresh(ctx context.Context, emitter StatusEmitter) error {
+	ctx, span := l.startSpan(ctx, "Refresh")
+	defer span.End()
+
+	l.lock(ctx)
 	defer l.mu.Unlock()
 
-	logging.Info("Refreshing %s", l.id)
+	l.logger().Info("Refreshing")
+	defer prometheus.NewTimer(refreshDuration).ObserveDuration()
 
 	timeout := 15 * time.Second
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	conn, err := l.device.Dial()
+	conn, err := l.dial(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer conn.Close()
 
 	if ctx.Err() != nil {
-		// shouldn't be fatal
-		log.Fatal(ctx.Err())
+		return ctx.Err()
 	}
 
-	power, errP := l.device.GetPower(ctx, conn)
+	var power lifxlan.Power
+	errP := l.request(ctx, "GetPower", func(ctx context.Context) (err error) {
+		power, err = l.device.GetPower(ctx, conn)
+		return err
+	})
 	if errP != nil {
-		logging.Warn("Failed to get power %s %s", l.id, errP.Error())
+		l.logger().Warn("Failed to get power %s", errP)
 		return errP
 	}
-	if l.power != power {
-		l.power = power
-		logging.Debug("Refreshed %s power=%v", l.id, power)
-		emitter.EmitStatus(ctx, l.id, "power", toPowerPayload(power))
-	}
+	l.setPower(ctx, emitter, power)
 
 	if l.light != nil {
-		color, errC := l.light.GetColor(ctx, conn)
+		var color *lifxlan.Color
+		errC := l.request(ctx, "GetColor", func(ctx context.Context) (err error) {
+			color, err = l.light.GetColor(ctx, conn)
+			return err
+		})
 		if errC != nil {
-			logging.Warn("Failed to get color %s %s", l.id, errC.Error())
+			l.logger().Warn("Failed to get color %s", errC)
 			return errC
 		}
-		if !isSameColor(l.color, color) {
-			l.color = color
-			logging.Debug("Refreshed %s color=%v", l.id, *color)
-			emitter.EmitStatus(ctx, l.id, "color", toColorPayload(color))
+		l.setColor(ctx, emitter, color)
+	}
+
+	if l.tile != nil || l.multizone != nil {
+		var effect *mqtt.Effect
+		errE := l.request(ctx, "GetEffect", func(ctx context.Context) (err error) {
+			effect, err = l.getEffect(ctx, conn)
+			return err
+		})
+		if errE != nil {
+			l.logger().Warn("Failed to get effect %s", errE)
+		} else {
+			l.setEffect(ctx, emitter, effect)
+		}
+	}
+
+	if l.tile != nil {
+		var board *boardPayload
+		errB := l.request(ctx, "GetColors", func(ctx context.Context) (err error) {
+			board, err = l.getBoard(ctx, conn)
+			return err
+		})
+		if errB != nil {
+			l.logger().Warn("Failed to get board %s", errB)
+		} else {
+			l.setBoard(ctx, emitter, board)
 		}
 	}
 
 	if l.relay != nil {
-		for i := uint8(0); i < 4; i++ {
-			power, errR := l.relay.GetRPower(ctx, conn, i)
+		for i := uint8(0); int(i) < len(l.relayPower); i++ {
+			var power lifxlan.Power
+			errR := l.request(ctx, "GetRPower", func(ctx context.Context) (err error) {
+				power, err = l.relay.GetRPower(ctx, conn, i)
+				return err
+			})
 			if errR != nil {
-				logging.Warn("Failed to get relay %s %s", l.id, errR.Error())
-			}
-			if l.relayPower[i] != power {
-				l.relayPower[i] = power
-				emitter.EmitStatus(ctx, l.id, "relay"+strconv.Itoa(int(i)), toPowerPayload(power))
+				// Leave the cached power alone, rather than publish it off
+				l.logger().Warn("Failed to get relay %s", errR)
+				continue
 			}
+			l.setRelayPower(ctx, emitter, i, power)
 		}
-		logging.Debug("Refreshed %s relayPower=%v", l.id, l.relayPower)
+		l.logger().With("relay_power", l.relayPower).Debug("Refreshed")
 	}
 
+	l.stateMu.Lock()
+	l.lastRefresh = time.Now()
+	l.stateMu.Unlock()
+
 	return nil
 }
 
-func (l *lifxdevice) QueueRefresh(emitter StatusEmitter, duration time.Duration) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+// setPower updates the cached power, emitting a status if it changed.
+// The caller must hold l.mu.
+func (l *lifxdevice) setPower(ctx context.Context, emitter StatusEmitter, power lifxlan.Power) {
+	l.stateMu.Lock()
+	l.lastSeen = time.Now()
+	changed := l.power != power
+	l.power = power
+	l.stateMu.Unlock()
+	devicePower.WithLabelValues(l.id).Set(powerMetric(power.On()))
+
+	if !changed {
+		return
+	}
+	l.logger().With("power", power.On()).Debug("Refreshed")
+	emitter.EmitStatus(ctx, l.id, "power", toPowerPayload(power))
+}
+
+// setLabel updates the cached label. The caller must hold l.mu.
+func (l *lifxdevice) setLabel(label string) {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	l.label = label
+}
+
+// setColor updates the cached color, emitting a status if it changed.
+// The caller must hold l.mu.
+func (l *lifxdevice) setColor(ctx context.Context, emitter StatusEmitter, color *lifxlan.Color) {
+	if isSameColor(l.color, color) {
+		return
+	}
+	l.stateMu.Lock()
+	l.color = color
+	l.stateMu.Unlock()
+	deviceBrightness.WithLabelValues(l.id).Set(float64(uint16toPercent(color.Brightness)))
+	l.logger().With("color", *color).Debug("Refreshed")
+	emitter.EmitStatus(ctx, l.id, "color", toColorPayload(color))
+}
+
+// setRelayPower updates the cached power of the relay at index, emitting a
+// status by index, and by name if it has one, if it changed. The caller must hold l.mu.
+func (l *lifxdevice) setRelayPower(ctx context.Context, emitter StatusEmitter, index uint8, power lifxlan.Power) {
+	if int(index) >= len(l.relayPower) || l.relayPower[index] == power {
+		return
+	}
+	l.stateMu.Lock()
+	l.relayPower[index] = power
+	name := l.relayName(int(index))
+	l.stateMu.Unlock()
+	emitter.EmitStatus(ctx, l.id, "relay"+strconv.Itoa(int(index)), toPowerPayload(power))
+	if name != "" {
+		emitter.EmitStatus(ctx, l.id, "relay_"+name, toPowerPayload(power))
+	}
+}
+
+// QueueRefresh refreshes the device after duration, replacing any refresh
+// already queued. The refresh is traced as part of the span in ctx but is
+// not cancelled with it.
+func (l *lifxdevice) QueueRefresh(ctx context.Context, emitter StatusEmitter, duration time.Duration) {
+	l.timerMu.Lock()
+	defer l.timerMu.Unlock()
 
 	if l.timer != nil {
 		l.timer.Stop()
@@ -160,66 +339,79 @@ func (l *lifxdevice) QueueRefresh(emitter StatusEmitter, duration time.Duration)
 	if duration == 0 {
 		duration = 1 * time.Second
 	}
+	ctx = tracing.Detach(ctx)
 	l.timer = time.AfterFunc(duration, func() {
-		l.Refresh(emitter)
+		if err := l.recordError(l.Refresh(ctx, emitter)); isTimeout(err) {
+			lifxTimeouts.WithLabelValues(l.id).Inc()
+		}
 	})
 }
 
-func (l *lifxdevice) TurnOn(emitter StatusEmitter, duration uint32) error {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	time := time.Duration(duration) * time.Millisecond
-
-	defer l.QueueRefresh(emitter, time)
-
-	if l.light != nil {
-		return l.light.SetLightPower(ctx, nil, lifxlan.PowerOn, time, true)
-	}
+func (l *lifxdevice) TurnOn(ctx context.Context, emitter StatusEmitter, duration uint32) error {
+	return l.setPowerLevel(ctx, emitter, lifxlan.PowerOn, duration)
+}
 
-	return l.device.SetPower(ctx, nil, lifxlan.PowerOn, true)
+func (l *lifxdevice) TurnOff(ctx context.Context, emitter StatusEmitter, duration uint32) error {
+	return l.setPowerLevel(ctx, emitter, lifxlan.PowerOff, duration)
 }
 
-func (l *lifxdevice) TurnOff(emitter StatusEmitter, duration uint32) error {
-	l.mu.Lock()
+func (l *lifxdevice) setPowerLevel(ctx context.Context, emitter StatusEmitter, power lifxlan.Power, duration uint32) error {
+	l.lock(ctx)
 	defer l.mu.Unlock()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	time := time.Duration(duration) * time.Millisecond
 
-	defer l.QueueRefresh(emitter, time)
+	defer l.QueueRefresh(ctx, emitter, time)
+
+	conn, err := l.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
 
 	if l.light != nil {
-		return l.light.SetLightPower(ctx, nil, lifxlan.PowerOff, time, true)
+		return l.request(ctx, "SetLightPower", func(ctx context.Context) error {
+			return l.light.SetLightPower(ctx, conn, power, time, true)
+		})
 	}
 
-	return l.device.SetPower(ctx, nil, lifxlan.PowerOff, true)
+	return l.request(ctx, "SetPower", func(ctx context.Context) error {
+		return l.device.SetPower(ctx, conn, power, true)
+	})
+}
+
+func (l *lifxdevice) SetWhite(ctx context.Context, emitter StatusEmitter, brightness uint16, kelvin uint16, duration uint32) error {
+	return l.setWhite(ctx, emitter, brightness, kelvin, duration, true)
 }
 
-func (l *lifxdevice) SetWhite(emitter StatusEmitter, brightness uint16, kelvin uint16, duration uint32) error {
+// AdjustWhite changes the color temperature and brightness like SetWhite,
+// but without turning the light on.
+func (l *lifxdevice) AdjustWhite(ctx context.Context, emitter StatusEmitter, brightness uint16, kelvin uint16, duration uint32) error {
+	return l.setWhite(ctx, emitter, brightness, kelvin, duration, false)
+}
+
+func (l *lifxdevice) setWhite(ctx context.Context, emitter StatusEmitter, brightness uint16, kelvin uint16, duration uint32, power bool) error {
 	if l.light == nil {
 		return nil
 	}
 
-	l.mu.Lock()
+	l.lock(ctx)
 	defer l.mu.Unlock()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	conn, err := l.light.Dial()
+	conn, err := l.dial(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer conn.Close()
 
 	if ctx.Err() != nil {
-		log.Fatal(ctx.Err())
+		return ctx.Err()
 	}
 
 	b := uint16((float32(0xffff) * (float32(brightness) / 100)))
@@ -238,30 +430,25 @@ func (l *lifxdevice) SetWhite(emitter StatusEmitter, brightness uint16, kelvin u
 		Brightness: b,
 	}
 
-	defer l.QueueRefresh(emitter, time)
-
-	err = l.light.SetColor(ctx, conn, hsbk, time, true)
-	if err != nil {
-		return err
-	}
+	defer l.QueueRefresh(ctx, emitter, time)
 
-	err = l.light.SetPower(ctx, conn, lifxlan.PowerOn, true)
-	if err != nil {
-		return err
+	if !power {
+		return l.request(ctx, "SetColor", func(ctx context.Context) error {
+			return l.light.SetColor(ctx, conn, hsbk, time, true)
+		})
 	}
-
-	return nil
+	return l.setColorAndPower(ctx, conn, hsbk, time)
 }
 
-func (l *lifxdevice) SetColor(emitter StatusEmitter, hsbk *lifxlan.Color, duration uint32) error {
+func (l *lifxdevice) SetColor(ctx context.Context, emitter StatusEmitter, hsbk *lifxlan.Color, duration uint32) error {
 	if l.light == nil {
 		return nil
 	}
 
-	l.mu.Lock()
+	l.lock(ctx)
 	defer l.mu.Unlock()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	// Mutating input - yuk - best find another way
@@ -269,49 +456,123 @@ func (l *lifxdevice) SetColor(emitter StatusEmitter, hsbk *lifxlan.Color, durati
 		hsbk.Kelvin = l.color.Kelvin
 	}
 
-	conn, err := l.light.Dial()
+	conn, err := l.dial(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer conn.Close()
 
 	if ctx.Err() != nil {
-		log.Fatal(ctx.Err())
+		return ctx.Err()
 	}
 
 	time := time.Duration(duration) * time.Millisecond
 
-	defer l.QueueRefresh(emitter, time)
+	defer l.QueueRefresh(ctx, emitter, time)
+
+	return l.setColorAndPower(ctx, conn, hsbk, time)
+}
 
-	err = l.light.SetColor(ctx, conn, hsbk, time, true)
+// setColorAndPower sets the color then turns the light on. The caller must
+// hold l.mu.
+func (l *lifxdevice) setColorAndPower(ctx context.Context, conn net.Conn, hsbk *lifxlan.Color, transition time.Duration) error {
+	err := l.request(ctx, "SetColor", func(ctx context.Context) error {
+		return l.light.SetColor(ctx, conn, hsbk, transition, true)
+	})
 	if err != nil {
 		return err
 	}
 
-	err = l.light.SetPower(ctx, conn, lifxlan.PowerOn, true)
+	return l.request(ctx, "SetPower", func(ctx context.Context) error {
+		return l.light.SetPower(ctx, conn, lifxlan.PowerOn, true)
+	})
+}
+
+// SetWaveform runs a waveform effect, eg: a pulse or breathe, on a light.
+func (l *lifxdevice) SetWaveform(ctx context.Context, emitter StatusEmitter, args *lifxlight.SetWaveformArgs) error {
+	if l.light == nil {
+		return nil
+	}
+
+	l.lock(ctx)
+	defer l.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	conn, err := l.dial(ctx)
 	if err != nil {
 		return err
 	}
+	defer conn.Close()
 
-	return nil
+	defer l.QueueRefresh(ctx, emitter, args.Period*time.Duration(args.Cycles))
+
+	return l.request(ctx, "SetWaveform", func(ctx context.Context) error {
+		return l.light.SetWaveform(ctx, conn, args, true)
+	})
 }
 
-func (l *lifxdevice) SetRelay(emitter StatusEmitter, index uint8, power bool) error {
+func (l *lifxdevice) SetBoard(ctx context.Context, emitter StatusEmitter, cb lifxtile.ColorBoard, duration uint32) error {
+	if l.tile == nil {
+		return nil
+	}
+
+	l.lock(ctx)
+	defer l.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	conn, err := l.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	time := time.Duration(duration) * time.Millisecond
+
+	defer l.QueueRefresh(ctx, emitter, time)
+
+	err = l.request(ctx, "SetColors", func(ctx context.Context) error {
+		return l.tile.SetColors(ctx, conn, cb, time, true)
+	})
+	if err != nil {
+		return err
+	}
+
+	return l.request(ctx, "SetPower", func(ctx context.Context) error {
+		return l.tile.SetPower(ctx, conn, lifxlan.PowerOn, true)
+	})
+}
+
+func (l *lifxdevice) SetRelay(ctx context.Context, emitter StatusEmitter, index uint8, power bool) error {
 	if l.relay == nil {
 		return nil
 	}
 
-	l.mu.Lock()
+	l.lock(ctx)
 	defer l.mu.Unlock()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	defer l.QueueRefresh(emitter, 100*time.Millisecond)
+	defer l.QueueRefresh(ctx, emitter, 100*time.Millisecond)
 
-	if err := l.relay.SetRPower(ctx, nil, index, getPower(power), true); err != nil {
+	conn, err := l.dial(ctx)
+	if err != nil {
 		return err
 	}
+	defer conn.Close()
 
+	l.relayCommanded(index)
+	err = l.request(ctx, "SetRPower", func(ctx context.Context) error {
+		return l.relay.SetRPower(ctx, conn, index, getPower(power), true)
+	})
+	if err != nil {
+		return err
+	}
+	// Cached now so the state the switch broadcasts isn't taken for a toggle
+	l.setRelayPower(ctx, emitter, index, getPower(power))
 	return nil
 }
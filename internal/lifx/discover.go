@@ -0,0 +1,75 @@
+package lifx
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"go.yhsif.com/lifxlan"
+)
+
+// discoverAt works like lifxlan.Discover but sends GetService to addr
+// (host:port) from an ephemeral port. Devices reply to the port the request
+// came from, so this doesn't need the LIFX port to be free.
+func discoverAt(ctx context.Context, devices chan lifxlan.Device, addr string) error {
+	defer close(devices)
+
+	msg, err := lifxlan.GenerateMessage(lifxlan.Tagged, 0, lifxlan.AllDevices, 0, 0, lifxlan.GetService, nil)
+	if err != nil {
+		return err
+	}
+
+	broadcast, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.WriteTo(msg, broadcast); err != nil {
+		return err
+	}
+
+	buf := make([]byte, lifxlan.ResponseReadBufferSize)
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err := conn.SetReadDeadline(lifxlan.GetReadDeadline()); err != nil {
+			return err
+		}
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			if lifxlan.CheckTimeoutError(err) {
+				continue
+			}
+			return err
+		}
+
+		host, _, err := net.SplitHostPort(from.String())
+		if err != nil {
+			return err
+		}
+
+		resp, err := lifxlan.ParseResponse(buf[:n])
+		if err != nil || resp.Message != lifxlan.StateService {
+			continue
+		}
+
+		var raw lifxlan.RawStateServicePayload
+		if err := binary.Read(bytes.NewReader(resp.Payload), binary.LittleEndian, &raw); err != nil {
+			continue
+		}
+		if raw.Service != lifxlan.ServiceUDP {
+			continue
+		}
+		devices <- lifxlan.NewDevice(net.JoinHostPort(host, fmt.Sprint(raw.Port)), raw.Service, resp.Target)
+	}
+}
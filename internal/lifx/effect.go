@@ -0,0 +1,388 @@
+package lifx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"go.yhsif.com/lifxlan"
+)
+
+var (
+	// defaultEffectFPS is the frame rate of effects without one
+	defaultEffectFPS = 10.0
+	// maxEffectFPS is the most messages a second LIFX recommend sending a
+	// device
+	maxEffectFPS = 20.0
+	// restoreTimeout limits putting a light back when an effect stops
+	restoreTimeout = 2 * time.Second
+)
+
+// ErrInvalidEffect is returned for effects that can't be parsed.
+var ErrInvalidEffect = errors.New("invalid effect")
+
+// Effect is a continuous effect rendered by the bridge.
+type Effect struct {
+	// Render returns the color t after the effect started
+	Render func(t time.Duration) lifxlan.Color
+	// Smooth effects transition between frames, others jump
+	Smooth bool
+}
+
+// ColorLoop cycles through every hue over period.
+func ColorLoop(period time.Duration, brightness uint16) Effect {
+	return Effect{Smooth: true, Render: func(t time.Duration) lifxlan.Color {
+		f := math.Mod(float64(t)/float64(period), 1)
+		return lifxlan.Color{Hue: uint16(f * 0x10000), Saturation: 0xffff, Brightness: brightness, Kelvin: 3500}
+	}}
+}
+
+// Candle flickers randomly around base, getting redder as it dims.
+func Candle(base lifxlan.Color, rnd *rand.Rand) Effect {
+	level := 1.0
+	return Effect{Smooth: true, Render: func(t time.Duration) lifxlan.Color {
+		// A random walk pulled back towards full, with the odd deep dip
+		level += (rnd.Float64()-0.5)*0.3 + (1-level)*0.1
+		if rnd.Float64() < 0.03 {
+			level -= 0.4
+		}
+		level = math.Max(0, math.Min(1, level))
+
+		c := base
+		c.Brightness = uint16(float64(base.Brightness) * (0.55 + 0.45*level))
+		c.Hue = uint16(int(base.Hue)-int((1-level)*0x0400)) & 0xffff
+		return c
+	}}
+}
+
+// Strobe flashes each color in turn, on for the first half of its share of
+// period and off for the rest.
+func Strobe(colors []lifxlan.Color, period time.Duration) Effect {
+	slot := period / time.Duration(len(colors))
+	return Effect{Render: func(t time.Duration) lifxlan.Color {
+		i := int(t/slot) % len(colors)
+		c := colors[i]
+		if t%slot >= slot/2 {
+			c.Brightness = 0
+		}
+		return c
+	}}
+}
+
+// Breathe eases from a to b and back over period.
+func Breathe(a lifxlan.Color, b lifxlan.Color, period time.Duration) Effect {
+	return Effect{Smooth: true, Render: func(t time.Duration) lifxlan.Color {
+		f := (1 - math.Cos(2*math.Pi*float64(t)/float64(period))) / 2
+		return interpolateColor(a, b, f)
+	}}
+}
+
+// parseEffectColors returns an effect's colors and brightness, which is
+// applied to the colors if it is given.
+func parseEffectColors(e *mqtt.Effect) ([]lifxlan.Color, uint16, error) {
+	brightness := uint16(0xffff)
+	if e.Brightness != nil {
+		if *e.Brightness > 100 {
+			return nil, 0, fmt.Errorf("%w: brightness %d is over 100", ErrInvalidEffect, *e.Brightness)
+		}
+		brightness = uint16(math.Round(float64(*e.Brightness) / 100 * math.MaxUint16))
+	}
+
+	colors := make([]lifxlan.Color, len(e.Colors))
+	for i, hex := range e.Colors {
+		c, err := parseHexColor(hex)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: %s", ErrInvalidEffect, err)
+		}
+		colors[i] = *lifxlan.FromColor(c, 3500)
+		if e.Brightness != nil {
+			colors[i].Brightness = brightness
+		}
+	}
+	return colors, brightness, nil
+}
+
+// effectPeriod returns an effect's period, or d if it doesn't have one.
+func effectPeriod(e *mqtt.Effect, d time.Duration) time.Duration {
+	if e.Period != nil && *e.Period > 0 {
+		return e.Period.Duration()
+	}
+	return d
+}
+
+// parseEffect converts an effect command into an Effect, or nil for "none".
+func parseEffect(e *mqtt.Effect) (*Effect, error) {
+	colors, brightness, err := parseEffectColors(e)
+	if err != nil {
+		return nil, err
+	}
+	period := func(d time.Duration) time.Duration {
+		return effectPeriod(e, d)
+	}
+
+	var effect Effect
+	switch strings.ToLower(e.Name) {
+	case "none":
+		return nil, nil
+	case "colorloop":
+		effect = ColorLoop(period(10*time.Second), brightness)
+	case "candle":
+		base := lifxlan.Color{Hue: 0x11c7, Saturation: 0xd999, Brightness: brightness, Kelvin: 2500}
+		if len(colors) > 0 {
+			base = colors[0]
+		}
+		effect = Candle(base, rand.New(rand.NewSource(time.Now().UnixNano())))
+	case "strobe":
+		if len(colors) == 0 {
+			// Police
+			colors = []lifxlan.Color{
+				{Hue: 0, Saturation: 0xffff, Brightness: brightness, Kelvin: 3500},
+				{Hue: 0xaaaa, Saturation: 0xffff, Brightness: brightness, Kelvin: 3500},
+			}
+		}
+		effect = Strobe(colors, period(time.Second))
+	case "breathe":
+		if len(colors) == 0 {
+			colors = []lifxlan.Color{{Brightness: brightness, Kelvin: 2700}}
+		}
+		if len(colors) == 1 {
+			off := colors[0]
+			off.Brightness = 0
+			colors = append(colors, off)
+		}
+		effect = Breathe(colors[0], colors[1], period(4*time.Second))
+	default:
+		return nil, fmt.Errorf("%w: unknown effect %q", ErrInvalidEffect, e.Name)
+	}
+	return &effect, nil
+}
+
+// replacesEffect returns true if command starts an effect, or an image or
+// text that may be animated, rather than setting the light some other way.
+// Invalid effects and images leave a running effect as it is.
+func replacesEffect(command *mqtt.Command) bool {
+	if command.Effect != nil {
+		return !isFirmwareEffect(command.Effect.Name)
+	}
+	if command.Fade != nil || command.Board != nil || (command.Power != nil && !*command.Power) {
+		return false
+	}
+	return command.Image != nil || command.Text != nil
+}
+
+// runningEffect is an effect or animation running on a device.
+type runningEffect struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	// restore is set for effects, which put the light back to color and on
+	// when they stop. Animations leave their last frame showing.
+	restore bool
+	color   *lifxlan.Color
+	on      bool
+	// replaced is set when another effect takes over, which leaves the light
+	// as it is rather than putting it back first.
+	replaced atomic.Bool
+}
+
+// SetEffectFrameRate sets the frame rate of effects without one.
+func (lc *LIFXClient) SetEffectFrameRate(fps float64) {
+	lc.effectMu.Lock()
+	defer lc.effectMu.Unlock()
+	lc.effectFPS = fps
+}
+
+// StartEffect turns a light on and runs effect on it at fps frames a second
+// (the default if 0), until it is stopped. Frames are sent over a connection
+// dedicated to the effect without waiting for acks. Any effect already
+// running on the device is replaced.
+func (lc *LIFXClient) StartEffect(ctx context.Context, id string, effect Effect, fps float64) error {
+	l := lc.devices.Get(id)
+	if l == nil {
+		return fmt.Errorf("%w: device %s", ErrNotFound, id)
+	}
+	if l.light == nil {
+		return fmt.Errorf("%w: device %s is not a light", ErrInvalidEffect, id)
+	}
+
+	lc.effectMu.Lock()
+	if fps <= 0 {
+		fps = lc.effectFPS
+	}
+	lc.effectMu.Unlock()
+	if fps <= 0 {
+		fps = defaultEffectFPS
+	}
+	if fps > maxEffectFPS {
+		return fmt.Errorf("%w: %v fps is over %v", ErrInvalidEffect, fps, maxEffectFPS)
+	}
+
+	e := &runningEffect{restore: true}
+	l.stateMu.RLock()
+	e.color, e.on = l.color, l.power.On()
+	l.stateMu.RUnlock()
+	if other := lc.replaceEffect(id); other != nil && other.restore {
+		// The cached state may be a frame of the replaced effect
+		e.color, e.on = other.color, other.on
+	}
+
+	conn, err := l.dial(ctx)
+	if err != nil {
+		return err
+	}
+	first := effect.Render(0)
+	err = l.request(ctx, "SetColor", func(ctx context.Context) error {
+		return l.light.SetColor(ctx, conn, &first, 0, true)
+	})
+	if err == nil {
+		err = l.request(ctx, "SetLightPower", func(ctx context.Context) error {
+			return l.light.SetLightPower(ctx, conn, lifxlan.PowerOn, 0, true)
+		})
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	devicesControlled.WithLabelValues("light", "effect").Inc()
+
+	lc.runInBackground(l, conn, e, func(ctx context.Context) {
+		lc.runEffect(ctx, l, conn, effect, fps)
+	})
+	return nil
+}
+
+// runInBackground registers e as the effect running on a device and runs it
+// over conn, which it closes, until it is stopped or run returns. The light
+// is then put back if e restores it and no other effect has taken over. Any
+// effect registered meanwhile is replaced.
+func (lc *LIFXClient) runInBackground(l *lifxdevice, conn net.Conn, e *runningEffect, run func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel, e.done = cancel, make(chan struct{})
+
+	lc.effectMu.Lock()
+	if lc.effects == nil {
+		lc.effects = make(map[string]*runningEffect)
+	}
+	other := lc.effects[l.id]
+	lc.effects[l.id] = e
+	lc.effectMu.Unlock()
+
+	if other != nil {
+		other.replaced.Store(true)
+		other.cancel()
+		<-other.done
+	}
+
+	go func() {
+		defer close(e.done)
+		defer conn.Close()
+		defer func() {
+			lc.effectMu.Lock()
+			if lc.effects[l.id] == e {
+				delete(lc.effects, l.id)
+			}
+			lc.effectMu.Unlock()
+		}()
+
+		run(ctx)
+		switch {
+		case e.replaced.Load():
+			// The next effect is already showing
+		case e.restore:
+			lc.restore(l, conn, e.color, e.on)
+		default:
+			l.QueueRefresh(context.Background(), lc.emitter, 0)
+		}
+	}()
+}
+
+// StopEffect stops any effect running on a device, putting the light back
+// how it was before. It returns true if an effect was stopped.
+func (lc *LIFXClient) StopEffect(id string) bool {
+	return lc.stopEffect(id, false) != nil
+}
+
+// replaceEffect stops any effect running on a device without putting the
+// light back, as another effect is about to start. It returns the stopped
+// effect, or nil if there wasn't one.
+func (lc *LIFXClient) replaceEffect(id string) *runningEffect {
+	return lc.stopEffect(id, true)
+}
+
+func (lc *LIFXClient) stopEffect(id string, replaced bool) *runningEffect {
+	lc.effectMu.Lock()
+	e := lc.effects[id]
+	delete(lc.effects, id)
+	lc.effectMu.Unlock()
+
+	if e == nil {
+		return nil
+	}
+	if replaced {
+		e.replaced.Store(true)
+	}
+	e.cancel()
+	<-e.done
+	return e
+}
+
+// EffectRunning returns true if an effect is running on a device.
+func (lc *LIFXClient) EffectRunning(id string) bool {
+	lc.effectMu.Lock()
+	defer lc.effectMu.Unlock()
+	return lc.effects[id] != nil
+}
+
+func (lc *LIFXClient) runEffect(ctx context.Context, l *lifxdevice, conn net.Conn, effect Effect, fps float64) {
+	logger := l.logger().With("fps", fps)
+	logger.Info("Starting effect")
+
+	interval := time.Duration(float64(time.Second) / fps)
+	var transition time.Duration
+	if effect.Smooth {
+		transition = interval
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Effect stopped")
+			return
+		case now := <-ticker.C:
+			color := effect.Render(now.Sub(start))
+			err := l.light.SetColor(ctx, conn, &color, transition, false)
+			if err != nil && ctx.Err() == nil {
+				// Carry on, the next frame may get through
+				logger.Debug("Effect frame failed %s", err)
+			}
+		}
+	}
+}
+
+// restore puts a light back to its color and power from before an effect.
+func (lc *LIFXClient) restore(l *lifxdevice, conn net.Conn, color *lifxlan.Color, on bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), restoreTimeout)
+	defer cancel()
+	defer l.QueueRefresh(ctx, lc.emitter, 0)
+
+	if color != nil {
+		c := *color
+		if err := l.light.SetColor(ctx, conn, &c, 0, true); err != nil {
+			l.logger().Warn("Failed to restore color after effect %s", err)
+		}
+	}
+	if !on {
+		if err := l.light.SetLightPower(ctx, conn, lifxlan.PowerOff, 0, true); err != nil {
+			l.logger().Warn("Failed to restore power after effect %s", err)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package lifx_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/emulator"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/light"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"go.yhsif.com/lifxlan"
+)
+
+func TestEffects(t *testing.T) {
+	red := lifxlan.Color{Hue: 0, Saturation: 0xffff, Brightness: 0xffff, Kelvin: 3500}
+	blue := lifxlan.Color{Hue: 0xaaaa, Saturation: 0xffff, Brightness: 0xffff, Kelvin: 3500}
+
+	t.Run("ColorLoop", func(t *testing.T) {
+		e := lifx.ColorLoop(4*time.Second, 0x8000)
+		tests := map[time.Duration]uint16{0: 0, time.Second: 0x4000, 2 * time.Second: 0x8000, 5 * time.Second: 0x4000}
+		for at, want := range tests {
+			if c := e.Render(at); c.Hue != want || c.Brightness != 0x8000 {
+				t.Errorf("Expected hue %#x at %s, got %+v", want, at, c)
+			}
+		}
+	})
+
+	t.Run("Strobe", func(t *testing.T) {
+		e := lifx.Strobe([]lifxlan.Color{red, blue}, time.Second)
+		tests := []struct {
+			at   time.Duration
+			want lifxlan.Color
+		}{
+			{0, red},
+			{300 * time.Millisecond, lifxlan.Color{Saturation: 0xffff, Kelvin: 3500}},
+			{500 * time.Millisecond, blue},
+			{800 * time.Millisecond, lifxlan.Color{Hue: 0xaaaa, Saturation: 0xffff, Kelvin: 3500}},
+			{time.Second, red},
+		}
+		for _, tt := range tests {
+			if got := e.Render(tt.at); got != tt.want {
+				t.Errorf("Expected %+v at %s, got %+v", tt.want, tt.at, got)
+			}
+		}
+		if e.Smooth {
+			t.Errorf("Expected strobe to jump between frames")
+		}
+	})
+
+	t.Run("Breathe", func(t *testing.T) {
+		off := red
+		off.Brightness = 0
+		e := lifx.Breathe(red, off, 2*time.Second)
+		if c := e.Render(0); c != red {
+			t.Errorf("Expected %+v at the start, got %+v", red, c)
+		}
+		if c := e.Render(time.Second); c != off {
+			t.Errorf("Expected %+v half way, got %+v", off, c)
+		}
+		if c := e.Render(500 * time.Millisecond); c.Brightness < 0x7f00 || c.Brightness > 0x8100 {
+			t.Errorf("Expected half brightness a quarter of the way, got %+v", c)
+		}
+	})
+
+	t.Run("Candle", func(t *testing.T) {
+		base := lifxlan.Color{Hue: 0x11c7, Saturation: 0xd999, Brightness: 0xffff, Kelvin: 2500}
+		e := lifx.Candle(base, rand.New(rand.NewSource(1)))
+		changed := false
+		for i := 0; i < 100; i++ {
+			c := e.Render(time.Duration(i) * 100 * time.Millisecond)
+			if c.Brightness < 0x8000 || c.Hue > base.Hue || c.Hue < base.Hue-0x0400 {
+				t.Fatalf("Flickered too far to %+v", c)
+			}
+			changed = changed || c != base
+		}
+		if !changed {
+			t.Errorf("Expected the candle to flicker")
+		}
+	})
+}
+
+func TestEffectRunner(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	lc, _, devices := startClient(t, emulator.Config{Label: "Bulb", Version: emulator.ProductA19})
+	bulb := devices[0]
+	id := deviceID(bulb)
+	ctx := context.Background()
+
+	command := func(t *testing.T, payload string) error {
+		t.Helper()
+		var c mqtt.Command
+		if err := json.Unmarshal([]byte(payload), &c); err != nil {
+			t.Fatal(err)
+		}
+		return lc.HandleCommand(ctx, id, &c)
+	}
+
+	if err := command(t, `{"power": true, "temp": 2700, "brightness": 50, "duration": 0}`); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the color to be cached", func() bool {
+		s := lc.Device(id)
+		return s.Power && s.Color != nil
+	})
+	before := bulb.Color()
+
+	t.Run("ColorLoop", func(t *testing.T) {
+		if err := command(t, `{"effect": {"name": "colorloop", "period": "1s", "fps": 20}}`); err != nil {
+			t.Fatal(err)
+		}
+		if !lc.EffectRunning(id) {
+			t.Fatalf("Expected an effect to be running")
+		}
+
+		hues := map[uint16]bool{}
+		eventually(t, "the hue to cycle", func() bool {
+			hues[bulb.Color().Hue] = true
+			return len(hues) > 5
+		})
+		if got := bulb.Transition(); got != 50*time.Millisecond {
+			t.Errorf("Expected a transition of one frame, got %s", got)
+		}
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		if err := command(t, `{"effect": {"name": "none"}}`); err != nil {
+			t.Fatal(err)
+		}
+		if lc.EffectRunning(id) {
+			t.Fatalf("Expected the effect to stop")
+		}
+		if got := bulb.Color(); got != before {
+			t.Errorf("Expected the color to be restored to %+v, got %+v", before, got)
+		}
+		time.Sleep(200 * time.Millisecond)
+		if got := bulb.Color(); got != before {
+			t.Errorf("Expected no more frames, got %+v", got)
+		}
+	})
+
+	t.Run("OtherCommandStops", func(t *testing.T) {
+		if err := command(t, `{"effect": {"name": "strobe"}}`); err != nil {
+			t.Fatal(err)
+		}
+		if err := command(t, `{"color": "#00ff00", "duration": 0}`); err != nil {
+			t.Fatal(err)
+		}
+		if lc.EffectRunning(id) {
+			t.Fatalf("Expected the effect to stop")
+		}
+		green := bulb.Color()
+		if green.Hue != 0x5555 {
+			t.Errorf("Expected green, got %+v", green)
+		}
+		time.Sleep(200 * time.Millisecond)
+		if got := bulb.Color(); got != green {
+			t.Errorf("Expected no more frames, got %+v", got)
+		}
+	})
+
+	t.Run("RestoresPower", func(t *testing.T) {
+		if err := command(t, `{"power": false, "duration": 0}`); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, "the power to be cached", func() bool {
+			return !lc.Device(id).Power
+		})
+		if err := command(t, `{"effect": {"name": "candle"}}`); err != nil {
+			t.Fatal(err)
+		}
+		if !bulb.Power().On() {
+			t.Errorf("Expected the effect to turn the light on")
+		}
+		if !lc.StopEffect(id) {
+			t.Errorf("Expected an effect to be stopped")
+		}
+		if bulb.Power().On() {
+			t.Errorf("Expected the light to be turned back off")
+		}
+	})
+
+	t.Run("Replaced", func(t *testing.T) {
+		// The light is off after RestoresPower
+		if err := command(t, `{"effect": {"name": "candle"}}`); err != nil {
+			t.Fatal(err)
+		}
+		powerChanges := func() int {
+			n := 0
+			for _, m := range bulb.Received() {
+				if m == light.SetLightPower {
+					n++
+				}
+			}
+			return n
+		}
+		before := powerChanges()
+		if err := command(t, `{"effect": {"name": "strobe"}}`); err != nil {
+			t.Fatal(err)
+		}
+		if !lc.EffectRunning(id) {
+			t.Fatalf("Expected the new effect to be running")
+		}
+		// Only turned on by the new effect, not back off in between
+		if n := powerChanges() - before; n != 1 {
+			t.Errorf("Expected 1 power change, got %d", n)
+		}
+		if !lc.StopEffect(id) {
+			t.Errorf("Expected an effect to be stopped")
+		}
+		if bulb.Power().On() {
+			t.Errorf("Expected the light to be turned back off")
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := map[string]string{
+			"UnknownName": `{"effect": {"name": "disco"}}`,
+			"BadColor":    `{"effect": {"name": "strobe", "colors": ["red"]}}`,
+			"Brightness":  `{"effect": {"name": "colorloop", "brightness": 101}}`,
+			"FPS":         `{"effect": {"name": "colorloop", "fps": 100}}`,
+		}
+		for name, payload := range tests {
+			t.Run(name, func(t *testing.T) {
+				if err := command(t, payload); !errors.Is(err, lifx.ErrInvalidEffect) {
+					t.Errorf("Expected ErrInvalidEffect, got %v", err)
+				}
+			})
+		}
+	})
+}
@@ -1,7 +1,48 @@
 package lifx
 
-import "context"
+import (
+	"context"
+	"errors"
+)
 
 type StatusEmitter interface {
 	EmitStatus(ctx context.Context, id string, statusKey string, data interface{}) error
+	// EmitRetainedStatus is like EmitStatus, but for slow changing statuses
+	// that should be kept for future subscribers.
+	EmitRetainedStatus(ctx context.Context, id string, statusKey string, data interface{}) error
+	// EmitEvent is for things that happened rather than state, eg: a button
+	// press, that are published once and never retained.
+	EmitEvent(ctx context.Context, id string, eventKey string, data interface{}) error
+}
+
+// NewMultiEmitter creates a StatusEmitter that emits every status to all of
+// the given emitters.
+func NewMultiEmitter(emitters ...StatusEmitter) StatusEmitter {
+	return multiEmitter(emitters)
+}
+
+type multiEmitter []StatusEmitter
+
+func (m multiEmitter) EmitStatus(ctx context.Context, id string, statusKey string, data interface{}) error {
+	var errs []error
+	for _, e := range m {
+		errs = append(errs, e.EmitStatus(ctx, id, statusKey, data))
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiEmitter) EmitRetainedStatus(ctx context.Context, id string, statusKey string, data interface{}) error {
+	var errs []error
+	for _, e := range m {
+		errs = append(errs, e.EmitRetainedStatus(ctx, id, statusKey, data))
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiEmitter) EmitEvent(ctx context.Context, id string, eventKey string, data interface{}) error {
+	var errs []error
+	for _, e := range m {
+		errs = append(errs, e.EmitEvent(ctx, id, eventKey, data))
+	}
+	return errors.Join(errs...)
 }
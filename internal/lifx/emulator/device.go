@@ -0,0 +1,407 @@
+package emulator
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/multizone"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/relay"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/tile"
+	"go.yhsif.com/lifxlan"
+)
+
+// ListenAddr is the address emulated devices listen on.
+const ListenAddr = "127.0.0.1:0"
+
+// Some products from lifxlan.ProductMap, for Config.Version.
+var (
+	ProductA19    = lifxlan.HardwareVersion{VendorID: 1, ProductID: 27}
+	ProductTile   = lifxlan.HardwareVersion{VendorID: 1, ProductID: 55}
+	ProductSwitch = lifxlan.HardwareVersion{VendorID: 1, ProductID: 70}
+	ProductStrip  = lifxlan.HardwareVersion{VendorID: 1, ProductID: 32}
+)
+
+// Config is the initial state and behavior of an emulated device.
+type Config struct {
+	// Target is the device's MAC address. A unique target is picked if zero.
+	Target   lifxlan.Target
+	Label    string
+	Group    string
+	Location string
+	// Version selects the product, eg: ProductA19.
+	Version lifxlan.HardwareVersion
+	Power   lifxlan.Power
+	Color   lifxlan.Color
+	// Tiles is the number of 8x8 tiles of matrix products, default 1 or
+	// len(Rotations).
+	Tiles int
+	// Rotations are how the tiles are mounted, in chain order. Tiles without
+	// one are right side up.
+	Rotations []tile.Rotation
+	// Relays is the number of relays (and buttons) of switches, default 4.
+	Relays int
+	// Latency delays every reply.
+	Latency time.Duration
+	// PacketLoss is the chance (0 to 1) of ignoring a received packet.
+	PacketLoss float64
+}
+
+// nextTarget is used to pick unique targets, d0:73:d5:00:00:01 onwards.
+var nextTarget uint64
+
+func newTarget() lifxlan.Target {
+	n := atomic.AddUint64(&nextTarget, 1)
+	var t lifxlan.Target
+	for i, b := range []byte{0xd0, 0x73, 0xd5, 0, byte(n >> 8), byte(n)} {
+		t |= lifxlan.Target(b) << (8 * i)
+	}
+	return t
+}
+
+// Device is an emulated LIFX device.
+type Device struct {
+	target  lifxlan.Target
+	version lifxlan.HardwareVersion
+	product lifxlan.Product
+	latency time.Duration
+	loss    float64
+	// rotations has one entry per tile
+	rotations []tile.Rotation
+	started   time.Time
+	conn      net.PacketConn
+	done      chan struct{}
+	wg        sync.WaitGroup
+
+	// mu guards everything below
+	mu       sync.Mutex
+	rand     *rand.Rand
+	dropNext int
+	// ignored are message types that are never replied to
+	ignored  map[lifxlan.MessageType]bool
+	label    lifxlan.Label
+	group    lifxlan.Label
+	location lifxlan.Label
+	power    lifxlan.Power
+	color    lifxlan.Color
+	relays   []lifxlan.Power
+	// buttons and buttonConfig are the button settings of switches
+	buttons      []relay.RawButton
+	buttonConfig relay.RawButtonConfig
+	tiles        [][64]lifxlan.Color
+	// tileEffect and multiZoneEffect are the running firmware effects
+	tileEffect      tile.RawTileEffectSettings
+	multiZoneEffect multizone.RawMultiZoneEffectPayload
+	received        []lifxlan.MessageType
+	// transition is the duration of the last color or light power change
+	transition time.Duration
+}
+
+// Start starts an emulated device listening on ListenAddr.
+func Start(cfg Config) (*Device, error) {
+	conn, err := net.ListenPacket("udp", ListenAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Device{
+		target:  cfg.Target,
+		version: cfg.Version,
+		product: lifxlan.ProductMap[lifxlan.ProductMapKey(cfg.Version.VendorID, cfg.Version.ProductID)],
+		latency: cfg.Latency,
+		loss:    cfg.PacketLoss,
+		started: time.Now(),
+		conn:    conn,
+		done:    make(chan struct{}),
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		power:   cfg.Power,
+		color:   cfg.Color,
+	}
+	if d.target == 0 {
+		d.target = newTarget()
+	}
+	d.label.Set(cfg.Label)
+	d.group.Set(cfg.Group)
+	d.location.Set(cfg.Location)
+	if d.HasMatrix() {
+		tiles := cfg.Tiles
+		if tiles <= 0 {
+			tiles = len(cfg.Rotations)
+		}
+		if tiles <= 0 {
+			tiles = 1
+		}
+		d.tiles = make([][64]lifxlan.Color, tiles)
+		d.rotations = make([]tile.Rotation, tiles)
+		copy(d.rotations, cfg.Rotations)
+	}
+	if d.HasRelays() {
+		relays := cfg.Relays
+		if relays <= 0 {
+			relays = 4
+		}
+		d.relays = make([]lifxlan.Power, relays)
+		// Each button toggles the relay below it
+		for i := range d.relays {
+			d.buttons = append(d.buttons, relay.MakeButton(relay.RelaysAction(relay.GesturePress, uint8(i))))
+		}
+	}
+
+	d.wg.Add(1)
+	go d.serve()
+	return d, nil
+}
+
+// Close stops the device. It won't reply to anything afterwards.
+func (d *Device) Close() error {
+	select {
+	case <-d.done:
+		return nil
+	default:
+	}
+	close(d.done)
+	err := d.conn.Close()
+	d.wg.Wait()
+	return err
+}
+
+// Addr returns the host:port the device listens on.
+func (d *Device) Addr() string {
+	return d.conn.LocalAddr().String()
+}
+
+// Port returns the port the device listens on.
+func (d *Device) Port() int {
+	return d.conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// Target returns the device's MAC address.
+func (d *Device) Target() lifxlan.Target {
+	return d.target
+}
+
+// LIFXDevice returns a lifxlan.Device that talks to the emulated device.
+func (d *Device) LIFXDevice() lifxlan.Device {
+	return lifxlan.NewDevice(d.Addr(), lifxlan.ServiceUDP, d.target)
+}
+
+// HasRelays returns true if the product is a switch.
+func (d *Device) HasRelays() bool {
+	return d.product.Features.Relays != nil && bool(*d.product.Features.Relays)
+}
+
+// HasMatrix returns true if the product is made of tiles.
+func (d *Device) HasMatrix() bool {
+	return d.product.Features.Matrix != nil && bool(*d.product.Features.Matrix)
+}
+
+// HasMultiZone returns true if the product is a strip.
+func (d *Device) HasMultiZone() bool {
+	return d.product.Features.Multizone != nil && bool(*d.product.Features.Multizone)
+}
+
+// DropNext ignores the next n received packets, regardless of PacketLoss.
+func (d *Device) DropNext(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dropNext = n
+}
+
+// Ignore stops the device replying to messages of the given types, as if
+// they were lost. Calling it without any types replies to everything again.
+func (d *Device) Ignore(messages ...lifxlan.MessageType) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ignored = make(map[lifxlan.MessageType]bool, len(messages))
+	for _, m := range messages {
+		d.ignored[m] = true
+	}
+}
+
+// drop decides whether to ignore a received message.
+func (d *Device) drop(message lifxlan.MessageType) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.dropNext > 0 {
+		d.dropNext--
+		return true
+	}
+	if d.ignored[message] {
+		return true
+	}
+	return d.loss > 0 && d.rand.Float64() < d.loss
+}
+
+// Label returns the current label.
+func (d *Device) Label() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.label.String()
+}
+
+// Power returns the current power level.
+func (d *Device) Power() lifxlan.Power {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.power
+}
+
+// SetPower changes the power level as if it were changed by someone else,
+// eg: the LIFX app.
+func (d *Device) SetPower(power lifxlan.Power) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.power = power
+}
+
+// Color returns the current light color.
+func (d *Device) Color() lifxlan.Color {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.color
+}
+
+// SetColor changes the light color as if it were changed by someone else.
+func (d *Device) SetColor(color lifxlan.Color) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.color = color
+}
+
+// Transition returns the transition time of the last color or light power
+// change.
+func (d *Device) Transition() time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.transition
+}
+
+// RelayPower returns the current power level of the relay at index.
+func (d *Device) RelayPower(index int) lifxlan.Power {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.relays[index]
+}
+
+// SetRelayPower changes the power level of the relay at index as if it were
+// changed by someone else.
+func (d *Device) SetRelayPower(index int, power lifxlan.Power) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.relays[index] = power
+}
+
+// Buttons returns the actions of a switch's buttons.
+func (d *Device) Buttons() []relay.RawButton {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]relay.RawButton(nil), d.buttons...)
+}
+
+// Press emulates pressing a switch's button with gesture, toggling the relays
+// of its matching actions. Actions on other devices are ignored.
+func (d *Device) Press(button int, gesture relay.ButtonGesture) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if button < 0 || button >= len(d.buttons) {
+		return
+	}
+	for _, a := range d.buttons[button].ActionList() {
+		if a.Gesture != gesture || a.TargetType != relay.TargetRelays {
+			continue
+		}
+		for _, i := range a.Relays() {
+			if int(i) >= len(d.relays) {
+				continue
+			}
+			if d.relays[i].On() {
+				d.relays[i] = lifxlan.PowerOff
+			} else {
+				d.relays[i] = lifxlan.PowerOn
+			}
+		}
+	}
+}
+
+// ButtonConfig returns the haptic and backlight settings of a switch's
+// buttons.
+func (d *Device) ButtonConfig() relay.RawButtonConfig {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.buttonConfig
+}
+
+// TileColors returns the 64 colors of the tile at index, row by row.
+func (d *Device) TileColors(index int) [64]lifxlan.Color {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tiles[index]
+}
+
+// TileEffect returns the firmware effect running on a matrix product.
+func (d *Device) TileEffect() tile.RawTileEffectSettings {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tileEffect
+}
+
+// MultiZoneEffect returns the firmware effect running on a strip.
+func (d *Device) MultiZoneEffect() multizone.RawMultiZoneEffectPayload {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.multiZoneEffect
+}
+
+// Received returns the type of every message received so far, excluding
+// dropped packets.
+func (d *Device) Received() []lifxlan.MessageType {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]lifxlan.MessageType(nil), d.received...)
+}
+
+func (d *Device) serve() {
+	defer d.wg.Done()
+
+	buf := make([]byte, lifxlan.ResponseReadBufferSize)
+	for {
+		n, addr, err := d.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		req, err := lifxlan.ParseResponse(buf[:n])
+		if err != nil || !req.Target.Matches(d.target) || d.drop(req.Message) {
+			continue
+		}
+
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			if d.latency > 0 {
+				select {
+				case <-time.After(d.latency):
+				case <-d.done:
+					return
+				}
+			}
+			d.handle(d.conn, addr, req)
+		}()
+	}
+}
+
+// reply sends a message back to addr in response to req.
+func (d *Device) reply(conn net.PacketConn, addr net.Addr, req *lifxlan.Response, message lifxlan.MessageType, payload []byte) {
+	msg, err := lifxlan.GenerateMessage(lifxlan.NotTagged, req.Source, d.target, 0, req.Sequence, message, payload)
+	if err != nil {
+		return
+	}
+	conn.WriteTo(msg, addr)
+}
@@ -0,0 +1,14 @@
+// Package emulator is an in-process emulator of the LIFX LAN protocol.
+//
+// Each emulated Device listens on its own UDP port on the loopback interface
+// and answers the messages used by this project: discovery, labels, versions,
+// info, power, light color and waveforms, relays and switch buttons, tiles
+// and firmware effects.
+// Latency and packet loss can be configured to exercise timeouts.
+//
+// A Network answers discovery broadcasts for a set of devices, so discovery
+// can be tested by sending to Network.Addr instead of the real broadcast
+// address.
+//
+// https://lan.developer.lifx.com/docs
+package emulator
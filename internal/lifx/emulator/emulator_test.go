@@ -0,0 +1,103 @@
+package emulator_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/emulator"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/relay"
+	"go.yhsif.com/lifxlan"
+)
+
+func TestDevice(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	d, err := emulator.Start(emulator.Config{
+		Label:   "Switch",
+		Version: emulator.ProductSwitch,
+		Power:   lifxlan.PowerOn,
+		Latency: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+
+	device := d.LIFXDevice()
+
+	t.Run("Label", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		start := time.Now()
+		if err := device.GetLabel(ctx, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := device.Label().String(); got != "Switch" {
+			t.Errorf("Expected label Switch, got %q", got)
+		}
+		if time.Since(start) < 20*time.Millisecond {
+			t.Errorf("Expected the reply to be delayed")
+		}
+	})
+
+	t.Run("Relay", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		rd := relay.Wrap(device)
+		if err := rd.SetRPower(ctx, nil, 2, lifxlan.PowerOn, true); err != nil {
+			t.Fatal(err)
+		}
+		if !d.RelayPower(2).On() {
+			t.Errorf("Expected relay 2 to be on")
+		}
+		power, err := rd.GetRPower(ctx, nil, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !power.On() {
+			t.Errorf("Expected GetRPower to report relay 2 on")
+		}
+	})
+
+	t.Run("DropNext", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		d.DropNext(1)
+		if _, err := device.GetPower(ctx, nil); err == nil {
+			t.Errorf("Expected the request to time out")
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		power, err := device.GetPower(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !power.On() {
+			t.Errorf("Expected power on")
+		}
+	})
+
+	t.Run("Ignore", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		d.Ignore(lifxlan.GetPower)
+		if _, err := device.GetPower(ctx, nil); err == nil {
+			t.Errorf("Expected the request to time out")
+		}
+
+		d.Ignore()
+		ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if _, err := device.GetPower(ctx, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,363 @@
+package emulator
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/info"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/light"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/multizone"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/relay"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/tile"
+	"go.yhsif.com/lifxlan"
+)
+
+// Firmware version reported by every emulated device.
+const (
+	firmwareMajor = 3
+	firmwareMinor = 70
+)
+
+// handle answers a single request, acking it first if asked to.
+func (d *Device) handle(conn net.PacketConn, addr net.Addr, req *lifxlan.Response) {
+	d.mu.Lock()
+	d.received = append(d.received, req.Message)
+	d.mu.Unlock()
+
+	if req.Flags&lifxlan.FlagAckRequired != 0 {
+		d.reply(conn, addr, req, lifxlan.Acknowledgement, nil)
+	}
+
+	message, payloads := d.respond(req)
+	for _, payload := range payloads {
+		buf := new(bytes.Buffer)
+		if err := binary.Write(buf, binary.LittleEndian, payload); err != nil {
+			return
+		}
+		d.reply(conn, addr, req, message, buf.Bytes())
+	}
+}
+
+// one is a reply with a single message.
+func one(payload interface{}) []interface{} {
+	return []interface{}{payload}
+}
+
+// maybe is a reply to a Set* message, only sent when the request asks for
+// one.
+func maybe(resRequired bool, payload interface{}) []interface{} {
+	if !resRequired {
+		return nil
+	}
+	return one(payload)
+}
+
+// respond applies req to the device state and returns the reply message type
+// and one payload per message to send.
+func (d *Device) respond(req *lifxlan.Response) (lifxlan.MessageType, []interface{}) {
+	resRequired := req.Flags&lifxlan.FlagResRequired != 0
+	r := bytes.NewReader(req.Payload)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch req.Message {
+	case lifxlan.GetService:
+		return lifxlan.StateService, one(&lifxlan.RawStateServicePayload{
+			Service: lifxlan.ServiceUDP,
+			Port:    uint32(d.conn.LocalAddr().(*net.UDPAddr).Port),
+		})
+
+	case lifxlan.GetHostFirmware:
+		return lifxlan.StateHostFirmware, one(&lifxlan.RawStateHostFirmwarePayload{
+			VersionMajor: firmwareMajor,
+			VersionMinor: firmwareMinor,
+		})
+
+	case info.GetWifiInfo:
+		// About -50dBm
+		return info.StateWifiInfo, one(&info.RawStateWifiInfoPayload{Signal: 1e-5})
+
+	case info.GetInfo:
+		now := time.Now()
+		return info.StateInfo, one(&info.RawStateInfoPayload{
+			Time:   uint64(now.UnixNano()),
+			Uptime: uint64(now.Sub(d.started)),
+		})
+
+	case info.GetLocation:
+		return info.StateLocation, one(&info.RawStateLocationPayload{
+			Location: md5.Sum(d.location[:]),
+			Label:    d.location,
+		})
+
+	case info.GetGroup:
+		return info.StateGroup, one(&info.RawStateGroupPayload{
+			Group: md5.Sum(d.group[:]),
+			Label: d.group,
+		})
+
+	case lifxlan.GetLabel:
+		return lifxlan.StateLabel, one(&lifxlan.RawStateLabelPayload{Label: d.label})
+
+	case lifxlan.GetVersion:
+		return lifxlan.StateVersion, one(&lifxlan.RawStateVersionPayload{Version: d.version})
+
+	case lifxlan.EchoRequest:
+		var raw lifxlan.RawEchoResponsePayload
+		copy(raw.Echoing[:], req.Payload)
+		return lifxlan.EchoResponse, one(&raw)
+
+	case lifxlan.GetPower:
+		return lifxlan.StatePower, one(&lifxlan.RawStatePowerPayload{Level: d.power})
+
+	case lifxlan.SetPower:
+		var raw lifxlan.RawSetPowerPayload
+		if binary.Read(r, binary.LittleEndian, &raw) != nil {
+			return lifxlan.StatePower, nil
+		}
+		d.power = raw.Level
+		return lifxlan.StatePower, maybe(resRequired, &lifxlan.RawStatePowerPayload{Level: d.power})
+	}
+
+	if d.HasRelays() {
+		if message, payloads, ok := d.respondRelay(req.Message, r, resRequired); ok {
+			return message, payloads
+		}
+	} else if message, payloads, ok := d.respondLight(req.Message, r, resRequired); ok {
+		return message, payloads
+	}
+	if d.HasMatrix() {
+		if message, payloads, ok := d.respondTile(req.Message, r, resRequired); ok {
+			return message, payloads
+		}
+	}
+	if d.HasMultiZone() {
+		if message, payloads, ok := d.respondMultiZone(req.Message, r, resRequired); ok {
+			return message, payloads
+		}
+	}
+
+	return lifxlan.StateUnhandled, one(&lifxlan.RawStateUnhandledPayload{UnhandledType: req.Message})
+}
+
+// lightState is the reply to light messages. The caller must hold d.mu.
+func (d *Device) lightState() *light.RawStatePayload {
+	return &light.RawStatePayload{Color: d.color, Power: d.power, Label: d.label}
+}
+
+// respondLight handles light messages, returning false for any other
+// message. The caller must hold d.mu.
+func (d *Device) respondLight(message lifxlan.MessageType, r *bytes.Reader, resRequired bool) (lifxlan.MessageType, []interface{}, bool) {
+	switch message {
+	case light.Get:
+		return light.State, one(d.lightState()), true
+
+	case light.SetColor:
+		var raw light.RawSetColorPayload
+		if binary.Read(r, binary.LittleEndian, &raw) != nil {
+			return light.State, nil, true
+		}
+		d.color = raw.Color
+		d.transition = raw.Duration.Duration()
+		return light.State, maybe(resRequired, d.lightState()), true
+
+	case light.SetLightPower:
+		var raw light.RawSetLightPowerPayload
+		if binary.Read(r, binary.LittleEndian, &raw) != nil {
+			return light.State, nil, true
+		}
+		d.power = raw.Level
+		d.transition = raw.Duration.Duration()
+		return light.State, maybe(resRequired, d.lightState()), true
+
+	case light.SetWaveformOptional:
+		var raw light.RawSetWaveformOptionalPayload
+		if binary.Read(r, binary.LittleEndian, &raw) != nil {
+			return light.State, nil, true
+		}
+		// Transient waveforms end on the original color
+		if raw.Transient == 0 {
+			if raw.SetHue != 0 {
+				d.color.Hue = raw.Color.Hue
+			}
+			if raw.SetSaturation != 0 {
+				d.color.Saturation = raw.Color.Saturation
+			}
+			if raw.SetBrightness != 0 {
+				d.color.Brightness = raw.Color.Brightness
+			}
+			if raw.SetKelvin != 0 {
+				d.color.Kelvin = raw.Color.Kelvin
+			}
+		}
+		return light.State, maybe(resRequired, d.lightState()), true
+	}
+	return 0, nil, false
+}
+
+// respondRelay handles relay messages, returning false for any other
+// message. The caller must hold d.mu.
+func (d *Device) respondRelay(message lifxlan.MessageType, r *bytes.Reader, resRequired bool) (lifxlan.MessageType, []interface{}, bool) {
+	switch message {
+	case relay.GetRPower:
+		var raw relay.RawGetRPowerPayload
+		if binary.Read(r, binary.LittleEndian, &raw) != nil || int(raw.Index) >= len(d.relays) {
+			return relay.StateRPower, nil, true
+		}
+		return relay.StateRPower, one(&relay.RawStateRPowerPayload{Index: raw.Index, Level: d.relays[raw.Index]}), true
+
+	case relay.SetRPower:
+		var raw relay.RawSetRPowerPayload
+		if binary.Read(r, binary.LittleEndian, &raw) != nil || int(raw.Index) >= len(d.relays) {
+			return relay.StateRPower, nil, true
+		}
+		d.relays[raw.Index] = raw.Level
+		return relay.StateRPower, maybe(resRequired, &relay.RawStateRPowerPayload{Index: raw.Index, Level: raw.Level}), true
+
+	case relay.GetButton:
+		return relay.StateButton, one(d.buttonState()), true
+
+	case relay.SetButton:
+		var raw relay.RawSetButtonPayload
+		if binary.Read(r, binary.LittleEndian, &raw) != nil {
+			return relay.StateButton, nil, true
+		}
+		for i := 0; i < int(raw.ButtonsCount) && i < relay.MaxButtons; i++ {
+			if index := int(raw.Index) + i; index < len(d.buttons) {
+				d.buttons[index] = raw.Buttons[i]
+			}
+		}
+		return relay.StateButton, maybe(resRequired, d.buttonState()), true
+
+	case relay.GetButtonConfig:
+		config := d.buttonConfig
+		return relay.StateButtonConfig, one(&config), true
+
+	case relay.SetButtonConfig:
+		if binary.Read(r, binary.LittleEndian, &d.buttonConfig) != nil {
+			return relay.StateButtonConfig, nil, true
+		}
+		config := d.buttonConfig
+		return relay.StateButtonConfig, maybe(resRequired, &config), true
+	}
+	return 0, nil, false
+}
+
+// buttonState returns the actions of every button. The caller must hold d.mu.
+func (d *Device) buttonState() *relay.RawStateButtonPayload {
+	raw := &relay.RawStateButtonPayload{
+		Count:        uint8(len(d.buttons)),
+		ButtonsCount: uint8(len(d.buttons)),
+	}
+	copy(raw.Buttons[:], d.buttons)
+	return raw
+}
+
+// respondTile handles tile messages, returning false for any other message.
+// The caller must hold d.mu.
+func (d *Device) respondTile(message lifxlan.MessageType, r *bytes.Reader, resRequired bool) (lifxlan.MessageType, []interface{}, bool) {
+	switch message {
+	case tile.GetDeviceChain:
+		raw := &tile.RawStateDeviceChainPayload{TotalCount: uint8(len(d.tiles))}
+		for i := range d.tiles {
+			x, y, z := accelMeas(d.rotations[i])
+			raw.TileDevices[i] = tile.RawTileDevice{
+				AccelMeasX:      x,
+				AccelMeasY:      y,
+				AccelMeasZ:      z,
+				UserX:           float32(i),
+				Width:           8,
+				Height:          8,
+				HardwareVersion: d.version,
+				Firmware: lifxlan.RawStateHostFirmwarePayload{
+					VersionMajor: firmwareMajor,
+					VersionMinor: firmwareMinor,
+				},
+			}
+		}
+		return tile.StateDeviceChain, one(raw), true
+
+	case tile.GetTileState64:
+		// One reply per tile
+		var raw tile.RawGetTileState64Payload
+		if binary.Read(r, binary.LittleEndian, &raw) != nil {
+			return tile.StateTileState64, nil, true
+		}
+		var payloads []interface{}
+		for i := int(raw.TileIndex); i < int(raw.TileIndex)+int(raw.Length) && i < len(d.tiles); i++ {
+			payloads = append(payloads, &tile.RawStateTileState64Payload{
+				TileIndex: uint8(i),
+				Width:     8,
+				Colors:    d.tiles[i],
+			})
+		}
+		return tile.StateTileState64, payloads, true
+
+	case tile.SetTileState64:
+		var raw tile.RawSetTileState64Payload
+		if binary.Read(r, binary.LittleEndian, &raw) != nil || int(raw.TileIndex) >= len(d.tiles) || raw.Width == 0 {
+			return tile.StateTileState64, nil, true
+		}
+		for i, c := range raw.Colors {
+			x := int(raw.X) + i%int(raw.Width)
+			y := int(raw.Y) + i/int(raw.Width)
+			if x < 8 && y < 8 {
+				d.tiles[raw.TileIndex][y*8+x] = c
+			}
+		}
+		// Set64 never replies
+		return tile.StateTileState64, nil, true
+
+	case tile.GetTileEffect:
+		return tile.StateTileEffect, one(&tile.RawStateTileEffectPayload{RawTileEffectSettings: d.tileEffect}), true
+
+	case tile.SetTileEffect:
+		var raw tile.RawSetTileEffectPayload
+		if binary.Read(r, binary.LittleEndian, &raw) != nil {
+			return tile.StateTileEffect, nil, true
+		}
+		d.tileEffect = raw.RawTileEffectSettings
+		return tile.StateTileEffect, maybe(resRequired, &tile.RawStateTileEffectPayload{RawTileEffectSettings: d.tileEffect}), true
+	}
+	return 0, nil, false
+}
+
+// accelMeas returns the accelerometer measurements of a tile mounted with
+// rotation, gravity pulling towards the bottom of the room.
+func accelMeas(rotation tile.Rotation) (x, y, z int16) {
+	switch rotation {
+	case tile.RotationRotateRight:
+		return 100, 0, 0
+	case tile.RotationRotateLeft:
+		return -100, 0, 0
+	case tile.RotationFaceDown:
+		return 0, 0, 100
+	case tile.RotationFaceUp:
+		return 0, 0, -100
+	case tile.RotationUpsideDown:
+		return 0, 100, 0
+	}
+	return 0, -100, 0
+}
+
+// respondMultiZone handles multizone messages, returning false for any other
+// message. The caller must hold d.mu.
+func (d *Device) respondMultiZone(message lifxlan.MessageType, r *bytes.Reader, resRequired bool) (lifxlan.MessageType, []interface{}, bool) {
+	switch message {
+	case multizone.GetMultiZoneEffect:
+		effect := d.multiZoneEffect
+		return multizone.StateMultiZoneEffect, one(&effect), true
+
+	case multizone.SetMultiZoneEffect:
+		if binary.Read(r, binary.LittleEndian, &d.multiZoneEffect) != nil {
+			return multizone.StateMultiZoneEffect, nil, true
+		}
+		effect := d.multiZoneEffect
+		return multizone.StateMultiZoneEffect, maybe(resRequired, &effect), true
+	}
+	return 0, nil, false
+}
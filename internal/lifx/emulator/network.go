@@ -0,0 +1,102 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+
+	"go.yhsif.com/lifxlan"
+)
+
+// Network answers discovery broadcasts on behalf of its devices, standing in
+// for the broadcast address of a real network.
+type Network struct {
+	conn net.PacketConn
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	devices []*Device
+}
+
+// NewNetwork starts listening for discovery messages on addr, eg:
+// ListenAddr.
+func NewNetwork(addr string) (*Network, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Network{conn: conn}
+	n.wg.Add(1)
+	go n.serve()
+	return n, nil
+}
+
+// Addr returns the host:port to send discovery messages to.
+func (n *Network) Addr() string {
+	return n.conn.LocalAddr().String()
+}
+
+// Add starts a device that can be discovered on the network.
+func (n *Network) Add(cfg Config) (*Device, error) {
+	d, err := Start(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.devices = append(n.devices, d)
+	return d, nil
+}
+
+// Devices returns the devices on the network.
+func (n *Network) Devices() []*Device {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]*Device(nil), n.devices...)
+}
+
+// Close stops the network and all of its devices.
+func (n *Network) Close() error {
+	err := n.conn.Close()
+	n.wg.Wait()
+	for _, d := range n.Devices() {
+		d.Close()
+	}
+	return err
+}
+
+func (n *Network) serve() {
+	defer n.wg.Done()
+
+	buf := make([]byte, lifxlan.ResponseReadBufferSize)
+	for {
+		size, addr, err := n.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		req, err := lifxlan.ParseResponse(buf[:size])
+		if err != nil || req.Message != lifxlan.GetService {
+			continue
+		}
+
+		for _, d := range n.Devices() {
+			if !req.Target.Matches(d.target) || d.drop(req.Message) {
+				continue
+			}
+			buf := new(bytes.Buffer)
+			binary.Write(buf, binary.LittleEndian, &lifxlan.RawStateServicePayload{
+				Service: lifxlan.ServiceUDP,
+				Port:    uint32(d.Port()),
+			})
+			d.reply(n.conn, addr, req, lifxlan.StateService, buf.Bytes())
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package lifx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"go.yhsif.com/lifxlan"
+)
+
+var (
+	// defaultFadeDuration is used for fades without a duration
+	defaultFadeDuration = 30 * time.Minute
+	// fadeSteps is how many SetColor calls a fade aims to make, limited by
+	// minFadeStep and maxFadeStep
+	fadeSteps   = 100
+	minFadeStep = 200 * time.Millisecond
+	maxFadeStep = 10 * time.Second
+)
+
+// CurveStop is a color on a Curve.
+type CurveStop struct {
+	// At is how far through the curve the color is reached, from 0 to 1.
+	At    float64
+	Color lifxlan.Color
+}
+
+// Curve is a path through colors, sorted by At.
+type Curve []CurveStop
+
+// Sunrise goes from a dim deep red through amber to bright warm white.
+var Sunrise = Curve{
+	{At: 0, Color: lifxlan.Color{Hue: 0, Saturation: 0xffff, Brightness: 0x0290, Kelvin: 2500}},
+	{At: 0.4, Color: lifxlan.Color{Hue: 0x0e38, Saturation: 0xffff, Brightness: 0x4ccc, Kelvin: 2500}},
+	{At: 0.7, Color: lifxlan.Color{Hue: 0x1c71, Saturation: 0x7fff, Brightness: 0x9999, Kelvin: 2500}},
+	{At: 1, Color: lifxlan.Color{Hue: 0x1c71, Saturation: 0, Brightness: 0xffff, Kelvin: 2700}},
+}
+
+// Sunset goes from bright warm white through amber to a dim deep red, then
+// off.
+var Sunset = Curve{
+	{At: 0, Color: lifxlan.Color{Hue: 0x1c71, Saturation: 0, Brightness: 0xffff, Kelvin: 2700}},
+	{At: 0.3, Color: lifxlan.Color{Hue: 0x1c71, Saturation: 0x7fff, Brightness: 0x9999, Kelvin: 2500}},
+	{At: 0.6, Color: lifxlan.Color{Hue: 0x0e38, Saturation: 0xffff, Brightness: 0x4ccc, Kelvin: 2500}},
+	{At: 0.95, Color: lifxlan.Color{Hue: 0, Saturation: 0xffff, Brightness: 0x0290, Kelvin: 2500}},
+	{At: 1, Color: lifxlan.Color{Hue: 0, Saturation: 0xffff, Brightness: 0, Kelvin: 2500}},
+}
+
+// At returns the color at t, from 0 to 1, interpolating between stops.
+func (c Curve) At(t float64) lifxlan.Color {
+	if len(c) == 0 {
+		return lifxlan.Color{}
+	}
+	if t <= c[0].At {
+		return c[0].Color
+	}
+	for i := 1; i < len(c); i++ {
+		if t > c[i].At {
+			continue
+		}
+		a, b := c[i-1], c[i]
+		if b.At == a.At {
+			return b.Color
+		}
+		return interpolateColor(a.Color, b.Color, (t-a.At)/(b.At-a.At))
+	}
+	return c[len(c)-1].Color
+}
+
+// interpolateColor returns the color f (0 to 1) of the way from a to b. Hue
+// takes the shortest way around the color wheel.
+func interpolateColor(a lifxlan.Color, b lifxlan.Color, f float64) lifxlan.Color {
+	// The hue of white doesn't matter, so don't sweep through other hues
+	if a.Saturation == 0 {
+		a.Hue = b.Hue
+	}
+	if b.Saturation == 0 {
+		b.Hue = a.Hue
+	}
+
+	hue := float64(b.Hue) - float64(a.Hue)
+	if hue > 0x8000 {
+		hue -= 0x10000
+	} else if hue < -0x8000 {
+		hue += 0x10000
+	}
+
+	return lifxlan.Color{
+		Hue:        uint16(int(math.Round(float64(a.Hue)+hue*f)) & 0xffff),
+		Saturation: interpolateUint16(a.Saturation, b.Saturation, f),
+		Brightness: interpolateUint16(a.Brightness, b.Brightness, f),
+		Kelvin:     interpolateUint16(a.Kelvin, b.Kelvin, f),
+	}
+}
+
+func interpolateUint16(a uint16, b uint16, f float64) uint16 {
+	return uint16(math.Round(float64(a) + (float64(b)-float64(a))*f))
+}
+
+// ErrInvalidFade is returned for fades that can't be parsed.
+var ErrInvalidFade = errors.New("invalid fade")
+
+// parseFade converts a fade command into a Curve.
+func parseFade(fade *mqtt.Fade) (Curve, error) {
+	switch strings.ToLower(fade.Preset) {
+	case "sunrise":
+		return Sunrise, nil
+	case "sunset":
+		return Sunset, nil
+	case "":
+	default:
+		return nil, fmt.Errorf("%w: unknown preset %q", ErrInvalidFade, fade.Preset)
+	}
+	if len(fade.Stops) == 0 {
+		return nil, fmt.Errorf("%w: no preset or stops", ErrInvalidFade)
+	}
+
+	curve := make(Curve, len(fade.Stops))
+	known := make([]bool, len(fade.Stops))
+	for i, s := range fade.Stops {
+		if s.At != nil {
+			if *s.At < 0 || *s.At > 1 {
+				return nil, fmt.Errorf("%w: at %v is not between 0 and 1", ErrInvalidFade, *s.At)
+			}
+			curve[i].At = *s.At
+			known[i] = true
+		}
+		color, err := parseFadeColor(s)
+		if err != nil {
+			return nil, err
+		}
+		curve[i].Color = color
+	}
+
+	// Spread out stops without At between their neighbours
+	if !known[0] {
+		curve[0].At, known[0] = 0, true
+	}
+	if last := len(curve) - 1; !known[last] {
+		curve[last].At, known[last] = 1, true
+	}
+	for i := 1; i < len(curve); i++ {
+		if known[i] {
+			continue
+		}
+		j := i + 1
+		for !known[j] {
+			j++
+		}
+		prev := curve[i-1].At
+		curve[i].At = prev + (curve[j].At-prev)/float64(j-i+1)
+		known[i] = true
+	}
+
+	sort.SliceStable(curve, func(i, j int) bool { return curve[i].At < curve[j].At })
+	return curve, nil
+}
+
+// parseFadeColor converts a stop's hex color, or white temperature, and
+// brightness percentage into a color.
+func parseFadeColor(s mqtt.FadeStop) (lifxlan.Color, error) {
+	color := lifxlan.Color{Brightness: 0xffff, Kelvin: 3500}
+	if s.Color != nil {
+		c, err := parseHexColor(*s.Color)
+		if err != nil {
+			return color, fmt.Errorf("%w: %s", ErrInvalidFade, err)
+		}
+		color = *lifxlan.FromColor(c, 3500)
+	}
+	if s.Temperature != nil {
+		color.Kelvin = *s.Temperature
+		if s.Color == nil {
+			color.Saturation = 0
+		}
+	}
+	if s.Brightness != nil {
+		if *s.Brightness > 100 {
+			return color, fmt.Errorf("%w: brightness %d is over 100", ErrInvalidFade, *s.Brightness)
+		}
+		color.Brightness = uint16(math.Round(float64(*s.Brightness) / 100 * math.MaxUint16))
+	}
+	return color, nil
+}
+
+// fade is a fade running on a device.
+type fade struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// StartFade transitions a light through curve over duration, stepwise, so
+// it isn't limited by how long a device will transition for. The light is
+// turned off at the end if the curve ends with no brightness. Any fade
+// already running on the device is stopped.
+func (lc *LIFXClient) StartFade(id string, curve Curve, duration time.Duration) error {
+	if lc.devices.Get(id) == nil {
+		return fmt.Errorf("%w: device %s", ErrNotFound, id)
+	}
+	if len(curve) == 0 {
+		return fmt.Errorf("%w: empty curve", ErrInvalidFade)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &fade{cancel: cancel, done: make(chan struct{})}
+
+	lc.fadeMu.Lock()
+	if lc.fades == nil {
+		lc.fades = make(map[string]*fade)
+	}
+	previous := lc.fades[id]
+	lc.fades[id] = f
+	lc.fadeMu.Unlock()
+
+	if previous != nil {
+		previous.cancel()
+		<-previous.done
+	}
+
+	go func() {
+		defer close(f.done)
+		defer func() {
+			lc.fadeMu.Lock()
+			if lc.fades[id] == f {
+				delete(lc.fades, id)
+			}
+			lc.fadeMu.Unlock()
+		}()
+		lc.runFade(ctx, id, curve, duration)
+	}()
+	return nil
+}
+
+// StopFade stops any fade running on a device, leaving the light as it is.
+// It returns true if a fade was stopped.
+func (lc *LIFXClient) StopFade(id string) bool {
+	lc.fadeMu.Lock()
+	f := lc.fades[id]
+	delete(lc.fades, id)
+	lc.fadeMu.Unlock()
+
+	if f == nil {
+		return false
+	}
+	f.cancel()
+	<-f.done
+	return true
+}
+
+// Fading returns true if a fade is running on a device.
+func (lc *LIFXClient) Fading(id string) bool {
+	lc.fadeMu.Lock()
+	defer lc.fadeMu.Unlock()
+	return lc.fades[id] != nil
+}
+
+func (lc *LIFXClient) runFade(ctx context.Context, id string, curve Curve, duration time.Duration) {
+	logger := logging.With("device", id, "duration", duration)
+	logger.Info("Starting fade")
+
+	step := duration / time.Duration(fadeSteps)
+	if step < minFadeStep {
+		step = minFadeStep
+	}
+	if step > maxFadeStep {
+		step = maxFadeStep
+	}
+
+	setColor := func(color lifxlan.Color, transition time.Duration) bool {
+		err := lc.SetColor(ctx, id, &color, uint32(transition.Milliseconds()))
+		if ctx.Err() != nil {
+			return false
+		}
+		if err != nil {
+			// Carry on, the next step may get through
+			logger.Warn("Fade step failed %s", err)
+		}
+		return true
+	}
+
+	if duration <= 0 {
+		if !setColor(curve.At(1), 0) {
+			return
+		}
+		lc.finishFade(ctx, id, curve)
+		return
+	}
+
+	// Jump to the start of the curve, then each step transitions to where
+	// the curve is at the end of the step
+	if !setColor(curve.At(0), 0) {
+		logger.Info("Fade stopped")
+		return
+	}
+	start := time.Now()
+	for elapsed := time.Duration(0); elapsed < duration; {
+		next := elapsed + step
+		if next > duration {
+			next = duration
+		}
+		if !setColor(curve.At(float64(next)/float64(duration)), next-elapsed) {
+			logger.Info("Fade stopped")
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Info("Fade stopped")
+			return
+		case <-time.After(time.Until(start.Add(next))):
+		}
+		elapsed = next
+	}
+
+	lc.finishFade(ctx, id, curve)
+	logger.Info("Fade finished")
+}
+
+// finishFade turns the light off if the curve ends with no brightness.
+func (lc *LIFXClient) finishFade(ctx context.Context, id string, curve Curve) {
+	if curve[len(curve)-1].Color.Brightness != 0 {
+		return
+	}
+	if err := lc.TurnOff(ctx, id, 0); err != nil {
+		logging.With("device", id).Warn("Failed to turn off after fade %s", err)
+	}
+}
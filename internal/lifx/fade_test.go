@@ -0,0 +1,160 @@
+package lifx_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/emulator"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"go.yhsif.com/lifxlan"
+)
+
+func TestCurve(t *testing.T) {
+	red := lifxlan.Color{Hue: 0, Saturation: 0xffff, Brightness: 0, Kelvin: 2500}
+	white := lifxlan.Color{Hue: 0x8000, Saturation: 0, Brightness: 0xffff, Kelvin: 6500}
+	curve := lifx.Curve{{At: 0.5, Color: red}, {At: 1, Color: white}}
+
+	tests := []struct {
+		name string
+		t    float64
+		want lifxlan.Color
+	}{
+		{"BeforeFirstStop", 0, red},
+		{"FirstStop", 0.5, red},
+		{"Halfway", 0.75, lifxlan.Color{Hue: 0, Saturation: 0x8000, Brightness: 0x8000, Kelvin: 4500}},
+		{"LastStop", 1, lifxlan.Color{Hue: 0, Saturation: 0, Brightness: 0xffff, Kelvin: 6500}},
+		{"AfterLastStop", 2, white},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := curve.At(tt.t); got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("HueWrapsAround", func(t *testing.T) {
+		curve := lifx.Curve{
+			{At: 0, Color: lifxlan.Color{Hue: 0xf000, Saturation: 0xffff}},
+			{At: 1, Color: lifxlan.Color{Hue: 0x1000, Saturation: 0xffff}},
+		}
+		if got := curve.At(0.5).Hue; got != 0 {
+			t.Errorf("Expected hue 0, got %#x", got)
+		}
+		if got := curve.At(0.25).Hue; got != 0xf800 {
+			t.Errorf("Expected hue 0xf800, got %#x", got)
+		}
+	})
+
+	t.Run("Presets", func(t *testing.T) {
+		if c := lifx.Sunrise.At(1); c.Saturation != 0 || c.Brightness != 0xffff {
+			t.Errorf("Expected sunrise to end bright white, got %+v", c)
+		}
+		if c := lifx.Sunset.At(1); c.Brightness != 0 {
+			t.Errorf("Expected sunset to end dark, got %+v", c)
+		}
+	})
+}
+
+func TestFade(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	lc, _, devices := startClient(t, emulator.Config{Label: "Bulb", Version: emulator.ProductA19})
+	bulb := devices[0]
+	id := deviceID(bulb)
+	ctx := context.Background()
+
+	duration := func(s string) *mqtt.Duration {
+		d, err := mqtt.ParseDuration(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &d
+	}
+	percent := func(p uint16) *uint16 { return &p }
+	red := "#ff0000"
+
+	t.Run("Stops", func(t *testing.T) {
+		err := lc.HandleCommand(ctx, id, &mqtt.Command{
+			Fade: &mqtt.Fade{Stops: []mqtt.FadeStop{
+				{Color: &red, Brightness: percent(10)},
+				{Color: &red, Brightness: percent(90)},
+			}},
+			Duration: duration("1s"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !lc.Fading(id) {
+			t.Fatalf("Expected a fade to be running")
+		}
+
+		// Some step part way through
+		eventually(t, "the fade to be part way", func() bool {
+			b := bulb.Color().Brightness
+			return b > 0x2000 && b < 0xd000
+		})
+		eventually(t, "the fade to finish", func() bool {
+			return !lc.Fading(id)
+		})
+		if c := bulb.Color(); c.Brightness < 0xe600 || c.Saturation != 0xffff || !bulb.Power().On() {
+			t.Errorf("Unexpected color %+v at the end", c)
+		}
+	})
+
+	t.Run("Sunset", func(t *testing.T) {
+		err := lc.HandleCommand(ctx, id, &mqtt.Command{Fade: &mqtt.Fade{Preset: "sunset"}, Duration: duration("PT0.5S")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, "the light to turn off", func() bool {
+			return !lc.Fading(id) && !bulb.Power().On()
+		})
+	})
+
+	t.Run("NewCommandStopsFade", func(t *testing.T) {
+		err := lc.HandleCommand(ctx, id, &mqtt.Command{Fade: &mqtt.Fade{Preset: "sunrise"}, Duration: duration("1m")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, "the light to turn on", func() bool {
+			return bulb.Power().On()
+		})
+
+		on := true
+		if err := lc.HandleCommand(ctx, id, &mqtt.Command{Power: &on, Duration: duration("0")}); err != nil {
+			t.Fatal(err)
+		}
+		if lc.Fading(id) {
+			t.Fatalf("Expected the fade to stop")
+		}
+
+		color := bulb.Color()
+		time.Sleep(700 * time.Millisecond)
+		if got := bulb.Color(); got != color {
+			t.Errorf("Expected the color to stay %+v, got %+v", color, got)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := map[string]*mqtt.Fade{
+			"NoStops":       {},
+			"UnknownPreset": {Preset: "noon"},
+			"BadColor":      {Stops: []mqtt.FadeStop{{Color: new(string)}}},
+			"BadBrightness": {Stops: []mqtt.FadeStop{{Brightness: percent(101)}}},
+		}
+		for name, fade := range tests {
+			t.Run(name, func(t *testing.T) {
+				err := lc.HandleCommand(ctx, id, &mqtt.Command{Fade: fade})
+				if !errors.Is(err, lifx.ErrInvalidFade) {
+					t.Errorf("Expected ErrInvalidFade, got %v", err)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,283 @@
+package lifx
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+
+	lifxmultizone "github.com/denwilliams/go-lifx-mqtt/internal/lifx/multizone"
+	lifxtile "github.com/denwilliams/go-lifx-mqtt/internal/lifx/tile"
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"go.yhsif.com/lifxlan"
+)
+
+var (
+	// firmwareEffectSpeeds are the default periods of effects run by
+	// devices
+	firmwareEffectSpeeds = map[string]time.Duration{
+		"morph": 3 * time.Second,
+		"flame": 4 * time.Second,
+		"sky":   30 * time.Second,
+		"move":  time.Second,
+	}
+	skyTypes = map[string]lifxtile.SkyType{
+		"sunrise": lifxtile.SkySunrise,
+		"sunset":  lifxtile.SkySunset,
+		"clouds":  lifxtile.SkyClouds,
+	}
+	moveDirections = map[string]lifxmultizone.Direction{
+		"right": lifxmultizone.DirectionRight,
+		"left":  lifxmultizone.DirectionLeft,
+	}
+)
+
+// firmwareEffect is an effect run by a tile or multizone device itself,
+// rather than rendered by the bridge. Only one of its args is set.
+type firmwareEffect struct {
+	tile      *lifxtile.SetEffectArgs
+	multizone *lifxmultizone.SetEffectArgs
+}
+
+// isFirmwareEffect returns true if name is an effect run by devices.
+func isFirmwareEffect(name string) bool {
+	_, ok := firmwareEffectSpeeds[strings.ToLower(name)]
+	return ok
+}
+
+// parseFirmwareEffect converts an effect command for an effect run by
+// devices.
+func parseFirmwareEffect(e *mqtt.Effect) (*firmwareEffect, error) {
+	colors, _, err := parseEffectColors(e)
+	if err != nil {
+		return nil, err
+	}
+	if len(colors) > lifxtile.MaxPaletteSize {
+		return nil, fmt.Errorf("%w: %d colors is over %d", ErrInvalidEffect, len(colors), lifxtile.MaxPaletteSize)
+	}
+
+	name := strings.ToLower(e.Name)
+	speed := effectPeriod(e, firmwareEffectSpeeds[name])
+
+	switch name {
+	case "morph":
+		return &firmwareEffect{tile: &lifxtile.SetEffectArgs{Type: lifxtile.EffectMorph, Speed: speed, Palette: colors}}, nil
+	case "flame":
+		return &firmwareEffect{tile: &lifxtile.SetEffectArgs{Type: lifxtile.EffectFlame, Speed: speed}}, nil
+	case "sky":
+		sky := lifxtile.SkySunrise
+		if e.Sky != "" {
+			var ok bool
+			if sky, ok = skyTypes[strings.ToLower(e.Sky)]; !ok {
+				return nil, fmt.Errorf("%w: unknown sky %q", ErrInvalidEffect, e.Sky)
+			}
+		}
+		return &firmwareEffect{tile: &lifxtile.SetEffectArgs{Type: lifxtile.EffectSky, Speed: speed, Sky: sky}}, nil
+	case "move":
+		direction := lifxmultizone.DirectionRight
+		if e.Direction != "" {
+			var ok bool
+			if direction, ok = moveDirections[strings.ToLower(e.Direction)]; !ok {
+				return nil, fmt.Errorf("%w: unknown direction %q", ErrInvalidEffect, e.Direction)
+			}
+		}
+		return &firmwareEffect{multizone: &lifxmultizone.SetEffectArgs{Type: lifxmultizone.EffectMove, Speed: speed, Direction: direction}}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown effect %q", ErrInvalidEffect, e.Name)
+}
+
+// StartFirmwareEffect turns a tile or multizone device on and starts an
+// effect that the device runs itself, until it is stopped.
+func (lc *LIFXClient) StartFirmwareEffect(ctx context.Context, id string, e *mqtt.Effect) error {
+	l := lc.devices.Get(id)
+	if l == nil {
+		return fmt.Errorf("%w: device %s", ErrNotFound, id)
+	}
+	effect, err := parseFirmwareEffect(e)
+	if err != nil {
+		return err
+	}
+	if effect.tile != nil && l.tile == nil {
+		return fmt.Errorf("%w: device %s is not a tile", ErrInvalidEffect, id)
+	}
+	if effect.multizone != nil && l.multizone == nil {
+		return fmt.Errorf("%w: device %s is not a strip", ErrInvalidEffect, id)
+	}
+
+	devicesControlled.WithLabelValues(l.lifxType.String(), "effect").Inc()
+	return lc.run(ctx, l, "SetFirmwareEffect", func(ctx context.Context) error {
+		return l.SetFirmwareEffect(ctx, lc.emitter, effect)
+	})
+}
+
+// StopFirmwareEffect stops the effect a device is running itself, leaving
+// it on the last frame. It returns true if an effect was stopped.
+func (lc *LIFXClient) StopFirmwareEffect(ctx context.Context, id string) bool {
+	l := lc.devices.Get(id)
+	if l == nil || !l.firmwareEffectRunning() {
+		return false
+	}
+
+	off := &firmwareEffect{}
+	if l.tile != nil {
+		off.tile = &lifxtile.SetEffectArgs{Type: lifxtile.EffectOff}
+	} else {
+		off.multizone = &lifxmultizone.SetEffectArgs{Type: lifxmultizone.EffectOff}
+	}
+	err := lc.run(ctx, l, "SetFirmwareEffect", func(ctx context.Context) error {
+		return l.SetFirmwareEffect(ctx, lc.emitter, off)
+	})
+	if err != nil {
+		logging.With("device", id).Warn("Failed to stop device effect %s", err)
+		return false
+	}
+	return true
+}
+
+// SetFirmwareEffect starts or stops an effect run by the device, turning it
+// on for effects that aren't off.
+func (l *lifxdevice) SetFirmwareEffect(ctx context.Context, emitter StatusEmitter, effect *firmwareEffect) error {
+	l.lock(ctx)
+	defer l.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	defer l.QueueRefresh(ctx, emitter, 100*time.Millisecond)
+
+	conn, err := l.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var on bool
+	var status *mqtt.Effect
+	switch {
+	case effect.tile != nil && l.tile != nil:
+		err = l.request(ctx, "SetTileEffect", func(ctx context.Context) error {
+			return l.tile.SetEffect(ctx, conn, effect.tile, true)
+		})
+		on = effect.tile.Type != lifxtile.EffectOff
+		status = toTileEffectPayload(&lifxtile.RawTileEffectSettings{
+			Type:         effect.tile.Type,
+			Speed:        uint32(effect.tile.Speed.Milliseconds()),
+			Parameters:   [32]byte{uint8(effect.tile.Sky)},
+			PaletteCount: uint8(len(effect.tile.Palette)),
+			Palette:      toPalette(effect.tile.Palette),
+		})
+	case effect.multizone != nil && l.multizone != nil:
+		err = l.request(ctx, "SetMultiZoneEffect", func(ctx context.Context) error {
+			return l.multizone.SetEffect(ctx, conn, effect.multizone, true)
+		})
+		on = effect.multizone.Type != lifxmultizone.EffectOff
+		status = toMultiZoneEffectPayload(&lifxmultizone.RawMultiZoneEffectPayload{
+			Type:       effect.multizone.Type,
+			Speed:      uint32(effect.multizone.Speed.Milliseconds()),
+			Parameters: [8]uint32{0, uint32(effect.multizone.Direction)},
+		})
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	l.setEffect(ctx, emitter, status)
+
+	if !on {
+		return nil
+	}
+	return l.request(ctx, "SetLightPower", func(ctx context.Context) error {
+		return l.light.SetLightPower(ctx, conn, lifxlan.PowerOn, 0, true)
+	})
+}
+
+// getEffect returns the effect the device is running itself. The caller
+// must hold l.mu.
+func (l *lifxdevice) getEffect(ctx context.Context, conn net.Conn) (*mqtt.Effect, error) {
+	if l.tile != nil {
+		raw, err := l.tile.GetEffect(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+		return toTileEffectPayload(raw), nil
+	}
+	raw, err := l.multizone.GetEffect(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	return toMultiZoneEffectPayload(raw), nil
+}
+
+// setEffect updates the cached firmware effect, emitting a status if it
+// changed. The caller must hold l.mu.
+func (l *lifxdevice) setEffect(ctx context.Context, emitter StatusEmitter, effect *mqtt.Effect) {
+	l.stateMu.Lock()
+	changed := !reflect.DeepEqual(l.effect, effect)
+	l.effect = effect
+	l.stateMu.Unlock()
+
+	if !changed {
+		return
+	}
+	l.logger().With("effect", effect.Name).Debug("Refreshed")
+	emitter.EmitStatus(ctx, l.id, "effect", effect)
+}
+
+// firmwareEffectRunning returns true if the device was last seen running an
+// effect itself.
+func (l *lifxdevice) firmwareEffectRunning() bool {
+	l.stateMu.RLock()
+	defer l.stateMu.RUnlock()
+	return l.effect != nil && l.effect.Name != "none"
+}
+
+// toTileEffectPayload converts a tile effect into the effect command that
+// starts it, named "none" if it is off.
+func toTileEffectPayload(raw *lifxtile.RawTileEffectSettings) *mqtt.Effect {
+	if raw.Type == lifxtile.EffectOff {
+		return &mqtt.Effect{Name: "none"}
+	}
+	period := mqtt.Duration(raw.Speed)
+	e := &mqtt.Effect{Name: raw.Type.String(), Period: &period}
+	switch raw.Type {
+	case lifxtile.EffectMorph:
+		for _, c := range raw.Colors() {
+			e.Colors = append(e.Colors, toHexColor(c))
+		}
+	case lifxtile.EffectSky:
+		for name, sky := range skyTypes {
+			if sky == raw.Sky() {
+				e.Sky = name
+			}
+		}
+	}
+	return e
+}
+
+// toMultiZoneEffectPayload converts a multizone effect into the effect
+// command that starts it, named "none" if it is off.
+func toMultiZoneEffectPayload(raw *lifxmultizone.RawMultiZoneEffectPayload) *mqtt.Effect {
+	if raw.Type == lifxmultizone.EffectOff {
+		return &mqtt.Effect{Name: "none"}
+	}
+	period := mqtt.Duration(raw.Speed)
+	e := &mqtt.Effect{Name: raw.Type.String(), Period: &period}
+	if raw.Type == lifxmultizone.EffectMove {
+		for name, direction := range moveDirections {
+			if direction == raw.Direction() {
+				e.Direction = name
+			}
+		}
+	}
+	return e
+}
+
+func toPalette(colors []lifxlan.Color) [lifxtile.MaxPaletteSize]lifxlan.Color {
+	var palette [lifxtile.MaxPaletteSize]lifxlan.Color
+	copy(palette[:], colors)
+	return palette
+}
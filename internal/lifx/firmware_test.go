@@ -0,0 +1,137 @@
+package lifx_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/emulator"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/multizone"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/tile"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+)
+
+func TestFirmwareEffects(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	lc, emitter, devices := startClient(t,
+		emulator.Config{Label: "Tiles", Version: emulator.ProductTile},
+		emulator.Config{Label: "Strip", Version: emulator.ProductStrip},
+		emulator.Config{Label: "Bulb", Version: emulator.ProductA19},
+	)
+	tiles, strip, bulb := devices[0], devices[1], devices[2]
+	ctx := context.Background()
+
+	command := func(t *testing.T, d *emulator.Device, payload string) error {
+		t.Helper()
+		var c mqtt.Command
+		if err := json.Unmarshal([]byte(payload), &c); err != nil {
+			t.Fatal(err)
+		}
+		return lc.HandleCommand(ctx, deviceID(d), &c)
+	}
+
+	t.Run("Morph", func(t *testing.T) {
+		if err := command(t, tiles, `{"effect": {"name": "morph", "colors": ["#ff0000", "#0000ff"], "period": "5s"}}`); err != nil {
+			t.Fatal(err)
+		}
+		effect := tiles.TileEffect()
+		if effect.Type != tile.EffectMorph || effect.SpeedDuration() != 5*time.Second || effect.PaletteCount != 2 {
+			t.Errorf("Expected a 5s morph with 2 colors, got %+v", effect)
+		}
+		if !tiles.Power().On() {
+			t.Errorf("Expected the effect to turn the tiles on")
+		}
+
+		s := lc.Device(deviceID(tiles))
+		if s.Effect == nil || s.Effect.Name != "morph" || strings.Join(s.Effect.Colors, ",") != "#ff0000,#0000ff" {
+			t.Errorf("Expected the morph to be reported, got %+v", s.Effect)
+		}
+		if !emitter.has(deviceID(tiles), "effect", nil) {
+			t.Errorf("Expected an effect status")
+		}
+	})
+
+	t.Run("Sky", func(t *testing.T) {
+		if err := command(t, tiles, `{"effect": {"name": "sky", "sky": "clouds"}}`); err != nil {
+			t.Fatal(err)
+		}
+		if effect := tiles.TileEffect(); effect.Type != tile.EffectSky || effect.Sky() != tile.SkyClouds {
+			t.Errorf("Expected a cloudy sky, got %+v", effect)
+		}
+	})
+
+	t.Run("Refresh", func(t *testing.T) {
+		// Started by someone else, eg: the LIFX app
+		td, err := tile.Wrap(ctx, tiles.LIFXDevice(), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := td.SetEffect(ctx, nil, &tile.SetEffectArgs{Type: tile.EffectFlame, Speed: 4 * time.Second}, true); err != nil {
+			t.Fatal(err)
+		}
+		if err := lc.Refresh(ctx, deviceID(tiles)); err != nil {
+			t.Fatal(err)
+		}
+		s := lc.Device(deviceID(tiles))
+		if s.Effect == nil || s.Effect.Name != "flame" || s.Effect.Period == nil || *s.Effect.Period != 4000 {
+			t.Errorf("Expected the flame to be reported, got %+v", s.Effect)
+		}
+	})
+
+	t.Run("OtherCommandStops", func(t *testing.T) {
+		if err := command(t, tiles, `{"color": "#00ff00", "duration": 0}`); err != nil {
+			t.Fatal(err)
+		}
+		if effect := tiles.TileEffect(); effect.Type != tile.EffectOff {
+			t.Errorf("Expected the effect to stop, got %+v", effect)
+		}
+		if s := lc.Device(deviceID(tiles)); s.Effect == nil || s.Effect.Name != "none" {
+			t.Errorf("Expected no effect to be reported, got %+v", s.Effect)
+		}
+	})
+
+	t.Run("Move", func(t *testing.T) {
+		if err := command(t, strip, `{"effect": {"name": "move", "direction": "left", "period": 2000}}`); err != nil {
+			t.Fatal(err)
+		}
+		effect := strip.MultiZoneEffect()
+		if effect.Type != multizone.EffectMove || effect.Direction() != multizone.DirectionLeft || effect.SpeedDuration() != 2*time.Second {
+			t.Errorf("Expected a 2s move to the left, got %+v", effect)
+		}
+
+		if err := command(t, strip, `{"effect": {"name": "none"}}`); err != nil {
+			t.Fatal(err)
+		}
+		if effect := strip.MultiZoneEffect(); effect.Type != multizone.EffectOff {
+			t.Errorf("Expected the effect to stop, got %+v", effect)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			device  *emulator.Device
+			payload string
+		}{
+			{"MorphOnBulb", bulb, `{"effect": {"name": "morph"}}`},
+			{"MoveOnTiles", tiles, `{"effect": {"name": "move"}}`},
+			{"Sky", tiles, `{"effect": {"name": "sky", "sky": "night"}}`},
+			{"Direction", strip, `{"effect": {"name": "move", "direction": "up"}}`},
+			{"Palette", tiles, `{"effect": {"name": "morph", "colors": ["#000001", "#000002", "#000003", "#000004", "#000005", "#000006", "#000007", "#000008", "#000009", "#00000a", "#00000b", "#00000c", "#00000d", "#00000e", "#00000f", "#000010", "#000011"]}}`},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if err := command(t, tt.device, tt.payload); !errors.Is(err, lifx.ErrInvalidEffect) {
+					t.Errorf("Expected ErrInvalidEffect, got %v", err)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package lifx
+
+import (
+	"time"
+)
+
+// Health summarises the state of discovery and the known devices.
+type Health struct {
+	Discovering   bool       `json:"discovering"`
+	LastDiscovery *time.Time `json:"last_discovery,omitempty"`
+	Known         int        `json:"known"`
+	Loaded        int        `json:"loaded"`
+	// Unreachable is the number of loaded devices not seen recently.
+	Unreachable int        `json:"unreachable"`
+	LastRefresh *time.Time `json:"last_refresh,omitempty"`
+}
+
+func (lc *LIFXClient) Health() *Health {
+	h := &Health{Discovering: lc.discovering.Load()}
+
+	lc.statusMu.Lock()
+	if !lc.lastDiscovery.IsZero() {
+		lastDiscovery := lc.lastDiscovery
+		h.LastDiscovery = &lastDiscovery
+	}
+	lc.statusMu.Unlock()
+
+	for _, l := range lc.devices.All() {
+		s := l.State()
+		h.Known++
+		if !s.Loaded {
+			continue
+		}
+		h.Loaded++
+		if s.LastSeen == nil || time.Since(*s.LastSeen) > onlineWindow {
+			h.Unreachable++
+		}
+
+		l.stateMu.RLock()
+		lastRefresh := l.lastRefresh
+		l.stateMu.RUnlock()
+		if !lastRefresh.IsZero() && (h.LastRefresh == nil || lastRefresh.After(*h.LastRefresh)) {
+			h.LastRefresh = &lastRefresh
+		}
+	}
+
+	return h
+}
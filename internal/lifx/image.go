@@ -0,0 +1,308 @@
+package lifx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net"
+	"strings"
+	"time"
+
+	lifxtile "github.com/denwilliams/go-lifx-mqtt/internal/lifx/tile"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"go.yhsif.com/lifxlan"
+)
+
+var (
+	// minFrameDelay is the shortest time an animation frame is shown for,
+	// GIFs often have delays of 0 meaning "as fast as possible"
+	minFrameDelay = time.Duration(float64(time.Second) / maxEffectFPS)
+	// defaultFrameDelay is used for GIF frames without a delay, as browsers
+	// do
+	defaultFrameDelay = 100 * time.Millisecond
+)
+
+// ErrInvalidImage is returned for images that can't be shown.
+var ErrInvalidImage = errors.New("invalid image")
+
+// Frame is one frame of an animation on a matrix device.
+type Frame struct {
+	Board lifxtile.ColorBoard
+	// Delay is how long the frame is shown for
+	Delay time.Duration
+}
+
+// ShowImage scales a picture to fit a matrix device's board and shows it,
+// or plays it if it is an animation.
+func (lc *LIFXClient) ShowImage(ctx context.Context, id string, img *mqtt.Image, duration uint32) error {
+	l := lc.devices.Get(id)
+	if l == nil {
+		return fmt.Errorf("%w: device %s", ErrNotFound, id)
+	}
+	if l.tile == nil {
+		return fmt.Errorf("%w: device %s is not a matrix device", ErrInvalidImage, id)
+	}
+
+	frames, loops, err := decodeImage(img, l.tile)
+	if err != nil {
+		return err
+	}
+	if len(frames) == 1 {
+		lc.StopEffect(id)
+		return lc.SetBoard(ctx, id, frames[0].Board, duration)
+	}
+	return lc.StartAnimation(ctx, id, frames, loops)
+}
+
+// StartAnimation turns a matrix device on and plays frames on it loops
+// times, or forever if loops is 0, until it is stopped. Like an effect,
+// frames are sent over a dedicated connection without waiting for acks and
+// any effect already running on the device is replaced. The last frame is
+// left showing when the animation finishes.
+func (lc *LIFXClient) StartAnimation(ctx context.Context, id string, frames []Frame, loops int) error {
+	l := lc.devices.Get(id)
+	if l == nil {
+		return fmt.Errorf("%w: device %s", ErrNotFound, id)
+	}
+	if l.tile == nil {
+		return fmt.Errorf("%w: device %s is not a matrix device", ErrInvalidImage, id)
+	}
+	if len(frames) == 0 {
+		return fmt.Errorf("%w: no frames", ErrInvalidImage)
+	}
+
+	lc.replaceEffect(id)
+
+	conn, err := l.dial(ctx)
+	if err != nil {
+		return err
+	}
+	err = l.request(ctx, "SetColors", func(ctx context.Context) error {
+		return l.tile.SetColors(ctx, conn, frames[0].Board, 0, true)
+	})
+	if err == nil {
+		err = l.request(ctx, "SetLightPower", func(ctx context.Context) error {
+			return l.tile.SetLightPower(ctx, conn, lifxlan.PowerOn, 0, true)
+		})
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	devicesControlled.WithLabelValues("tile", "animation").Inc()
+
+	lc.runInBackground(l, conn, &runningEffect{}, func(ctx context.Context) {
+		lc.runAnimation(ctx, l, conn, frames, loops)
+	})
+	return nil
+}
+
+func (lc *LIFXClient) runAnimation(ctx context.Context, l *lifxdevice, conn net.Conn, frames []Frame, loops int) {
+	logger := l.logger().With("frames", len(frames), "loops", loops)
+	logger.Info("Starting animation")
+
+	// The first frame is already showing
+	timer := time.NewTimer(frames[0].Delay)
+	defer timer.Stop()
+	for loop, i := 0, 1; ; i++ {
+		if i == len(frames) {
+			loop, i = loop+1, 0
+			if loops > 0 && loop == loops {
+				logger.Info("Animation finished")
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Info("Animation stopped")
+			return
+		case <-timer.C:
+		}
+
+		err := l.tile.SetColors(ctx, conn, frames[i].Board, 0, false)
+		if err != nil && ctx.Err() == nil {
+			// Carry on, the next frame may get through
+			logger.Debug("Animation frame failed %s", err)
+		}
+		timer.Reset(frames[i].Delay)
+	}
+}
+
+// decodeImage decodes an image command into frames scaled to board, and how
+// many times to play them, 0 for forever.
+func decodeImage(img *mqtt.Image, board lifxtile.Board) ([]Frame, int, error) {
+	if len(img.Data) == 0 {
+		return nil, 0, fmt.Errorf("%w: no data", ErrInvalidImage)
+	}
+	if img.Loops < 0 {
+		return nil, 0, fmt.Errorf("%w: loops %d is negative", ErrInvalidImage, img.Loops)
+	}
+
+	if strings.EqualFold(img.Format, "rgb") {
+		width, height := img.Width, img.Height
+		if width == 0 && height == 0 {
+			width, height = board.Width(), board.Height()
+		}
+		src, err := decodeRGB(img.Data, width, height)
+		if err != nil {
+			return nil, 0, err
+		}
+		return []Frame{{Board: scaleToBoard(src, board)}}, 1, nil
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(img.Data))
+	if err == nil && len(g.Image) > 1 {
+		var frames []Frame
+		for i, src := range gifFrames(g) {
+			delay := defaultFrameDelay
+			if i < len(g.Delay) && g.Delay[i] > 0 {
+				// In 100ths of a second
+				delay = time.Duration(g.Delay[i]) * 10 * time.Millisecond
+			}
+			if delay < minFrameDelay {
+				delay = minFrameDelay
+			}
+			frames = append(frames, Frame{Board: scaleToBoard(src, board), Delay: delay})
+		}
+
+		loops := img.Loops
+		if loops == 0 {
+			switch {
+			case g.LoopCount < 0:
+				loops = 1
+			case g.LoopCount > 0:
+				// The number of times to repeat after the first
+				loops = g.LoopCount + 1
+			}
+		}
+		return frames, loops, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %s", ErrInvalidImage, err)
+	}
+	return []Frame{{Board: scaleToBoard(src, board)}}, 1, nil
+}
+
+// decodeRGB converts raw RGB pixels, row by row from the top left, into an
+// image.
+func decodeRGB(data []byte, width int, height int) (image.Image, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("%w: raw pixels need a width and height", ErrInvalidImage)
+	}
+	if len(data) != width*height*3 {
+		return nil, fmt.Errorf("%w: %d bytes is not %dx%d RGB pixels", ErrInvalidImage, len(data), width, height)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < width*height; i++ {
+		copy(img.Pix[i*4:], data[i*3:i*3+3])
+		img.Pix[i*4+3] = 0xff
+	}
+	return img, nil
+}
+
+// gifFrames draws each frame of an animated GIF, which may only cover part
+// of the image, over the frames before it.
+func gifFrames(g *gif.GIF) []image.Image {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	for _, p := range g.Image {
+		bounds = bounds.Union(p.Bounds())
+	}
+
+	canvas := image.NewRGBA(bounds)
+	frames := make([]image.Image, len(g.Image))
+	for i, p := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = cloneRGBA(canvas)
+		}
+
+		draw.Draw(canvas, p.Bounds(), p, p.Bounds().Min, draw.Over)
+		frames[i] = cloneRGBA(canvas)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, p.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames
+}
+
+func cloneRGBA(img *image.RGBA) *image.RGBA {
+	c := image.NewRGBA(img.Bounds())
+	copy(c.Pix, img.Pix)
+	return c
+}
+
+// scaleToBoard stretches src over board, averaging the pixels that cover
+// each point on the board. Mostly transparent points, and points that
+// aren't on a tile, are left off.
+func scaleToBoard(src image.Image, board lifxtile.Board) lifxtile.ColorBoard {
+	width, height := board.Width(), board.Height()
+	cb := lifxtile.MakeColorBoard(width, height)
+
+	b := src.Bounds()
+	for x := 0; x < width; x++ {
+		x0 := b.Min.X + x*b.Dx()/width
+		x1 := b.Min.X + (x+1)*b.Dx()/width
+		if x1 <= x0 {
+			x1 = x0 + 1
+		}
+		for y := 0; y < height; y++ {
+			if !board.OnTile(x, y) {
+				continue
+			}
+			// The board's origin is the bottom left corner, the image's is
+			// the top left
+			row := height - 1 - y
+			y0 := b.Min.Y + row*b.Dy()/height
+			y1 := b.Min.Y + (row+1)*b.Dy()/height
+			if y1 <= y0 {
+				y1 = y0 + 1
+			}
+			if c := averageColor(src, image.Rect(x0, y0, x1, y1)); c != nil {
+				cb[x][y] = lifxlan.FromColor(c, 0)
+			}
+		}
+	}
+	return cb
+}
+
+// averageColor returns the average color of the pixels in r, or nil if they
+// are mostly transparent.
+func averageColor(src image.Image, r image.Rectangle) color.Color {
+	var sr, sg, sb, sa, n uint64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			// Alpha premultiplied
+			cr, cg, cb, ca := src.At(x, y).RGBA()
+			sr, sg, sb, sa = sr+uint64(cr), sg+uint64(cg), sb+uint64(cb), sa+uint64(ca)
+			n++
+		}
+	}
+	if n == 0 || sa/n < 0x8000 {
+		return nil
+	}
+	return color.RGBA64{
+		R: uint16(sr * 0xffff / sa),
+		G: uint16(sg * 0xffff / sa),
+		B: uint16(sb * 0xffff / sa),
+		A: 0xffff,
+	}
+}
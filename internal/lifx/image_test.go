@@ -0,0 +1,166 @@
+package lifx_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/png"
+	"testing"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/emulator"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"go.yhsif.com/lifxlan"
+)
+
+// encodePNG encodes pixels, given row by row from the top, as a PNG.
+func encodePNG(t *testing.T, rows ...[]color.Color) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x, c := range row {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// encodeGIF encodes an animation of single color frames, 50ms each.
+func encodeGIF(t *testing.T, loopCount int, colors ...color.Color) []byte {
+	t.Helper()
+	g := &gif.GIF{LoopCount: loopCount}
+	for _, c := range colors {
+		frame := image.NewPaletted(image.Rect(0, 0, 4, 4), palette.Plan9)
+		for i := range frame.Pix {
+			frame.Pix[i] = uint8(frame.Palette.Index(c))
+		}
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 5)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImages(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	lc, _, devices := startClient(t,
+		emulator.Config{Label: "Tiles", Version: emulator.ProductTile, Tiles: 2},
+		emulator.Config{Label: "Bulb", Version: emulator.ProductA19},
+	)
+	tiles, bulb := devices[0], devices[1]
+	id := deviceID(tiles)
+	ctx := context.Background()
+
+	red := color.RGBA{R: 0xff, A: 0xff}
+	green := color.RGBA{G: 0xff, A: 0xff}
+	blue := color.RGBA{B: 0xff, A: 0xff}
+	show := func(t *testing.T, img *mqtt.Image) error {
+		t.Helper()
+		return lc.HandleCommand(ctx, id, &mqtt.Command{Image: img})
+	}
+	// filled returns true if every pixel of the tile at index is c.
+	filled := func(index int, c color.Color) bool {
+		want := lifxlan.FromColor(c, 0)
+		for _, got := range tiles.TileColors(index) {
+			if got.Hue != want.Hue || got.Saturation != want.Saturation || got.Brightness != want.Brightness {
+				return false
+			}
+		}
+		return true
+	}
+
+	t.Run("Picture", func(t *testing.T) {
+		// Stretched over the two tiles side by side
+		if err := show(t, &mqtt.Image{Data: encodePNG(t, []color.Color{red, blue})}); err != nil {
+			t.Fatal(err)
+		}
+		if !filled(0, red) || !filled(1, blue) {
+			t.Errorf("Expected a red and a blue tile, got %+v and %+v", tiles.TileColors(0)[0], tiles.TileColors(1)[0])
+		}
+		if !tiles.Power().On() {
+			t.Errorf("Expected the tiles to be turned on")
+		}
+	})
+
+	t.Run("Transparent", func(t *testing.T) {
+		if err := show(t, &mqtt.Image{Data: encodePNG(t, []color.Color{color.Transparent, green})}); err != nil {
+			t.Fatal(err)
+		}
+		if !filled(0, color.Black) || !filled(1, green) {
+			t.Errorf("Expected an off and a green tile, got %+v and %+v", tiles.TileColors(0)[0], tiles.TileColors(1)[0])
+		}
+	})
+
+	t.Run("RawRGB", func(t *testing.T) {
+		if err := show(t, &mqtt.Image{Data: []byte{0, 0, 0xff}, Format: "rgb", Width: 1, Height: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if !filled(0, blue) || !filled(1, blue) {
+			t.Errorf("Expected blue tiles, got %+v", tiles.TileColors(0)[0])
+		}
+	})
+
+	t.Run("Animation", func(t *testing.T) {
+		// Played once
+		if err := show(t, &mqtt.Image{Data: encodeGIF(t, -1, red, green)}); err != nil {
+			t.Fatal(err)
+		}
+		if !lc.EffectRunning(id) {
+			t.Errorf("Expected the animation to be running")
+		}
+		eventually(t, "the animation to finish", func() bool {
+			return !lc.EffectRunning(id)
+		})
+		if !filled(0, green) || !filled(1, green) {
+			t.Errorf("Expected the last frame to be left showing, got %+v", tiles.TileColors(0)[0])
+		}
+	})
+
+	t.Run("OtherCommandStops", func(t *testing.T) {
+		if err := show(t, &mqtt.Image{Data: encodeGIF(t, 0, red, blue)}); err != nil {
+			t.Fatal(err)
+		}
+		power := false
+		if err := lc.HandleCommand(ctx, id, &mqtt.Command{Power: &power}); err != nil {
+			t.Fatal(err)
+		}
+		if lc.EffectRunning(id) {
+			t.Errorf("Expected the animation to stop")
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			device *emulator.Device
+			image  *mqtt.Image
+		}{
+			{"Bulb", bulb, &mqtt.Image{Data: encodePNG(t, []color.Color{red})}},
+			{"Empty", tiles, &mqtt.Image{}},
+			{"Garbage", tiles, &mqtt.Image{Data: []byte("not an image")}},
+			{"RawLength", tiles, &mqtt.Image{Data: []byte{1, 2, 3, 4}, Format: "rgb", Width: 1, Height: 1}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				err := lc.HandleCommand(ctx, deviceID(tt.device), &mqtt.Command{Image: tt.image})
+				if !errors.Is(err, lifx.ErrInvalidImage) {
+					t.Errorf("Expected ErrInvalidImage, got %v", err)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package lifx
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	lifxinfo "github.com/denwilliams/go-lifx-mqtt/internal/lifx/info"
+	"go.yhsif.com/lifxlan"
+)
+
+type infoPayload struct {
+	Label           string            `json:"label"`
+	Group           string            `json:"group"`
+	Location        string            `json:"location"`
+	VendorID        uint32            `json:"vendor_id"`
+	ProductID       uint32            `json:"product_id"`
+	ProductName     string            `json:"product_name"`
+	HardwareVersion uint32            `json:"hardware_version"`
+	Firmware        string            `json:"firmware"`
+	Features        *lifxlan.Features `json:"features"`
+	Signal          float32           `json:"signal"`
+	RSSI            int               `json:"rssi"`
+	Uptime          uint64            `json:"uptime"`
+	UpdatedAt       time.Time         `json:"updated_at"`
+}
+
+// UpdateInfo queries the slow changing metadata of the device (product,
+// firmware, wifi signal, uptime, label, group and location) and emits it as a
+// retained "info" status.
+func (l *lifxdevice) UpdateInfo(emitter StatusEmitter) error {
+	if l.device == nil || !l.loaded.Load() {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.logger().Debug("Updating info")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	conn, err := l.device.Dial()
+	if err != nil {
+		l.logger().Warn("Failed to dial %s", err)
+		return err
+	}
+	defer conn.Close()
+
+	d := lifxinfo.Wrap(l.device)
+
+	if err := d.GetLabel(ctx, conn); err != nil {
+		l.logger().Warn("Failed to get label %s", err)
+		return err
+	}
+	l.setLabel(d.Label().String())
+	if err := d.GetFirmware(ctx, conn); err != nil {
+		l.logger().Warn("Failed to get firmware %s", err)
+		return err
+	}
+	wifi, err := d.GetWifiInfo(ctx, conn)
+	if err != nil {
+		l.logger().Warn("Failed to get wifi info %s", err)
+		return err
+	}
+	info, err := d.GetInfo(ctx, conn)
+	if err != nil {
+		l.logger().Warn("Failed to get info %s", err)
+		return err
+	}
+	group, err := d.GetGroup(ctx, conn)
+	if err != nil {
+		l.logger().Warn("Failed to get group %s", err)
+		return err
+	}
+	location, err := d.GetLocation(ctx, conn)
+	if err != nil {
+		l.logger().Warn("Failed to get location %s", err)
+		return err
+	}
+
+	hw := d.HardwareVersion()
+	firmware := d.Firmware()
+	payload := &infoPayload{
+		Label:           d.Label().String(),
+		Group:           group.Label.String(),
+		Location:        location.Label.String(),
+		VendorID:        hw.VendorID,
+		ProductID:       hw.ProductID,
+		HardwareVersion: hw.HardwareVersion,
+		Firmware:        fmt.Sprintf("%d.%d", firmware.Major, firmware.Minor),
+		Signal:          wifi.Signal,
+		RSSI:            wifi.RSSI(),
+		Uptime:          uint64(info.UptimeDuration().Seconds()),
+		UpdatedAt:       time.Now().UTC(),
+	}
+	if l.product != nil {
+		features := l.product.FeaturesAt(*firmware)
+		payload.ProductName = l.product.ProductName
+		payload.Features = &features
+	}
+
+	l.stateMu.Lock()
+	l.info = payload
+	l.stateMu.Unlock()
+
+	if l.relay != nil {
+		if err := l.updateButtons(ctx, emitter, conn); err != nil {
+			l.logger().Warn("Failed to get buttons %s", err)
+		}
+	}
+	return emitter.EmitRetainedStatus(ctx, l.id, "info", payload)
+}
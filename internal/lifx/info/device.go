@@ -0,0 +1,47 @@
+package info
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"go.yhsif.com/lifxlan"
+)
+
+// Device is a wrapped lifxlan.Device that provides device information APIs.
+//
+// For all of the functions, if conn is nil,
+// a new connection will be made and guaranteed to be closed before returning.
+// You should pre-dial and pass in the conn if you plan to call APIs on this
+// device repeatedly.
+type Device interface {
+	lifxlan.Device
+
+	// GetWifiInfo returns the wifi signal of the device.
+	GetWifiInfo(ctx context.Context, conn net.Conn) (*RawStateWifiInfoPayload, error)
+
+	// GetInfo returns the device's time, uptime and downtime.
+	GetInfo(ctx context.Context, conn net.Conn) (*RawStateInfoPayload, error)
+
+	// GetLocation returns the location the device belongs to.
+	GetLocation(ctx context.Context, conn net.Conn) (*RawStateLocationPayload, error)
+
+	// GetGroup returns the group the device belongs to.
+	GetGroup(ctx context.Context, conn net.Conn) (*RawStateGroupPayload, error)
+}
+
+type device struct {
+	lifxlan.Device
+}
+
+var _ Device = (*device)(nil)
+
+func (id *device) String() string {
+	if label := id.Label().String(); label != lifxlan.EmptyLabel {
+		return fmt.Sprintf("%s(%v)", label, id.Target())
+	}
+	if parsed := id.HardwareVersion().Parse(); parsed != nil {
+		return fmt.Sprintf("%s(%v)", parsed.ProductName, id.Target())
+	}
+	return fmt.Sprintf("InfoDevice(%v)", id.Target())
+}
@@ -0,0 +1,7 @@
+// Package info implements LIFX LAN Protocol device information messages
+// (wifi signal, uptime, group and location):
+//
+// https://lan.developer.lifx.com/docs/querying-the-device-for-data
+//
+// Please refer to its parent package for more background/context.
+package info
@@ -0,0 +1,164 @@
+package info
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"net"
+	"time"
+
+	"go.yhsif.com/lifxlan"
+)
+
+// RawStateWifiInfoPayload defines the struct to be used for encoding and
+// decoding.
+//
+// https://lan.developer.lifx.com/docs/information-messages#statewifiinfo---packet-17
+type RawStateWifiInfoPayload struct {
+	Signal float32
+	_      [4]byte // reserved
+	_      [4]byte // reserved
+	_      [2]byte // reserved
+}
+
+// RSSI converts the raw signal into RSSI (dBm).
+//
+// https://lan.developer.lifx.com/docs/information-messages#statewifiinfo---packet-17
+func (raw RawStateWifiInfoPayload) RSSI() int {
+	if raw.Signal <= 0 {
+		return 0
+	}
+	return int(math.Floor(10*math.Log10(float64(raw.Signal)) + 0.5))
+}
+
+// RawStateInfoPayload defines the struct to be used for encoding and decoding.
+//
+// https://lan.developer.lifx.com/docs/information-messages#stateinfo---packet-35
+type RawStateInfoPayload struct {
+	Time     uint64 // nanoseconds since epoch
+	Uptime   uint64 // nanoseconds
+	Downtime uint64 // nanoseconds
+}
+
+// UptimeDuration returns the uptime as a time.Duration.
+func (raw RawStateInfoPayload) UptimeDuration() time.Duration {
+	return time.Duration(raw.Uptime)
+}
+
+// RawStateLocationPayload defines the struct to be used for encoding and
+// decoding.
+//
+// https://lan.developer.lifx.com/docs/information-messages#statelocation---packet-50
+type RawStateLocationPayload struct {
+	Location  [16]byte
+	Label     lifxlan.Label
+	UpdatedAt uint64
+}
+
+// ID returns the location id as a hex string.
+func (raw RawStateLocationPayload) ID() string {
+	return hex.EncodeToString(raw.Location[:])
+}
+
+// RawStateGroupPayload defines the struct to be used for encoding and
+// decoding.
+//
+// https://lan.developer.lifx.com/docs/information-messages#stategroup---packet-53
+type RawStateGroupPayload struct {
+	Group     [16]byte
+	Label     lifxlan.Label
+	UpdatedAt uint64
+}
+
+// ID returns the group id as a hex string.
+func (raw RawStateGroupPayload) ID() string {
+	return hex.EncodeToString(raw.Group[:])
+}
+
+func (id *device) GetWifiInfo(ctx context.Context, conn net.Conn) (*RawStateWifiInfoPayload, error) {
+	var raw RawStateWifiInfoPayload
+	if err := id.query(ctx, conn, GetWifiInfo, StateWifiInfo, &raw); err != nil {
+		return nil, err
+	}
+	return &raw, nil
+}
+
+func (id *device) GetInfo(ctx context.Context, conn net.Conn) (*RawStateInfoPayload, error) {
+	var raw RawStateInfoPayload
+	if err := id.query(ctx, conn, GetInfo, StateInfo, &raw); err != nil {
+		return nil, err
+	}
+	return &raw, nil
+}
+
+func (id *device) GetLocation(ctx context.Context, conn net.Conn) (*RawStateLocationPayload, error) {
+	var raw RawStateLocationPayload
+	if err := id.query(ctx, conn, GetLocation, StateLocation, &raw); err != nil {
+		return nil, err
+	}
+	return &raw, nil
+}
+
+func (id *device) GetGroup(ctx context.Context, conn net.Conn) (*RawStateGroupPayload, error) {
+	var raw RawStateGroupPayload
+	if err := id.query(ctx, conn, GetGroup, StateGroup, &raw); err != nil {
+		return nil, err
+	}
+	return &raw, nil
+}
+
+// query sends a payload-less get message and decodes the matching state
+// response into raw.
+func (id *device) query(
+	ctx context.Context,
+	conn net.Conn,
+	get lifxlan.MessageType,
+	state lifxlan.MessageType,
+	raw interface{},
+) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if conn == nil {
+		newConn, err := id.Dial()
+		if err != nil {
+			return err
+		}
+		defer newConn.Close()
+		conn = newConn
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	seq, err := id.Send(
+		ctx,
+		conn,
+		0, // flags
+		get,
+		nil, // payload
+	)
+	if err != nil {
+		return err
+	}
+
+	for {
+		resp, err := lifxlan.ReadNextResponse(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if resp.Sequence != seq || resp.Source != id.Source() {
+			continue
+		}
+		if resp.Message != state {
+			continue
+		}
+
+		r := bytes.NewReader(resp.Payload)
+		return binary.Read(r, binary.LittleEndian, raw)
+	}
+}
@@ -0,0 +1,154 @@
+package info_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/info"
+	"go.yhsif.com/lifxlan"
+	"go.yhsif.com/lifxlan/mock"
+)
+
+func replyWith(message lifxlan.MessageType, payload interface{}) mock.HandlerFunc {
+	return func(
+		s *mock.Service,
+		conn net.PacketConn,
+		addr net.Addr,
+		orig *lifxlan.Response,
+	) {
+		buf := new(bytes.Buffer)
+		if err := binary.Write(buf, binary.LittleEndian, payload); err != nil {
+			s.TB.Fatal(err)
+		}
+		s.Reply(conn, addr, orig, message, buf.Bytes())
+	}
+}
+
+// startService starts a mock service replying to message with handler. The
+// handler is set before the service starts reading its handlers.
+func startService(t *testing.T, message lifxlan.MessageType, handler mock.HandlerFunc) info.Device {
+	t.Helper()
+	service := &mock.Service{
+		TB:         t,
+		Handlers:   map[lifxlan.MessageType]mock.HandlerFunc{message: handler},
+		HandleAcks: true,
+	}
+	return info.Wrap(service.Start())
+}
+
+func TestGetInfo(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	const timeout = time.Millisecond * 200
+
+	t.Run(
+		"GetWifiInfo",
+		func(t *testing.T) {
+			id := startService(t, info.GetWifiInfo, replyWith(
+				info.StateWifiInfo,
+				&info.RawStateWifiInfoPayload{Signal: 1e-6},
+			))
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			raw, err := id.GetWifiInfo(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := raw.RSSI(), -60; got != want {
+				t.Errorf("RSSI expected %d, got %d", want, got)
+			}
+		},
+	)
+
+	t.Run(
+		"GetInfo",
+		func(t *testing.T) {
+			id := startService(t, info.GetInfo, replyWith(
+				info.StateInfo,
+				&info.RawStateInfoPayload{Uptime: uint64(time.Hour)},
+			))
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			raw, err := id.GetInfo(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := raw.UptimeDuration(), time.Hour; got != want {
+				t.Errorf("Uptime expected %v, got %v", want, got)
+			}
+		},
+	)
+
+	t.Run(
+		"GetGroup",
+		func(t *testing.T) {
+			var label lifxlan.Label
+			label.Set("Kitchen")
+			id := startService(t, info.GetGroup, replyWith(
+				info.StateGroup,
+				&info.RawStateGroupPayload{Group: [16]byte{0xab}, Label: label},
+			))
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			raw, err := id.GetGroup(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := raw.Label.String(), "Kitchen"; got != want {
+				t.Errorf("Label expected %q, got %q", want, got)
+			}
+			if got, want := raw.ID(), "ab000000000000000000000000000000"; got != want {
+				t.Errorf("ID expected %q, got %q", want, got)
+			}
+		},
+	)
+
+	t.Run(
+		"GetLocation",
+		func(t *testing.T) {
+			var label lifxlan.Label
+			label.Set("Home")
+			id := startService(t, info.GetLocation, replyWith(
+				info.StateLocation,
+				&info.RawStateLocationPayload{Label: label},
+			))
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			raw, err := id.GetLocation(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := raw.Label.String(), "Home"; got != want {
+				t.Errorf("Label expected %q, got %q", want, got)
+			}
+		},
+	)
+
+	t.Run(
+		"NoResponse",
+		func(t *testing.T) {
+			id := startService(t, info.GetWifiInfo, func(*mock.Service, net.PacketConn, net.Addr, *lifxlan.Response) {})
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			if _, err := id.GetWifiInfo(ctx, nil); err == nil {
+				t.Error("Expected error when not getting a response, got nil")
+			}
+		},
+	)
+}
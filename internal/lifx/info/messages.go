@@ -0,0 +1,17 @@
+package info
+
+import (
+	"go.yhsif.com/lifxlan"
+)
+
+// Device information related MessageType values.
+const (
+	GetWifiInfo   lifxlan.MessageType = 16
+	StateWifiInfo lifxlan.MessageType = 17
+	GetInfo       lifxlan.MessageType = 34
+	StateInfo     lifxlan.MessageType = 35
+	GetLocation   lifxlan.MessageType = 48
+	StateLocation lifxlan.MessageType = 50
+	GetGroup      lifxlan.MessageType = 51
+	StateGroup    lifxlan.MessageType = 53
+)
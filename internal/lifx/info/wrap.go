@@ -0,0 +1,16 @@
+package info
+
+import (
+	"go.yhsif.com/lifxlan"
+)
+
+// Wrap wraps a lifxlan.Device to provide device information APIs.
+func Wrap(d lifxlan.Device) Device {
+	if t, ok := d.(Device); ok {
+		return t
+	}
+
+	return &device{
+		Device: d,
+	}
+}
@@ -0,0 +1,317 @@
+package lifx_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/emulator"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/light"
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"go.yhsif.com/lifxlan"
+)
+
+type statusEvent struct {
+	id, key string
+	data    interface{}
+}
+
+type recordingEmitter struct {
+	mu     sync.Mutex
+	events []statusEvent
+}
+
+func (e *recordingEmitter) EmitStatus(ctx context.Context, id string, key string, data interface{}) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, statusEvent{id, key, data})
+	return nil
+}
+
+func (e *recordingEmitter) EmitRetainedStatus(ctx context.Context, id string, key string, data interface{}) error {
+	return e.EmitStatus(ctx, id, key, data)
+}
+
+// EmitEvent records events with their key prefixed by "event/".
+func (e *recordingEmitter) EmitEvent(ctx context.Context, id string, key string, data interface{}) error {
+	return e.EmitStatus(ctx, id, "event/"+key, data)
+}
+
+func (e *recordingEmitter) has(id string, key string, data interface{}) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, ev := range e.events {
+		if ev.id == id && ev.key == key && (data == nil || ev.data == data) {
+			return true
+		}
+	}
+	return false
+}
+
+// last returns the data of the last status emitted for id and key, or nil.
+func (e *recordingEmitter) last(id string, key string) interface{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := len(e.events) - 1; i >= 0; i-- {
+		if ev := e.events[i]; ev.id == id && ev.key == key {
+			return ev.data
+		}
+	}
+	return nil
+}
+
+// eventually waits up to 5 seconds for cond to be true.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("Timed out waiting for %s", what)
+}
+
+func deviceID(d *emulator.Device) string {
+	return strings.Replace(d.Target().String(), ":", "", -1)
+}
+
+// startClient starts an emulated device for each config, closed when the
+// test ends, and adds them to a new client recording what it publishes.
+// The devices are returned in the order of their configs.
+func startClient(t *testing.T, cfgs ...emulator.Config) (*lifx.LIFXClient, *recordingEmitter, []*emulator.Device) {
+	t.Helper()
+	logging.Init(&strings.Builder{}, 0)
+
+	emitter := &recordingEmitter{}
+	lc := lifx.NewClient(emitter)
+	devices := make([]*emulator.Device, len(cfgs))
+	for i, cfg := range cfgs {
+		d, err := emulator.Start(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { d.Close() })
+		if err := lc.Add(d.LIFXDevice()); err != nil {
+			t.Fatal(err)
+		}
+		devices[i] = d
+	}
+	return lc, emitter, devices
+}
+
+func TestEmulatedNetwork(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	logging.Init(&strings.Builder{}, 0)
+
+	network, err := emulator.NewNetwork(emulator.ListenAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { network.Close() })
+
+	add := func(cfg emulator.Config) *emulator.Device {
+		t.Helper()
+		d, err := network.Add(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	bulb := add(emulator.Config{Label: "Bulb", Group: "Kitchen", Version: emulator.ProductA19, Latency: 5 * time.Millisecond})
+	lamp := add(emulator.Config{Label: "Lamp", Group: "Kitchen", Version: emulator.ProductA19})
+	sw := add(emulator.Config{Label: "Switch", Version: emulator.ProductSwitch})
+	tiles := add(emulator.Config{Label: "Tiles", Version: emulator.ProductTile, Tiles: 2})
+	add(emulator.Config{Label: "Unreachable", Version: emulator.ProductA19, PacketLoss: 1})
+
+	emitter := &recordingEmitter{}
+	lc := lifx.NewClient(emitter)
+	lc.SetBroadcastAddr(network.Addr())
+
+	ctx := context.Background()
+	command := func(t *testing.T, id string, c *mqtt.Command) {
+		t.Helper()
+		duration := mqtt.Duration(0)
+		c.Duration = &duration
+		if err := lc.HandleCommand(ctx, id, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	on := true
+	off := false
+
+	t.Run("Discover", func(t *testing.T) {
+		if n := lc.DiscoverWithTimeout(500 * time.Millisecond); n != 4 {
+			t.Fatalf("Expected 4 devices, discovered %d", n)
+		}
+
+		lc.LoadDevices()
+		eventually(t, "devices to load", func() bool {
+			return lc.Health().Loaded == 4
+		})
+
+		types := map[string]string{
+			deviceID(bulb):  "light",
+			deviceID(sw):    "switch",
+			deviceID(tiles): "matrix",
+		}
+		for id, want := range types {
+			if s := lc.Device(id); s == nil || s.Type != want {
+				t.Errorf("Expected %s to be a %s, got %+v", id, want, s)
+			}
+		}
+		if s := lc.Device(deviceID(bulb)); s.Address != bulb.Addr() {
+			t.Errorf("Expected address %s, got %s", bulb.Addr(), s.Address)
+		}
+		if s := lc.Device(deviceID(tiles)); s.Width != 16 || s.Height != 8 {
+			t.Errorf("Expected a 16x8 board, got %dx%d", s.Width, s.Height)
+		}
+	})
+
+	t.Run("Power", func(t *testing.T) {
+		command(t, deviceID(bulb), &mqtt.Command{Power: &on})
+		if !bulb.Power().On() {
+			t.Errorf("Expected bulb to be on")
+		}
+		command(t, deviceID(bulb), &mqtt.Command{Power: &off})
+		if bulb.Power().On() {
+			t.Errorf("Expected bulb to be off")
+		}
+	})
+
+	t.Run("White", func(t *testing.T) {
+		brightness := uint16(50)
+		temp := uint16(3000)
+		command(t, deviceID(bulb), &mqtt.Command{Brightness: &brightness, Temperature: &temp})
+		c := bulb.Color()
+		if c.Kelvin != 3000 || c.Brightness < 0x7f00 || c.Brightness > 0x8100 || c.Saturation != 0 {
+			t.Errorf("Unexpected color %+v", c)
+		}
+		if !bulb.Power().On() {
+			t.Errorf("Expected bulb to be on")
+		}
+	})
+
+	t.Run("Color", func(t *testing.T) {
+		color := "#0000ff"
+		command(t, deviceID(bulb), &mqtt.Command{Color: &color})
+		c := bulb.Color()
+		if c.Hue < 0xaaa0 || c.Hue > 0xaab0 || c.Saturation != 0xffff {
+			t.Errorf("Unexpected color %+v", c)
+		}
+	})
+
+	t.Run("Waveform", func(t *testing.T) {
+		err := lc.SetWaveform(ctx, deviceID(bulb), &light.SetWaveformArgs{
+			Color:    &lifxlan.Color{Hue: 0x5555, Saturation: 0xffff, Brightness: 0xffff, Kelvin: 3500},
+			Period:   10 * time.Millisecond,
+			Cycles:   1,
+			Waveform: light.WaveformSine,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := bulb.Color(); c.Hue != 0x5555 {
+			t.Errorf("Unexpected color %+v", c)
+		}
+	})
+
+	t.Run("Relay", func(t *testing.T) {
+		command(t, deviceID(sw), &mqtt.Command{Relays: map[string]bool{"1": on}})
+		if !sw.RelayPower(1).On() || sw.RelayPower(0).On() {
+			t.Errorf("Expected only relay 1 to be on")
+		}
+	})
+
+	t.Run("Board", func(t *testing.T) {
+		board := make([][]string, 8)
+		for y := range board {
+			board[y] = make([]string, 16)
+			for x := range board[y] {
+				board[y][x] = "#00ff00"
+			}
+		}
+		command(t, deviceID(tiles), &mqtt.Command{Board: board})
+		for i := 0; i < 2; i++ {
+			for j, c := range tiles.TileColors(i) {
+				if c.Saturation != 0xffff || c.Brightness == 0 {
+					t.Fatalf("Unexpected color %+v at %d on tile %d", c, j, i)
+				}
+			}
+		}
+	})
+
+	t.Run("Group", func(t *testing.T) {
+		lc.RefreshInfo()
+		eventually(t, "group info", func() bool {
+			return len(lc.Groups()["Kitchen"]) == 2
+		})
+
+		command(t, "group/kitchen", &mqtt.Command{Power: &off})
+		if bulb.Power().On() || lamp.Power().On() {
+			t.Errorf("Expected the kitchen to be off")
+		}
+	})
+
+	t.Run("Transitions", func(t *testing.T) {
+		duration := func(s string) *mqtt.Duration {
+			d, err := mqtt.ParseDuration(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return &d
+		}
+		lc.SetTransitions(lifx.TransitionConfig{
+			Default: lifx.Transition{PowerOff: duration("5s")},
+			Devices: map[string]lifx.Transition{strings.ToUpper(deviceID(lamp)): {PowerOn: duration("PT30S")}},
+			Groups:  map[string]lifx.Transition{"kitchen": {Duration: duration("3s")}},
+		})
+		t.Cleanup(func() { lc.SetTransitions(lifx.TransitionConfig{}) })
+
+		red := "#ff0000"
+		tests := []struct {
+			name    string
+			device  *emulator.Device
+			command *mqtt.Command
+			want    time.Duration
+		}{
+			{"Device", lamp, &mqtt.Command{Power: &on}, 30 * time.Second},
+			{"DeviceFallsBackToGroup", lamp, &mqtt.Command{Power: &off}, 3 * time.Second},
+			{"Group", bulb, &mqtt.Command{Color: &red}, 3 * time.Second},
+			{"Default", tiles, &mqtt.Command{Power: &off}, 5 * time.Second},
+			{"Builtin", tiles, &mqtt.Command{Power: &on}, 1500 * time.Millisecond},
+			{"Command", bulb, &mqtt.Command{Power: &off, Duration: duration("2s")}, 2 * time.Second},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if err := lc.HandleCommand(ctx, deviceID(tt.device), tt.command); err != nil {
+					t.Fatal(err)
+				}
+				if got := tt.device.Transition(); got != tt.want {
+					t.Errorf("Expected a %s transition, got %s", tt.want, got)
+				}
+			})
+		}
+	})
+
+	t.Run("Refresh", func(t *testing.T) {
+		lamp.SetPower(lifxlan.PowerOn)
+		lc.RefreshDevices()
+		eventually(t, "lamp to refresh", func() bool {
+			return lc.Device(deviceID(lamp)).Power
+		})
+		if !emitter.has(deviceID(lamp), "power", true) {
+			t.Errorf("Expected power status to be emitted")
+		}
+	})
+
+	t.Run("UnknownDevice", func(t *testing.T) {
+		command(t, "d073d5ffffff", &mqtt.Command{Power: &on})
+	})
+}
@@ -0,0 +1,78 @@
+package lifx
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"go.yhsif.com/lifxlan"
+)
+
+// ListenForState listens on the LIFX port for unsolicited State* messages
+// broadcast by devices (eg: when changed from the LIFX app or a wall switch)
+// and emits the changes. It blocks until ctx is cancelled.
+//
+// Discovery needs the same port, so the listener steps aside while a
+// discovery is running.
+func (lc *LIFXClient) ListenForState(ctx context.Context) {
+	for ctx.Err() == nil {
+		if lc.discovering.Load() {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		addr := ":" + lifxlan.DefaultBroadcastPort
+		if lc.listenAddr != "" {
+			addr = lc.listenAddr
+		}
+		lc.portMu.Lock()
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			lc.portMu.Unlock()
+			logging.Warn("Unable to listen for state messages %s", err)
+			time.Sleep(10 * time.Second)
+			continue
+		}
+
+		logging.Debug("Listening for state messages")
+		lc.readState(ctx, conn)
+		conn.Close()
+		lc.portMu.Unlock()
+	}
+}
+
+// readState handles incoming messages until ctx is cancelled, a discovery
+// starts or the connection fails.
+func (lc *LIFXClient) readState(ctx context.Context, conn net.PacketConn) {
+	buf := make([]byte, lifxlan.ResponseReadBufferSize)
+	for ctx.Err() == nil && !lc.discovering.Load() {
+		if err := conn.SetReadDeadline(lifxlan.GetReadDeadline()); err != nil {
+			logging.Warn("Error listening for state messages %s", err)
+			return
+		}
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if lifxlan.CheckTimeoutError(err) {
+				continue
+			}
+			logging.Warn("Error listening for state messages %s", err)
+			return
+		}
+
+		resp, err := lifxlan.ParseResponse(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		key := strings.Replace(resp.Target.String(), ":", "", -1)
+		l := lc.devices.Get(key)
+		if l == nil || !l.loaded.Load() {
+			continue
+		}
+		if l.HandleState(lc.emitter, resp) {
+			logging.With("device", key, "message", uint16(resp.Message)).Debug("Received state message")
+		}
+	}
+}
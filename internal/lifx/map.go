@@ -1,9 +1,25 @@
 package lifx
 
-type deviceMap map[string]*lifxdevice
+import (
+	"sort"
+	"sync"
+)
+
+// deviceMap is a set of devices keyed by id that is safe for concurrent use.
+type deviceMap struct {
+	mu      sync.RWMutex
+	devices map[string]*lifxdevice
+}
+
+func newDeviceMap() *deviceMap {
+	return &deviceMap{devices: make(map[string]*lifxdevice)}
+}
 
 func (lm *deviceMap) Get(id string) *lifxdevice {
-	b, ok := (*lm)[id]
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	b, ok := lm.devices[id]
 	if !ok {
 		return nil
 	}
@@ -12,14 +28,43 @@ func (lm *deviceMap) Get(id string) *lifxdevice {
 }
 
 func (lm *deviceMap) Set(id string, l *lifxdevice) {
-	(*lm)[id] = l
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	lm.devices[id] = l
 }
 
 func (lm *deviceMap) Delete(id string) {
-	delete(*lm, id)
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	delete(lm.devices, id)
 }
 
 func (lm *deviceMap) Has(id string) bool {
-	_, exists := (*lm)[id]
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	_, exists := lm.devices[id]
 	return exists
 }
+
+func (lm *deviceMap) Len() int {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	return len(lm.devices)
+}
+
+// All returns a snapshot of the devices, sorted by id.
+func (lm *deviceMap) All() []*lifxdevice {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+
+	all := make([]*lifxdevice, 0, len(lm.devices))
+	for _, l := range lm.devices {
+		all = append(all, l)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].id < all[j].id })
+	return all
+}
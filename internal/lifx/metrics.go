@@ -1,13 +1,123 @@
 package lifx
 
 import (
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+// onlineWindow is how recently a device must have responded to count as
+// online.
+const onlineWindow = 3 * time.Minute
+
 var (
 	devicesControlled = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "lifx_devices_controlled_total",
 		Help: "The total number of LIFX devices controlled",
 	}, []string{"device_type", "on_state"})
+
+	devicesGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "lifx_devices",
+		Help: "The number of LIFX devices by status (known, loaded, online) and product",
+	}, []string{"status", "product"})
+
+	devicePower = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "lifx_device_power",
+		Help: "The power state of each LIFX device (1 on, 0 off)",
+	}, []string{"id"})
+
+	deviceBrightness = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "lifx_device_brightness_percent",
+		Help: "The brightness of each LIFX light",
+	}, []string{"id"})
+
+	commandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "lifx_command_duration_seconds",
+		Help:    "The time taken to run commands against LIFX devices",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"command"})
+
+	refreshDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "lifx_refresh_duration_seconds",
+		Help:    "The time taken to refresh the state of a LIFX device",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	lifxTimeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "lifx_timeouts_total",
+		Help: "The total number of LIFX requests that timed out",
+	}, []string{"id"})
+
+	discoveryRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "lifx_discovery_runs_total",
+		Help: "The total number of discovery runs by result (ok, error, aborted)",
+	}, []string{"result"})
+
+	discoveryDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "lifx_discovery_duration_seconds",
+		Help:    "The time taken by discovery runs",
+		Buckets: []float64{1, 5, 15, 30, 60, 120},
+	})
+
+	discoveryFound = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "lifx_discovery_devices_found_total",
+		Help: "The total number of new LIFX devices found by discovery",
+	})
 )
+
+// deviceCounts are the known, loaded and online devices of a product.
+type deviceCounts struct {
+	known, loaded, online float64
+}
+
+// updateDeviceMetrics recalculates the device count gauges. The counts are
+// worked out before any gauge is set, so a scrape never sees part of them.
+func (lc *LIFXClient) updateDeviceMetrics() {
+	counts := make(map[string]*deviceCounts)
+	for _, s := range lc.Devices() {
+		product := s.Product
+		if product == "" {
+			product = "unknown"
+		}
+		c := counts[product]
+		if c == nil {
+			c = &deviceCounts{}
+			counts[product] = c
+		}
+		c.known++
+		if s.Loaded {
+			c.loaded++
+		}
+		if s.LastSeen != nil && time.Since(*s.LastSeen) < onlineWindow {
+			c.online++
+		}
+	}
+
+	lc.metricsMu.Lock()
+	defer lc.metricsMu.Unlock()
+	for product, c := range counts {
+		devicesGauge.WithLabelValues("known", product).Set(c.known)
+		devicesGauge.WithLabelValues("loaded", product).Set(c.loaded)
+		devicesGauge.WithLabelValues("online", product).Set(c.online)
+	}
+	// Products no longer seen are removed rather than left at their last count
+	for product := range lc.products {
+		if counts[product] == nil {
+			devicesGauge.DeleteLabelValues("known", product)
+			devicesGauge.DeleteLabelValues("loaded", product)
+			devicesGauge.DeleteLabelValues("online", product)
+		}
+	}
+	lc.products = make(map[string]bool, len(counts))
+	for product := range counts {
+		lc.products[product] = true
+	}
+}
+
+func powerMetric(on bool) float64 {
+	if on {
+		return 1
+	}
+	return 0
+}
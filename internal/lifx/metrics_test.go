@@ -0,0 +1,108 @@
+package lifx_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/emulator"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.yhsif.com/lifxlan"
+)
+
+// metricValue returns the value of the gauge or counter name with labels, or
+// the number of observations of a histogram, and false if there isn't one.
+func metricValue(t *testing.T, name string, labels map[string]string) (float64, bool) {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if v, ok := labels[l.GetName()]; ok && v != l.GetValue() {
+					continue metrics
+				}
+			}
+			switch {
+			case m.Gauge != nil:
+				return m.GetGauge().GetValue(), true
+			case m.Counter != nil:
+				return m.GetCounter().GetValue(), true
+			case m.Histogram != nil:
+				return float64(m.GetHistogram().GetSampleCount()), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func TestMetrics(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	lc, _, devices := startClient(t, emulator.Config{Label: "Bulb", Version: emulator.ProductA19})
+	bulb := devices[0]
+	id := deviceID(bulb)
+	ctx := context.Background()
+
+	value := func(name string, labels map[string]string) float64 {
+		t.Helper()
+		v, _ := metricValue(t, name, labels)
+		return v
+	}
+
+	t.Run("Command", func(t *testing.T) {
+		controlled := value("lifx_devices_controlled_total", map[string]string{"device_type": "light", "on_state": "on"})
+		commands := value("lifx_command_duration_seconds", map[string]string{"command": "TurnOn"})
+
+		power := true
+		if err := lc.HandleCommand(ctx, id, &mqtt.Command{Power: &power}); err != nil {
+			t.Fatal(err)
+		}
+		if !bulb.Power().On() {
+			t.Fatalf("Expected the bulb to be turned on")
+		}
+		if got := value("lifx_devices_controlled_total", map[string]string{"device_type": "light", "on_state": "on"}); got != controlled+1 {
+			t.Errorf("Expected %v controlled, got %v", controlled+1, got)
+		}
+		if got := value("lifx_command_duration_seconds", map[string]string{"command": "TurnOn"}); got != commands+1 {
+			t.Errorf("Expected %v TurnOn commands timed, got %v", commands+1, got)
+		}
+	})
+
+	t.Run("Refresh", func(t *testing.T) {
+		bulb.SetColor(lifxlan.Color{Brightness: 0x8000, Kelvin: 2700})
+		refreshes := value("lifx_refresh_duration_seconds", nil)
+
+		if err := lc.Refresh(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+		if got := value("lifx_refresh_duration_seconds", nil); got != refreshes+1 {
+			t.Errorf("Expected %v refreshes timed, got %v", refreshes+1, got)
+		}
+		if got := value("lifx_device_power", map[string]string{"id": id}); got != 1 {
+			t.Errorf("Expected the power gauge to be 1, got %v", got)
+		}
+		if got := value("lifx_device_brightness_percent", map[string]string{"id": id}); got != 50 {
+			t.Errorf("Expected the brightness gauge to be 50, got %v", got)
+		}
+	})
+
+	t.Run("Devices", func(t *testing.T) {
+		lc.RefreshDevices()
+		product := lc.Device(id).Product
+		for _, status := range []string{"known", "loaded", "online"} {
+			v, ok := metricValue(t, "lifx_devices", map[string]string{"status": status, "product": product})
+			if !ok || v != 1 {
+				t.Errorf("Expected 1 %s %s, got %v", status, product, v)
+			}
+		}
+	})
+}
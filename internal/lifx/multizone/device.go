@@ -0,0 +1,54 @@
+package multizone
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/light"
+	"go.yhsif.com/lifxlan"
+)
+
+// Device is a wrapped light device that provides multizone related APIs.
+type Device interface {
+	light.Device
+
+	// GetEffect returns the firmware effect running on this multizone device.
+	//
+	// If conn is nil,
+	// a new connection will be made and guaranteed to be closed before returning.
+	// You should pre-dial and pass in the conn if you plan to call APIs on this
+	// device repeatedly.
+	GetEffect(ctx context.Context, conn net.Conn) (*RawMultiZoneEffectPayload, error)
+
+	// SetEffect starts a firmware effect on this multizone device, or stops it
+	// with EffectOff.
+	//
+	// If conn is nil,
+	// a new connection will be made and guaranteed to be closed before returning.
+	// You should pre-dial and pass in the conn if you plan to call APIs on this
+	// device repeatedly.
+	//
+	// If ack is false,
+	// this function returns nil error after the API is sent successfully.
+	// If ack is true,
+	// this function will only return nil error after it received ack from the
+	// device.
+	SetEffect(ctx context.Context, conn net.Conn, args *SetEffectArgs, ack bool) error
+}
+
+type device struct {
+	light.Device
+}
+
+var _ Device = (*device)(nil)
+
+func (md *device) String() string {
+	if label := md.Label().String(); label != lifxlan.EmptyLabel {
+		return fmt.Sprintf("%s(%v)", label, md.Target())
+	}
+	if parsed := md.HardwareVersion().Parse(); parsed != nil {
+		return fmt.Sprintf("%s(%v)", parsed.ProductName, md.Target())
+	}
+	return fmt.Sprintf("MultiZoneDevice(%v)", md.Target())
+}
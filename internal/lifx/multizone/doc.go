@@ -0,0 +1,9 @@
+// Package multizone implements LIFX LAN Protocol for LIFX multizone devices
+// (strips and beams):
+//
+// https://lan.developer.lifx.com/docs/multizone-effects
+//
+// A multizone device is also a light device and implements all light APIs.
+//
+// Please refer to its parent package for more background/context.
+package multizone
@@ -0,0 +1,194 @@
+package multizone
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"time"
+
+	"go.yhsif.com/lifxlan"
+)
+
+// EffectType defines the type of a firmware effect.
+//
+// https://lan.developer.lifx.com/docs/multizone-effects
+type EffectType uint8
+
+// EffectType values.
+const (
+	EffectOff  EffectType = 0
+	EffectMove EffectType = 1
+)
+
+func (t EffectType) String() string {
+	switch t {
+	case EffectOff:
+		return "off"
+	case EffectMove:
+		return "move"
+	}
+	return "unknown"
+}
+
+// Direction defines which way EffectMove moves along the strip.
+type Direction uint32
+
+// Direction values.
+const (
+	DirectionRight Direction = 0
+	DirectionLeft  Direction = 1
+)
+
+// RawMultiZoneEffectPayload defines the struct to be used for encoding and
+// decoding, it's used by both SetMultiZoneEffect and StateMultiZoneEffect.
+//
+// https://lan.developer.lifx.com/docs/changing-a-device#setmultizoneeffect---packet-508
+type RawMultiZoneEffectPayload struct {
+	InstanceID uint32
+	Type       EffectType
+	_          [2]byte // reserved
+	Speed      uint32  // milliseconds
+	Duration   uint64  // nanoseconds, 0 for forever
+	_          [4]byte // reserved
+	_          [4]byte // reserved
+	Parameters [8]uint32
+}
+
+// SpeedDuration returns the speed as a time.Duration.
+func (raw RawMultiZoneEffectPayload) SpeedDuration() time.Duration {
+	return time.Duration(raw.Speed) * time.Millisecond
+}
+
+// Direction returns the direction parameter of EffectMove.
+func (raw RawMultiZoneEffectPayload) Direction() Direction {
+	return Direction(raw.Parameters[1])
+}
+
+// SetEffectArgs is the args to be translated into RawMultiZoneEffectPayload.
+type SetEffectArgs struct {
+	// Type of effect, EffectOff stops the running effect.
+	Type EffectType
+
+	// Speed is how long one cycle of the effect takes.
+	Speed time.Duration
+
+	// Duration is how long the effect runs for, 0 means forever.
+	Duration time.Duration
+
+	// Direction is which way EffectMove moves.
+	Direction Direction
+}
+
+func (md *device) GetEffect(ctx context.Context, conn net.Conn) (*RawMultiZoneEffectPayload, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if conn == nil {
+		newConn, err := md.Dial()
+		if err != nil {
+			return nil, err
+		}
+		defer newConn.Close()
+		conn = newConn
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	seq, err := md.Send(
+		ctx,
+		conn,
+		0, // flags
+		GetMultiZoneEffect,
+		nil, // payload
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		resp, err := lifxlan.ReadNextResponse(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Sequence != seq || resp.Source != md.Source() {
+			continue
+		}
+
+		switch resp.Message {
+		case StateMultiZoneEffect:
+			var raw RawMultiZoneEffectPayload
+			r := bytes.NewReader(resp.Payload)
+			if err := binary.Read(r, binary.LittleEndian, &raw); err != nil {
+				return nil, err
+			}
+			return &raw, nil
+
+		case lifxlan.StateUnhandled:
+			// Firmware without effects
+			var raw lifxlan.RawStateUnhandledPayload
+			r := bytes.NewReader(resp.Payload)
+			if err := binary.Read(r, binary.LittleEndian, &raw); err != nil {
+				return nil, err
+			}
+			return nil, raw
+		}
+	}
+}
+
+func (md *device) SetEffect(
+	ctx context.Context,
+	conn net.Conn,
+	args *SetEffectArgs,
+	ack bool,
+) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if conn == nil {
+		newConn, err := md.Dial()
+		if err != nil {
+			return err
+		}
+		defer newConn.Close()
+		conn = newConn
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	payload := &RawMultiZoneEffectPayload{
+		Type:     args.Type,
+		Speed:    uint32(args.Speed.Milliseconds()),
+		Duration: uint64(args.Duration),
+	}
+	if args.Type == EffectMove {
+		payload.Parameters[1] = uint32(args.Direction)
+	}
+
+	var flags lifxlan.AckResFlag
+	if ack {
+		flags |= lifxlan.FlagAckRequired
+	}
+
+	seq, err := md.Send(
+		ctx,
+		conn,
+		flags,
+		SetMultiZoneEffect,
+		payload,
+	)
+	if err != nil {
+		return err
+	}
+
+	if ack {
+		return lifxlan.WaitForAcks(ctx, conn, md.Source(), seq)
+	}
+	return nil
+}
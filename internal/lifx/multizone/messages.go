@@ -0,0 +1,12 @@
+package multizone
+
+import (
+	"go.yhsif.com/lifxlan"
+)
+
+// Multizone related MessageType values.
+const (
+	GetMultiZoneEffect   lifxlan.MessageType = 507
+	SetMultiZoneEffect   lifxlan.MessageType = 508
+	StateMultiZoneEffect lifxlan.MessageType = 509
+)
@@ -0,0 +1,19 @@
+package multizone
+
+import (
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/light"
+)
+
+// Wrap wraps a light device to provide multizone APIs.
+//
+// It doesn't check the device supports them, callers should check the
+// product's multizone feature first.
+func Wrap(d light.Device) Device {
+	if t, ok := d.(Device); ok {
+		return t
+	}
+
+	return &device{
+		Device: d,
+	}
+}
@@ -0,0 +1,147 @@
+package lifx
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"time"
+
+	lifxlight "github.com/denwilliams/go-lifx-mqtt/internal/lifx/light"
+	lifxrelay "github.com/denwilliams/go-lifx-mqtt/internal/lifx/relay"
+	"go.yhsif.com/lifxlan"
+)
+
+// Poll cheaply reads the current power and color (or relay power) of the
+// device and emits any changes.
+//
+// Unlike Refresh, all of the requests are sent up front on a single
+// long-lived connection and the responses read back as they arrive. If the
+// device is busy (eg: handling a command) the poll is skipped.
+func (l *lifxdevice) Poll(emitter StatusEmitter, timeout time.Duration) error {
+	if l.device == nil || !l.loaded.Load() {
+		return nil
+	}
+
+	if !l.mu.TryLock() {
+		return nil
+	}
+	defer l.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if l.pollConn == nil {
+		conn, err := l.device.Dial()
+		if err != nil {
+			l.logger().Warn("Failed to dial %s", err)
+			return err
+		}
+		l.pollConn = conn
+	}
+
+	pending := make(map[uint8]bool)
+	send := func(message lifxlan.MessageType, payload interface{}) error {
+		seq, err := l.device.Send(ctx, l.pollConn, 0, message, payload)
+		if err != nil {
+			return err
+		}
+		pending[seq] = true
+		return nil
+	}
+
+	var err error
+	if l.light != nil {
+		// LightState includes the power level so there is no need for GetPower
+		err = send(lifxlight.Get, nil)
+	} else {
+		err = send(lifxlan.GetPower, nil)
+	}
+	if l.relay != nil {
+		for i := range l.relayPower {
+			if err != nil {
+				break
+			}
+			err = send(lifxrelay.GetRPower, &lifxrelay.RawGetRPowerPayload{Index: uint8(i)})
+		}
+	}
+
+	for err == nil && len(pending) > 0 {
+		var resp *lifxlan.Response
+		resp, err = lifxlan.ReadNextResponse(ctx, l.pollConn)
+		if err != nil {
+			break
+		}
+		if resp.Source != l.device.Source() || !pending[resp.Sequence] {
+			continue
+		}
+		delete(pending, resp.Sequence)
+		l.handleState(ctx, emitter, resp)
+	}
+
+	if err != nil {
+		// Start afresh next time in case the connection is in a bad state
+		l.pollConn.Close()
+		l.pollConn = nil
+		if isTimeout(err) {
+			lifxTimeouts.WithLabelValues(l.id).Inc()
+		}
+		l.logger().Debug("Failed to poll %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// HandleState updates the cached state from a State* message sent by the
+// device, emitting any changes.
+func (l *lifxdevice) HandleState(emitter StatusEmitter, resp *lifxlan.Response) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return l.handleState(ctx, emitter, resp)
+}
+
+// handleState decodes a StatePower, LightState or StateRPower message.
+// It returns false for any other message. The caller must hold l.mu.
+func (l *lifxdevice) handleState(ctx context.Context, emitter StatusEmitter, resp *lifxlan.Response) bool {
+	r := bytes.NewReader(resp.Payload)
+
+	switch resp.Message {
+	case lifxlan.StatePower:
+		var raw lifxlan.RawStatePowerPayload
+		if err := binary.Read(r, binary.LittleEndian, &raw); err != nil {
+			return false
+		}
+		l.setPower(ctx, emitter, raw.Level)
+
+	case lifxlight.State:
+		var raw lifxlight.RawStatePayload
+		if err := binary.Read(r, binary.LittleEndian, &raw); err != nil {
+			return false
+		}
+		*l.device.Label() = raw.Label
+		l.setLabel(raw.Label.String())
+		color := raw.Color
+		l.setPower(ctx, emitter, raw.Power)
+		l.setColor(ctx, emitter, &color)
+
+	case lifxrelay.StateRPower:
+		var raw lifxrelay.RawStateRPowerPayload
+		if err := binary.Read(r, binary.LittleEndian, &raw); err != nil {
+			return false
+		}
+		toggled := int(raw.Index) < len(l.relayPower) && l.relayPower[raw.Index] != raw.Level
+		l.setRelayPower(ctx, emitter, raw.Index, raw.Level)
+		if toggled {
+			l.relayToggled(emitter, raw.Index)
+		}
+
+	default:
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,130 @@
+package lifx_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/emulator"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/light"
+	"go.yhsif.com/lifxlan"
+)
+
+func TestFastChangeDetection(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	lc, emitter, devices := startClient(t, emulator.Config{
+		Label:   "Bulb",
+		Version: emulator.ProductA19,
+		Color:   lifxlan.Color{Brightness: 0xffff, Kelvin: 2700},
+	})
+	bulb := devices[0]
+	id := deviceID(bulb)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	if err := lc.Refresh(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+
+	// within waits for cond for up to d, rather than the usual 5 seconds.
+	within := func(t *testing.T, d time.Duration, what string, cond func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(d); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if cond() {
+				return
+			}
+		}
+		t.Fatalf("%s not seen within %s", what, d)
+	}
+
+	t.Run("Poll", func(t *testing.T) {
+		const interval = 100 * time.Millisecond
+		pollCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-pollCtx.Done():
+					return
+				case <-ticker.C:
+					lc.PollDevices()
+				}
+			}
+		}()
+
+		// As if changed from the LIFX app
+		bulb.SetPower(lifxlan.PowerOn)
+		within(t, 3*interval, "the power", func() bool {
+			return emitter.has(id, "power", true) && lc.Device(id).Power
+		})
+
+		bulb.SetColor(lifxlan.Color{Brightness: 0x8000, Kelvin: 4000})
+		within(t, 3*interval, "the color", func() bool {
+			c := lc.Device(id).Color
+			return c != nil && c.Kelvin == 4000 && c.Brightness == 50
+		})
+	})
+
+	t.Run("Broadcast", func(t *testing.T) {
+		// Pick a free port for the listener
+		probe, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := probe.LocalAddr().String()
+		probe.Close()
+
+		lc.SetListenAddr(addr)
+		listenCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		go lc.ListenForState(listenCtx)
+
+		conn, err := net.Dial("udp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		// broadcast sends a state message as the bulb would, until cond is
+		// true, as the listener may not be ready yet.
+		broadcast := func(t *testing.T, what string, message lifxlan.MessageType, payload interface{}, cond func() bool) {
+			t.Helper()
+			buf := new(bytes.Buffer)
+			if err := binary.Write(buf, binary.LittleEndian, payload); err != nil {
+				t.Fatal(err)
+			}
+			msg, err := lifxlan.GenerateMessage(lifxlan.NotTagged, 0, bulb.Target(), 0, 0, message, buf.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			eventually(t, what, func() bool {
+				conn.Write(msg)
+				time.Sleep(20 * time.Millisecond)
+				return cond()
+			})
+		}
+
+		broadcast(t, "the power", lifxlan.StatePower, &lifxlan.RawStatePowerPayload{Level: lifxlan.PowerOff}, func() bool {
+			return !lc.Device(id).Power
+		})
+		if !emitter.has(id, "power", false) {
+			t.Errorf("Expected the power to be published")
+		}
+
+		state := &light.RawStatePayload{Color: lifxlan.Color{Brightness: 0xffff, Kelvin: 6500}, Power: lifxlan.PowerOn}
+		state.Label.Set("Renamed")
+		broadcast(t, "the color", light.State, state, func() bool {
+			c := lc.Device(id).Color
+			return c != nil && c.Kelvin == 6500
+		})
+		if s := lc.Device(id); !s.Power || s.Label != "Renamed" {
+			t.Errorf("Expected the power and label from the state message, got %v %q", s.Power, s.Label)
+		}
+	})
+}
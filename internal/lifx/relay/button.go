@@ -0,0 +1,452 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"go.yhsif.com/lifxlan"
+)
+
+// ButtonGesture defines how a button is pressed to trigger an action.
+//
+// https://lan.developer.lifx.com/docs/the-lifx-switch#buttons
+type ButtonGesture uint16
+
+// ButtonGesture values.
+const (
+	GesturePress      ButtonGesture = 1
+	GestureHold       ButtonGesture = 2
+	GesturePressPress ButtonGesture = 3
+	GesturePressHold  ButtonGesture = 4
+	GestureHoldHold   ButtonGesture = 5
+)
+
+func (g ButtonGesture) String() string {
+	switch g {
+	case GesturePress:
+		return "press"
+	case GestureHold:
+		return "hold"
+	case GesturePressPress:
+		return "press_press"
+	case GesturePressHold:
+		return "press_hold"
+	case GestureHoldHold:
+		return "hold_hold"
+	}
+	return "unknown"
+}
+
+// ButtonTargetType defines what a button action controls.
+type ButtonTargetType uint16
+
+// ButtonTargetType values.
+const (
+	TargetRelays       ButtonTargetType = 2
+	TargetDevice       ButtonTargetType = 3
+	TargetLocation     ButtonTargetType = 4
+	TargetGroup        ButtonTargetType = 5
+	TargetScene        ButtonTargetType = 6
+	TargetDeviceRelays ButtonTargetType = 7
+)
+
+func (t ButtonTargetType) String() string {
+	switch t {
+	case TargetRelays:
+		return "relays"
+	case TargetDevice:
+		return "device"
+	case TargetLocation:
+		return "location"
+	case TargetGroup:
+		return "group"
+	case TargetScene:
+		return "scene"
+	case TargetDeviceRelays:
+		return "device_relays"
+	}
+	return "unknown"
+}
+
+// Limits of the button payloads.
+const (
+	// MaxButtons is the most buttons in a single button message.
+	MaxButtons = 8
+	// MaxButtonActions is the most actions a button can have.
+	MaxButtonActions = 5
+	// MaxRelays is the most relays of a TargetRelays action.
+	MaxRelays = 15
+	// MaxDeviceRelays is the most relays of a TargetDeviceRelays action.
+	MaxDeviceRelays = 9
+)
+
+// RawButtonAction is a gesture and what it controls.
+//
+// Target is a union depending on TargetType:
+//
+//   - TargetRelays: relay count, then relay indexes
+//   - TargetDevice: the device's serial
+//   - TargetDeviceRelays: the device's serial, relay count, then relay indexes
+//   - TargetLocation, TargetGroup, TargetScene: the uuid
+type RawButtonAction struct {
+	Gesture    ButtonGesture
+	TargetType ButtonTargetType
+	Target     [16]byte
+}
+
+// RelaysAction returns an action toggling relays on this device, up to
+// MaxRelays.
+func RelaysAction(gesture ButtonGesture, relays ...uint8) RawButtonAction {
+	a := RawButtonAction{Gesture: gesture, TargetType: TargetRelays}
+	a.Target[0] = uint8(copy(a.Target[1:], relays))
+	return a
+}
+
+// DeviceAction returns an action toggling another device.
+func DeviceAction(gesture ButtonGesture, target lifxlan.Target) RawButtonAction {
+	a := RawButtonAction{Gesture: gesture, TargetType: TargetDevice}
+	putSerial(a.Target[:], target)
+	return a
+}
+
+// DeviceRelaysAction returns an action toggling relays on another device, up
+// to MaxDeviceRelays.
+func DeviceRelaysAction(gesture ButtonGesture, target lifxlan.Target, relays ...uint8) RawButtonAction {
+	a := RawButtonAction{Gesture: gesture, TargetType: TargetDeviceRelays}
+	putSerial(a.Target[:], target)
+	a.Target[6] = uint8(copy(a.Target[7:], relays))
+	return a
+}
+
+// UUIDAction returns an action controlling a location, group or scene.
+func UUIDAction(gesture ButtonGesture, targetType ButtonTargetType, uuid [16]byte) RawButtonAction {
+	return RawButtonAction{Gesture: gesture, TargetType: targetType, Target: uuid}
+}
+
+// Relays returns the relay indexes of a TargetRelays or TargetDeviceRelays
+// action.
+func (a RawButtonAction) Relays() []uint8 {
+	switch a.TargetType {
+	case TargetRelays:
+		return countedRelays(a.Target[0], a.Target[1:])
+	case TargetDeviceRelays:
+		return countedRelays(a.Target[6], a.Target[7:])
+	}
+	return nil
+}
+
+func countedRelays(count uint8, relays []uint8) []uint8 {
+	n := int(count)
+	if n > len(relays) {
+		n = len(relays)
+	}
+	return append([]uint8(nil), relays[:n]...)
+}
+
+// Serial returns the device of a TargetDevice or TargetDeviceRelays action.
+func (a RawButtonAction) Serial() lifxlan.Target {
+	var t lifxlan.Target
+	for i, b := range a.Target[:6] {
+		t |= lifxlan.Target(b) << (8 * i)
+	}
+	return t
+}
+
+func putSerial(b []byte, target lifxlan.Target) {
+	for i := 0; i < 6; i++ {
+		b[i] = byte(target >> (8 * i))
+	}
+}
+
+// RawButton is the actions of a single button.
+type RawButton struct {
+	ActionsCount uint8
+	Actions      [MaxButtonActions]RawButtonAction
+}
+
+// MakeButton returns a button with actions, up to MaxButtonActions.
+func MakeButton(actions ...RawButtonAction) RawButton {
+	var b RawButton
+	b.ActionsCount = uint8(copy(b.Actions[:], actions))
+	return b
+}
+
+// ActionList returns the button's actions.
+func (b RawButton) ActionList() []RawButtonAction {
+	n := int(b.ActionsCount)
+	if n > MaxButtonActions {
+		n = MaxButtonActions
+	}
+	return append([]RawButtonAction(nil), b.Actions[:n]...)
+}
+
+// RawSetButtonPayload defines the struct to be used for encoding and
+// decoding.
+//
+// https://lan.developer.lifx.com/docs/the-lifx-switch#setbutton---packet-906
+type RawSetButtonPayload struct {
+	Index        uint8
+	ButtonsCount uint8
+	Buttons      [MaxButtons]RawButton
+}
+
+// RawStateButtonPayload defines the struct to be used for encoding and
+// decoding.
+//
+// https://lan.developer.lifx.com/docs/the-lifx-switch#statebutton---packet-907
+type RawStateButtonPayload struct {
+	// Count is the total number of buttons on the device
+	Count uint8
+	// Index is the index of the first button in Buttons
+	Index        uint8
+	ButtonsCount uint8
+	Buttons      [MaxButtons]RawButton
+}
+
+// RawButtonConfig defines the struct to be used for encoding and decoding
+// SetButtonConfig and StateButtonConfig.
+//
+// https://lan.developer.lifx.com/docs/the-lifx-switch#setbuttonconfig---packet-910
+type RawButtonConfig struct {
+	// HapticDuration is how long the device vibrates when a button is
+	// pressed, in milliseconds
+	HapticDuration uint16
+	// BacklightOn and BacklightOff are the colors of a button's backlight
+	// while what it controls is on and off
+	BacklightOn  lifxlan.Color
+	BacklightOff lifxlan.Color
+}
+
+func (rd *device) GetButtons(ctx context.Context, conn net.Conn) ([]RawButton, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if conn == nil {
+		newConn, err := rd.Dial()
+		if err != nil {
+			return nil, err
+		}
+		defer newConn.Close()
+		conn = newConn
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	seq, err := rd.Send(
+		ctx,
+		conn,
+		0, // flags
+		GetButton,
+		nil, // payload
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Devices with more than MaxButtons buttons reply with several messages
+	var buttons []RawButton
+	received := 0
+	for {
+		resp, err := lifxlan.ReadNextResponse(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Sequence != seq || resp.Source != rd.Source() {
+			continue
+		}
+
+		switch resp.Message {
+		case StateButton:
+			var raw RawStateButtonPayload
+			r := bytes.NewReader(resp.Payload)
+			if err := binary.Read(r, binary.LittleEndian, &raw); err != nil {
+				return nil, err
+			}
+			if buttons == nil {
+				buttons = make([]RawButton, raw.Count)
+			}
+			for i := 0; i < int(raw.ButtonsCount) && i < MaxButtons; i++ {
+				if index := int(raw.Index) + i; index < len(buttons) {
+					buttons[index] = raw.Buttons[i]
+					received++
+				}
+			}
+			if received >= len(buttons) {
+				return buttons, nil
+			}
+
+		case lifxlan.StateUnhandled:
+			var raw lifxlan.RawStateUnhandledPayload
+			r := bytes.NewReader(resp.Payload)
+			if err := binary.Read(r, binary.LittleEndian, &raw); err != nil {
+				return nil, err
+			}
+			return nil, raw
+		}
+	}
+}
+
+func (rd *device) SetButtons(
+	ctx context.Context,
+	conn net.Conn,
+	index uint8,
+	buttons []RawButton,
+	ack bool,
+) error {
+	if len(buttons) > MaxButtons {
+		return fmt.Errorf("lifxlan/relay.SetButtons: %d buttons is over %d", len(buttons), MaxButtons)
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if conn == nil {
+		newConn, err := rd.Dial()
+		if err != nil {
+			return err
+		}
+		defer newConn.Close()
+		conn = newConn
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	payload := &RawSetButtonPayload{
+		Index:        index,
+		ButtonsCount: uint8(len(buttons)),
+	}
+	copy(payload.Buttons[:], buttons)
+
+	var flags lifxlan.AckResFlag
+	if ack {
+		flags |= lifxlan.FlagAckRequired
+	}
+
+	seq, err := rd.Send(
+		ctx,
+		conn,
+		flags,
+		SetButton,
+		payload,
+	)
+	if err != nil {
+		return err
+	}
+
+	if ack {
+		return lifxlan.WaitForAcks(ctx, conn, rd.Source(), seq)
+	}
+	return nil
+}
+
+func (rd *device) GetButtonConfig(ctx context.Context, conn net.Conn) (*RawButtonConfig, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if conn == nil {
+		newConn, err := rd.Dial()
+		if err != nil {
+			return nil, err
+		}
+		defer newConn.Close()
+		conn = newConn
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	seq, err := rd.Send(
+		ctx,
+		conn,
+		0, // flags
+		GetButtonConfig,
+		nil, // payload
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		resp, err := lifxlan.ReadNextResponse(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Sequence != seq || resp.Source != rd.Source() {
+			continue
+		}
+
+		switch resp.Message {
+		case StateButtonConfig:
+			var raw RawButtonConfig
+			r := bytes.NewReader(resp.Payload)
+			if err := binary.Read(r, binary.LittleEndian, &raw); err != nil {
+				return nil, err
+			}
+			return &raw, nil
+
+		case lifxlan.StateUnhandled:
+			var raw lifxlan.RawStateUnhandledPayload
+			r := bytes.NewReader(resp.Payload)
+			if err := binary.Read(r, binary.LittleEndian, &raw); err != nil {
+				return nil, err
+			}
+			return nil, raw
+		}
+	}
+}
+
+func (rd *device) SetButtonConfig(
+	ctx context.Context,
+	conn net.Conn,
+	config *RawButtonConfig,
+	ack bool,
+) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if conn == nil {
+		newConn, err := rd.Dial()
+		if err != nil {
+			return err
+		}
+		defer newConn.Close()
+		conn = newConn
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	var flags lifxlan.AckResFlag
+	if ack {
+		flags |= lifxlan.FlagAckRequired
+	}
+
+	seq, err := rd.Send(
+		ctx,
+		conn,
+		flags,
+		SetButtonConfig,
+		config,
+	)
+	if err != nil {
+		return err
+	}
+
+	if ack {
+		return lifxlan.WaitForAcks(ctx, conn, rd.Source(), seq)
+	}
+	return nil
+}
@@ -32,6 +32,51 @@ type Device interface {
 	// this function will only return nil error after it received ack from the
 	// device.
 	SetRPower(ctx context.Context, conn net.Conn, index uint8, power lifxlan.Power, ack bool) error
+
+	// GetButtons returns the actions of every button on the device.
+	//
+	// If conn is nil,
+	// a new connection will be made and guaranteed to be closed before returning.
+	// You should pre-dial and pass in the conn if you plan to call APIs on this
+	// device repeatedly.
+	GetButtons(ctx context.Context, conn net.Conn) ([]RawButton, error)
+	// SetButtons sets the actions of up to MaxButtons buttons, starting at the
+	// button at index.
+	//
+	// If conn is nil,
+	// a new connection will be made and guaranteed to be closed before returning.
+	// You should pre-dial and pass in the conn if you plan to call APIs on this
+	// device repeatedly.
+	//
+	// If ack is false,
+	// this function returns nil error after the API is sent successfully.
+	// If ack is true,
+	// this function will only return nil error after it received ack from the
+	// device.
+	SetButtons(ctx context.Context, conn net.Conn, index uint8, buttons []RawButton, ack bool) error
+
+	// GetButtonConfig returns the haptic feedback and backlight settings of
+	// the buttons.
+	//
+	// If conn is nil,
+	// a new connection will be made and guaranteed to be closed before returning.
+	// You should pre-dial and pass in the conn if you plan to call APIs on this
+	// device repeatedly.
+	GetButtonConfig(ctx context.Context, conn net.Conn) (*RawButtonConfig, error)
+	// SetButtonConfig sets the haptic feedback and backlight settings of the
+	// buttons.
+	//
+	// If conn is nil,
+	// a new connection will be made and guaranteed to be closed before returning.
+	// You should pre-dial and pass in the conn if you plan to call APIs on this
+	// device repeatedly.
+	//
+	// If ack is false,
+	// this function returns nil error after the API is sent successfully.
+	// If ack is true,
+	// this function will only return nil error after it received ack from the
+	// device.
+	SetButtonConfig(ctx context.Context, conn net.Conn, config *RawButtonConfig, ack bool) error
 }
 
 type device struct {
@@ -10,3 +10,13 @@ const (
 	SetRPower   lifxlan.MessageType = 817
 	StateRPower lifxlan.MessageType = 818
 )
+
+// Button related MessageType values.
+const (
+	GetButton         lifxlan.MessageType = 905
+	SetButton         lifxlan.MessageType = 906
+	StateButton       lifxlan.MessageType = 907
+	GetButtonConfig   lifxlan.MessageType = 909
+	SetButtonConfig   lifxlan.MessageType = 910
+	StateButtonConfig lifxlan.MessageType = 911
+)
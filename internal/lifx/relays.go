@@ -0,0 +1,182 @@
+package lifx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	lifxrelay "github.com/denwilliams/go-lifx-mqtt/internal/lifx/relay"
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"go.yhsif.com/lifxlan"
+)
+
+// ErrInvalidRelay is returned for a relay a switch doesn't have.
+var ErrInvalidRelay = errors.New("invalid relay")
+
+const (
+	// defaultRelays is the number of relays assumed for a switch that isn't
+	// in switchRelays and doesn't say how many buttons it has.
+	defaultRelays = 4
+	// relayCountTimeout limits asking an unknown switch how many relays it has
+	// while loading.
+	relayCountTimeout = 2 * time.Second
+)
+
+// switchRelays is the number of relays of each LIFX Switch product, by
+// product id. lifxlan's product features only say whether a product has
+// relays, not how many. Every LIFX Switch so far has 4.
+var switchRelays = map[uint32]int{70: 4, 71: 4, 89: 4, 115: 4, 116: 4}
+
+// RelayNames holds the names of switches' relays, by index, keyed by device
+// id. Relays without a name are empty strings.
+type RelayNames map[string][]string
+
+// LoadRelayNames reads RelayNames from a JSON file, eg:
+//
+//	{
+//	  "d073d5000001": ["fan", "light", "", "heater"]
+//	}
+func LoadRelayNames(path string) (RelayNames, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var names RelayNames
+	if err := json.Unmarshal(b, &names); err != nil {
+		return nil, err
+	}
+	for id, relays := range names {
+		for i, name := range relays {
+			// Names are used in status topics
+			if strings.ContainsAny(name, "/+#") {
+				return nil, fmt.Errorf("relay %d of %s: name %q can't contain /, + or #", i, id, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// SetRelayNames replaces the names of switches' relays, including those
+// already found.
+func (lc *LIFXClient) SetRelayNames(names RelayNames) {
+	normalized := make(RelayNames, len(names))
+	for id, relays := range names {
+		normalized[strings.ToLower(strings.Replace(id, ":", "", -1))] = relays
+	}
+
+	lc.relayNamesMu.Lock()
+	lc.relayNames = normalized
+	lc.relayNamesMu.Unlock()
+
+	for _, l := range lc.devices.All() {
+		l.setRelayNames(normalized[l.id])
+	}
+}
+
+// newDevice creates a device with its relay names.
+func (lc *LIFXClient) newDevice(id string, device lifxlan.Device) *lifxdevice {
+	lc.relayNamesMu.Lock()
+	names := lc.relayNames[id]
+	lc.relayNamesMu.Unlock()
+
+	l := newDevice(id, device)
+	l.relayNames = names
+	return l
+}
+
+// SetRelays turns a switch's relays on or off, keyed by index or name.
+// Devices without relays are ignored.
+func (lc *LIFXClient) SetRelays(ctx context.Context, id string, relays map[string]bool) error {
+	l := lc.devices.Get(id)
+	if l == nil {
+		logging.With("device", id).Warn("No device found")
+		return nil
+	}
+	if l.relay == nil {
+		return nil
+	}
+
+	keys := make([]string, 0, len(relays))
+	for key := range relays {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		index, err := l.relayIndex(key)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		l.logger().With("relay", index, "power", relays[key]).Info("Set relay")
+		errs = append(errs, lc.SetRelay(ctx, id, index, relays[key]))
+	}
+	return errors.Join(errs...)
+}
+
+// relayIndex returns the index of the relay with key as its name (ignoring
+// case) or index.
+func (l *lifxdevice) relayIndex(key string) (uint8, error) {
+	l.stateMu.RLock()
+	defer l.stateMu.RUnlock()
+
+	for i, name := range l.relayNames {
+		if name != "" && i < len(l.relayPower) && strings.EqualFold(name, key) {
+			return uint8(i), nil
+		}
+	}
+	if i, err := strconv.ParseUint(key, 10, 8); err == nil && int(i) < len(l.relayPower) {
+		return uint8(i), nil
+	}
+	return 0, fmt.Errorf("%w: %q of %d relays", ErrInvalidRelay, key, len(l.relayPower))
+}
+
+// relayName returns the name of the relay at index, or "" if it has none.
+// The caller must hold l.stateMu.
+func (l *lifxdevice) relayName(index int) string {
+	if index < len(l.relayNames) {
+		return l.relayNames[index]
+	}
+	return ""
+}
+
+func (l *lifxdevice) setRelayNames(names []string) {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	l.relayNames = names
+}
+
+// countRelays returns how many relays a switch has, as listed for its
+// product in switchRelays. Other switches are asked for their buttons, one
+// above each relay, as they don't report their relays, and are assumed to
+// have defaultRelays if they don't say.
+func (l *lifxdevice) countRelays(ctx context.Context, conn net.Conn, rd lifxrelay.Device, product *lifxlan.Product) int {
+	if product != nil {
+		if relays, ok := switchRelays[product.ProductID]; ok {
+			return relays
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, relayCountTimeout)
+	defer cancel()
+
+	logger := l.logger().With("relays", defaultRelays)
+	buttons, err := rd.GetButtons(ctx, conn)
+	if err != nil {
+		logger.Warn("Unable to count relays of an unknown switch %v", err)
+		return defaultRelays
+	}
+	if len(buttons) == 0 {
+		logger.Warn("Unknown switch has no buttons, assuming the usual number of relays")
+		return defaultRelays
+	}
+	return len(buttons)
+}
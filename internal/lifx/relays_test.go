@@ -0,0 +1,94 @@
+package lifx_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/emulator"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+)
+
+func TestRelays(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	// Two switches, only one with named relays
+	lc, emitter, devices := startClient(t,
+		emulator.Config{Label: "Named", Version: emulator.ProductSwitch},
+		emulator.Config{Label: "Unnamed", Version: emulator.ProductSwitch},
+	)
+	named, unnamed := devices[0], devices[1]
+	lc.SetRelayNames(lifx.RelayNames{named.Target().String(): {"Fan", ""}})
+	ctx := context.Background()
+	for _, d := range devices {
+		if err := lc.Refresh(ctx, deviceID(d)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	id := deviceID(named)
+
+	command := func(t *testing.T, payload string) error {
+		t.Helper()
+		var c mqtt.Command
+		if err := json.Unmarshal([]byte(payload), &c); err != nil {
+			t.Fatal(err)
+		}
+		return lc.HandleCommand(ctx, id, &c)
+	}
+
+	t.Run("Count", func(t *testing.T) {
+		// The product's count
+		if s := lc.Device(id); len(s.Relays) != 4 || !reflect.DeepEqual(s.RelayNames, []string{"Fan", ""}) {
+			t.Errorf("Expected 4 relays, the first named, got %v %q", s.Relays, s.RelayNames)
+		}
+		if s := lc.Device(deviceID(unnamed)); len(s.Relays) != 4 || s.RelayNames != nil {
+			t.Errorf("Expected 4 unnamed relays, got %v %q", s.Relays, s.RelayNames)
+		}
+	})
+
+	t.Run("ByName", func(t *testing.T) {
+		if err := command(t, `{"relays": {"fan": true}}`); err != nil {
+			t.Fatal(err)
+		}
+		if !named.RelayPower(0).On() || named.RelayPower(1).On() {
+			t.Errorf("Expected only the fan to be on")
+		}
+		if !emitter.has(id, "relay0", true) || !emitter.has(id, "relay_Fan", true) {
+			t.Errorf("Expected the fan to be published by index and name")
+		}
+	})
+
+	t.Run("ByIndex", func(t *testing.T) {
+		if err := command(t, `{"relays": {"1": true}}`); err != nil {
+			t.Fatal(err)
+		}
+		if !named.RelayPower(1).On() {
+			t.Errorf("Expected relay 1 to be on")
+		}
+		if !emitter.has(id, "relay1", true) {
+			t.Errorf("Expected relay 1 to be published")
+		}
+	})
+
+	t.Run("Legacy", func(t *testing.T) {
+		if err := command(t, `{"relay1": false}`); err != nil {
+			t.Fatal(err)
+		}
+		if named.RelayPower(1).On() {
+			t.Errorf("Expected relay 1 to be off")
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, payload := range []string{`{"relays": {"4": true}}`, `{"relays": {"heater": true}}`} {
+			if err := command(t, payload); !errors.Is(err, lifx.ErrInvalidRelay) {
+				t.Errorf("Expected ErrInvalidRelay for %s, got %v", payload, err)
+			}
+		}
+	})
+}
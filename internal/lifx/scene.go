@@ -0,0 +1,29 @@
+package lifx
+
+import (
+	"context"
+	"sync"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+)
+
+// ApplyScene applies the command for each device id (or "group/{name}") in
+// scene at the same time, returning the errors keyed by id.
+func (lc *LIFXClient) ApplyScene(ctx context.Context, scene map[string]*mqtt.Command) map[string]error {
+	errs := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for id, command := range scene {
+		wg.Add(1)
+		go func(id string, command *mqtt.Command) {
+			defer wg.Done()
+			if err := lc.HandleCommand(ctx, id, command); err != nil {
+				mu.Lock()
+				errs[id] = err
+				mu.Unlock()
+			}
+		}(id, command)
+	}
+	wg.Wait()
+	return errs
+}
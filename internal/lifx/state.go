@@ -0,0 +1,139 @@
+package lifx
+
+import (
+	"strings"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+)
+
+type deviceError struct {
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// recordError keeps err as the device's last error, or clears the last error
+// if err is nil. It returns err so it can wrap calls.
+func (l *lifxdevice) recordError(err error) error {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+
+	if err == nil {
+		l.lastError = nil
+		return nil
+	}
+	l.lastError = &deviceError{Message: err.Error(), Time: time.Now().UTC()}
+	return err
+}
+
+// DeviceState is a snapshot of the cached state of a device.
+type DeviceState struct {
+	ID      string        `json:"id"`
+	Label   string        `json:"label"`
+	Group   string        `json:"group,omitempty"`
+	Product string        `json:"product,omitempty"`
+	Type    string        `json:"type"`
+	Address string        `json:"address,omitempty"`
+	Loaded  bool          `json:"loaded"`
+	Power   bool          `json:"power"`
+	Color   *colorPayload `json:"color,omitempty"`
+	Relays  []bool        `json:"relays,omitempty"`
+	// RelayNames are the names of Relays, if configured
+	RelayNames []string     `json:"relay_names,omitempty"`
+	Adaptive   bool         `json:"adaptive,omitempty"`
+	Effect     *mqtt.Effect `json:"effect,omitempty"`
+	Info       *infoPayload `json:"info,omitempty"`
+	Width      int          `json:"width,omitempty"`
+	Height     int          `json:"height,omitempty"`
+	LastSeen   *time.Time   `json:"last_seen,omitempty"`
+	Error      *deviceError `json:"error,omitempty"`
+}
+
+// State returns a snapshot of the cached state without querying the device.
+func (l *lifxdevice) State() *DeviceState {
+	l.stateMu.RLock()
+	defer l.stateMu.RUnlock()
+
+	s := &DeviceState{
+		ID:      l.id,
+		Label:   l.label,
+		Type:    l.lifxType.String(),
+		Address: l.addr,
+		Loaded:  l.loaded.Load(),
+		Power:   toPowerPayload(l.power),
+		Color:   toColorPayload(l.color),
+		Info:    l.info,
+		Error:   l.lastError,
+	}
+	if l.product != nil {
+		s.Product = l.product.ProductName
+	}
+	if l.info != nil {
+		s.Group = l.info.Group
+	}
+	if l.relay != nil {
+		s.Relays = make([]bool, len(l.relayPower))
+		for i, p := range l.relayPower {
+			s.Relays[i] = toPowerPayload(p)
+		}
+		s.RelayNames = l.relayNames
+	}
+	if l.tile != nil {
+		s.Width = l.tile.Width()
+		s.Height = l.tile.Height()
+	}
+	if l.effect != nil {
+		effect := *l.effect
+		s.Effect = &effect
+	}
+	if !l.lastSeen.IsZero() {
+		lastSeen := l.lastSeen
+		s.LastSeen = &lastSeen
+	}
+	return s
+}
+
+// inGroup returns true if the device's group label matches name, ignoring
+// case.
+func (l *lifxdevice) inGroup(name string) bool {
+	l.stateMu.RLock()
+	defer l.stateMu.RUnlock()
+
+	return l.info != nil && strings.EqualFold(l.info.Group, name)
+}
+
+// Devices returns the cached state of every known device, sorted by id.
+func (lc *LIFXClient) Devices() []*DeviceState {
+	all := lc.devices.All()
+	states := make([]*DeviceState, len(all))
+	for i, l := range all {
+		states[i] = l.State()
+		states[i].Adaptive = lc.Adaptive(l.id)
+	}
+	return states
+}
+
+// Device returns the cached state of the device with id, or nil if there is
+// no such device.
+func (lc *LIFXClient) Device(id string) *DeviceState {
+	l := lc.devices.Get(id)
+	if l == nil {
+		return nil
+	}
+	s := l.State()
+	s.Adaptive = lc.Adaptive(id)
+	return s
+}
+
+// Groups returns the ids of the devices in each known group, keyed by group
+// label. Groups are only known once a device's info has been loaded.
+func (lc *LIFXClient) Groups() map[string][]string {
+	groups := make(map[string][]string)
+	for _, s := range lc.Devices() {
+		if s.Group == "" {
+			continue
+		}
+		groups[s.Group] = append(groups[s.Group], s.ID)
+	}
+	return groups
+}
@@ -0,0 +1,177 @@
+package lifx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	lifxtile "github.com/denwilliams/go-lifx-mqtt/internal/lifx/tile"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"go.yhsif.com/lifxlan"
+)
+
+const (
+	// defaultTextSpeed is how many pixels text scrolls per second
+	defaultTextSpeed = 10
+	// maxTextLength limits the characters of a message, which is rendered
+	// into a frame per pixel it scrolls
+	maxTextLength = 256
+	// spaceWidth is the width of a space, narrower than the other glyphs
+	spaceWidth = 3
+)
+
+// ErrInvalidText is returned for text that can't be shown.
+var ErrInvalidText = errors.New("invalid text")
+
+// ShowText draws a message on a matrix device's board, scrolling it across
+// the board if it doesn't fit or a speed is given.
+func (lc *LIFXClient) ShowText(ctx context.Context, id string, text *mqtt.Text, duration uint32) error {
+	l := lc.devices.Get(id)
+	if l == nil {
+		return fmt.Errorf("%w: device %s", ErrNotFound, id)
+	}
+	if l.tile == nil {
+		return fmt.Errorf("%w: device %s is not a matrix device", ErrInvalidText, id)
+	}
+
+	frames, err := textFrames(text, l.tile)
+	if err != nil {
+		return err
+	}
+	if len(frames) == 1 {
+		lc.StopEffect(id)
+		return lc.SetBoard(ctx, id, frames[0].Board, duration)
+	}
+	return lc.StartAnimation(ctx, id, frames, text.Repeat)
+}
+
+// textFrames renders a text command onto board, as a single frame with the
+// text centred or as the frames of it scrolling past.
+func textFrames(text *mqtt.Text, board lifxtile.Board) ([]Frame, error) {
+	if text.Text == "" {
+		return nil, fmt.Errorf("%w: no text", ErrInvalidText)
+	}
+	if n := utf8.RuneCountInString(text.Text); n > maxTextLength {
+		return nil, fmt.Errorf("%w: %d characters is over %d", ErrInvalidText, n, maxTextLength)
+	}
+	if text.Speed < 0 {
+		return nil, fmt.Errorf("%w: speed %g is negative", ErrInvalidText, text.Speed)
+	}
+	if text.Repeat < 0 {
+		return nil, fmt.Errorf("%w: repeat %d is negative", ErrInvalidText, text.Repeat)
+	}
+
+	fg := "#ffffff"
+	if text.Color != "" {
+		fg = text.Color
+	}
+	c, err := parseHexColor(fg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: color %q: %s", ErrInvalidText, fg, err)
+	}
+	foreground := lifxlan.FromColor(c, 0)
+	var background *lifxlan.Color
+	if text.Background != "" {
+		c, err := parseHexColor(text.Background)
+		if err != nil {
+			return nil, fmt.Errorf("%w: background %q: %s", ErrInvalidText, text.Background, err)
+		}
+		background = lifxlan.FromColor(c, 0)
+	}
+
+	columns := textColumns(text.Text)
+	width := board.Width()
+	draw := func(x int) lifxtile.ColorBoard {
+		cb := lifxtile.MakeColorBoard(width, board.Height())
+		drawText(cb, board, columns, x, foreground, background)
+		return cb
+	}
+
+	if text.Speed == 0 && len(columns) <= width {
+		return []Frame{{Board: draw((width - len(columns)) / 2)}}, nil
+	}
+
+	speed := text.Speed
+	if speed == 0 {
+		speed = defaultTextSpeed
+	}
+	delay := time.Duration(float64(time.Second) / speed)
+	if delay < minFrameDelay {
+		delay = minFrameDelay
+	}
+
+	// From the first column showing on the right until the last one has
+	// gone off the left
+	var frames []Frame
+	for x := width - 1; x >= -len(columns); x-- {
+		frames = append(frames, Frame{Board: draw(x), Delay: delay})
+	}
+	return frames, nil
+}
+
+// textColumns renders s in the bitmap font, returning its pixel columns
+// from the left with the top pixel in the lowest bit. Characters outside of
+// the font are shown as '?'.
+func textColumns(s string) []byte {
+	var columns []byte
+	for i, r := range []rune(s) {
+		if i > 0 {
+			// Between characters
+			columns = append(columns, 0)
+		}
+		if r < ' ' || int(r-' ') >= len(font) {
+			r = '?'
+		}
+		if r == ' ' {
+			columns = append(columns, make([]byte, spaceWidth)...)
+			continue
+		}
+
+		// Glyphs are trimmed to their widths
+		glyph := font[r-' ']
+		start, end := 0, len(glyph)
+		for start < end && glyph[start] == 0 {
+			start++
+		}
+		for end > start && glyph[end-1] == 0 {
+			end--
+		}
+		columns = append(columns, glyph[start:end]...)
+	}
+	return columns
+}
+
+// drawText draws text columns onto cb, starting at x and centred vertically,
+// in fg over bg. The rest of the board is left off if bg is nil.
+func drawText(cb lifxtile.ColorBoard, board lifxtile.Board, columns []byte, x int, fg *lifxlan.Color, bg *lifxlan.Color) {
+	width, height := board.Width(), board.Height()
+	if bg != nil {
+		for i := 0; i < width; i++ {
+			for j := 0; j < height; j++ {
+				if board.OnTile(i, j) {
+					cb[i][j] = bg
+				}
+			}
+		}
+	}
+
+	// The board's origin is the bottom left corner
+	top := height - 1 - (height-fontHeight)/2
+	if top >= height {
+		top = height - 1
+	}
+	for i, column := range columns {
+		bx := x + i
+		if bx < 0 || bx >= width {
+			continue
+		}
+		for row := 0; row < fontHeight; row++ {
+			by := top - row
+			if column&(1<<row) != 0 && board.OnTile(bx, by) {
+				cb[bx][by] = fg
+			}
+		}
+	}
+}
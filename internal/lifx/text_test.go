@@ -0,0 +1,135 @@
+package lifx_test
+
+import (
+	"context"
+	"errors"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/emulator"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"go.yhsif.com/lifxlan"
+)
+
+func TestText(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	lc, _, devices := startClient(t,
+		emulator.Config{Label: "Tiles", Version: emulator.ProductTile, Tiles: 2},
+		emulator.Config{Label: "Bulb", Version: emulator.ProductA19},
+	)
+	tiles, bulb := devices[0], devices[1]
+	id := deviceID(tiles)
+	ctx := context.Background()
+
+	show := func(t *testing.T, text *mqtt.Text) error {
+		t.Helper()
+		return lc.HandleCommand(ctx, id, &mqtt.Command{Text: text})
+	}
+	red := color.RGBA{R: 0xff, A: 0xff}
+	blue := color.RGBA{B: 0xff, A: 0xff}
+	// count returns how many pixels of both tiles are c.
+	count := func(c color.Color) int {
+		want := lifxlan.FromColor(c, 0)
+		n := 0
+		for i := 0; i < 2; i++ {
+			for _, got := range tiles.TileColors(i) {
+				if got.Hue == want.Hue && got.Saturation == want.Saturation && got.Brightness == want.Brightness {
+					n++
+				}
+			}
+		}
+		return n
+	}
+
+	t.Run("Centred", func(t *testing.T) {
+		// "1" is 3 columns wide with 10 pixels lit
+		if err := show(t, &mqtt.Text{Text: "1", Color: "#ff0000"}); err != nil {
+			t.Fatal(err)
+		}
+		if n := count(red); n != 10 {
+			t.Errorf("Expected 10 red pixels, got %d", n)
+		}
+		// The middle column, at x 7 of the 16 wide board, is lit from the
+		// top row
+		if c := tiles.TileColors(0)[7]; c.Brightness == 0 {
+			t.Errorf("Expected the top of the 1 to be lit, got %+v", c)
+		}
+		if lc.EffectRunning(id) {
+			t.Errorf("Expected text that fits not to scroll")
+		}
+		if !tiles.Power().On() {
+			t.Errorf("Expected the tiles to be turned on")
+		}
+	})
+
+	t.Run("Background", func(t *testing.T) {
+		if err := show(t, &mqtt.Text{Text: "1", Background: "#0000ff"}); err != nil {
+			t.Fatal(err)
+		}
+		if n := count(color.White); n != 10 {
+			t.Errorf("Expected 10 white pixels, got %d", n)
+		}
+		if n := count(blue); n != 128-10 {
+			t.Errorf("Expected %d blue pixels, got %d", 128-10, n)
+		}
+	})
+
+	t.Run("Marquee", func(t *testing.T) {
+		// Fast enough to pass in about a second
+		if err := show(t, &mqtt.Text{Text: "Hi", Speed: 50, Repeat: 1}); err != nil {
+			t.Fatal(err)
+		}
+		if !lc.EffectRunning(id) {
+			t.Errorf("Expected the text to be scrolling")
+		}
+		eventually(t, "the text to scroll past", func() bool {
+			return !lc.EffectRunning(id)
+		})
+		if n := count(color.Black); n != 128 {
+			t.Errorf("Expected the text to have gone, got %d pixels off", n)
+		}
+	})
+
+	t.Run("OtherCommandStops", func(t *testing.T) {
+		if err := show(t, &mqtt.Text{Text: "Forever and ever"}); err != nil {
+			t.Fatal(err)
+		}
+		if !lc.EffectRunning(id) {
+			t.Errorf("Expected text that doesn't fit to scroll")
+		}
+		power := false
+		if err := lc.HandleCommand(ctx, id, &mqtt.Command{Power: &power}); err != nil {
+			t.Fatal(err)
+		}
+		if lc.EffectRunning(id) {
+			t.Errorf("Expected the text to stop")
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			device *emulator.Device
+			text   *mqtt.Text
+		}{
+			{"Bulb", bulb, &mqtt.Text{Text: "hi"}},
+			{"Empty", tiles, &mqtt.Text{}},
+			{"Color", tiles, &mqtt.Text{Text: "hi", Color: "red"}},
+			{"Repeat", tiles, &mqtt.Text{Text: "hi", Repeat: -1}},
+			{"Long", tiles, &mqtt.Text{Text: strings.Repeat("a", 257)}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				err := lc.HandleCommand(ctx, deviceID(tt.device), &mqtt.Command{Text: tt.text})
+				if !errors.Is(err, lifx.ErrInvalidText) {
+					t.Errorf("Expected ErrInvalidText, got %v", err)
+				}
+			})
+		}
+	})
+}
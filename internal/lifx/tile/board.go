@@ -36,7 +36,8 @@ type Board interface {
 
 // IndexData stores the data linked to a tile for a Board coordinate.
 type IndexData struct {
-	// The coordinate inside the tile.
+	// The coordinate inside the tile,
+	// the column and row of the pixel in the tile's colors.
 	Coordinate
 
 	// The index of the tile.
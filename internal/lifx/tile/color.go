@@ -101,7 +101,7 @@ func (td *device) SetColors(
 					// Not on tile
 					continue
 				}
-				colorIndex := data.X*int(td.TileWidth(data.Index)) + data.Y
+				colorIndex := data.Y*int(td.TileWidth(data.Index)) + data.X
 				payloads[data.Index].Colors[colorIndex] = td.SanitizeColor(*c)
 			}
 		}
@@ -255,7 +255,7 @@ func (td *device) GetColors(
 			for y := 0; y < int(tile.Height); y++ {
 				// c is the coordinate on the color board.
 				c := td.board.ReverseData[ti][x][y]
-				cb[c.X][c.Y] = &raw.Colors[x*int(tile.Width)+y]
+				cb[c.X][c.Y] = &raw.Colors[y*int(tile.Width)+x]
 			}
 		}
 
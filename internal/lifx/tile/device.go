@@ -46,6 +46,29 @@ type Device interface {
 	// the device.
 	SetColors(ctx context.Context, conn net.Conn, cb ColorBoard, transition time.Duration, ack bool) error
 
+	// GetEffect returns the firmware effect running on this tile device.
+	//
+	// If conn is nil,
+	// a new connection will be made and guaranteed to be closed before returning.
+	// You should pre-dial and pass in the conn if you plan to call APIs on this
+	// device repeatedly.
+	GetEffect(ctx context.Context, conn net.Conn) (*RawTileEffectSettings, error)
+
+	// SetEffect starts a firmware effect on this tile device, or stops it with
+	// EffectOff.
+	//
+	// If conn is nil,
+	// a new connection will be made and guaranteed to be closed before returning.
+	// You should pre-dial and pass in the conn if you plan to call APIs on this
+	// device repeatedly.
+	//
+	// If ack is false,
+	// this function returns nil error after the API is sent successfully.
+	// If ack is true,
+	// this function will only return nil error after it received ack from the
+	// device.
+	SetEffect(ctx context.Context, conn net.Conn, args *SetEffectArgs, ack bool) error
+
 	// TileWidth returns the width of the i-th tile.
 	//
 	// If i is out of bound, it returns the width of the first tile (index 0)
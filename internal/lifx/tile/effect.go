@@ -0,0 +1,255 @@
+package tile
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"time"
+
+	"go.yhsif.com/lifxlan"
+)
+
+// EffectType defines the type of a firmware effect.
+//
+// https://lan.developer.lifx.com/docs/tile-effects
+type EffectType uint8
+
+// EffectType values.
+const (
+	EffectOff   EffectType = 0
+	EffectMorph EffectType = 2
+	EffectFlame EffectType = 3
+	EffectSky   EffectType = 5
+)
+
+func (t EffectType) String() string {
+	switch t {
+	case EffectOff:
+		return "off"
+	case EffectMorph:
+		return "morph"
+	case EffectFlame:
+		return "flame"
+	case EffectSky:
+		return "sky"
+	}
+	return "unknown"
+}
+
+// SkyType defines the kind of sky shown by EffectSky.
+type SkyType uint8
+
+// SkyType values.
+const (
+	SkySunrise SkyType = 0
+	SkySunset  SkyType = 1
+	SkyClouds  SkyType = 2
+)
+
+// MaxPaletteSize is the most colors an effect's palette can have.
+const MaxPaletteSize = 16
+
+// RawTileEffectSettings is the part of the effect payloads shared by
+// SetTileEffect and StateTileEffect.
+//
+// https://lan.developer.lifx.com/docs/tile-effects
+type RawTileEffectSettings struct {
+	InstanceID   uint32
+	Type         EffectType
+	Speed        uint32  // milliseconds
+	Duration     uint64  // nanoseconds, 0 for forever
+	_            [4]byte // reserved
+	_            [4]byte // reserved
+	Parameters   [32]byte
+	PaletteCount uint8
+	Palette      [MaxPaletteSize]lifxlan.Color
+}
+
+// SpeedDuration returns the speed as a time.Duration.
+func (raw RawTileEffectSettings) SpeedDuration() time.Duration {
+	return time.Duration(raw.Speed) * time.Millisecond
+}
+
+// Colors returns the colors in the palette.
+func (raw RawTileEffectSettings) Colors() []lifxlan.Color {
+	n := int(raw.PaletteCount)
+	if n > MaxPaletteSize {
+		n = MaxPaletteSize
+	}
+	return append([]lifxlan.Color(nil), raw.Palette[:n]...)
+}
+
+// Sky returns the sky type parameter of EffectSky.
+func (raw RawTileEffectSettings) Sky() SkyType {
+	return SkyType(raw.Parameters[0])
+}
+
+// RawGetTileEffectPayload defines the struct to be used for encoding and
+// decoding.
+//
+// https://lan.developer.lifx.com/docs/querying-the-device-for-data#gettileeffect---packet-718
+type RawGetTileEffectPayload struct {
+	_ byte // reserved
+	_ byte // reserved
+}
+
+// RawSetTileEffectPayload defines the struct to be used for encoding and
+// decoding.
+//
+// https://lan.developer.lifx.com/docs/changing-a-device#settileeffect---packet-719
+type RawSetTileEffectPayload struct {
+	_ byte // reserved
+	_ byte // reserved
+	RawTileEffectSettings
+}
+
+// RawStateTileEffectPayload defines the struct to be used for encoding and
+// decoding.
+//
+// https://lan.developer.lifx.com/docs/information-messages#statetileeffect---packet-720
+type RawStateTileEffectPayload struct {
+	_ byte // reserved
+	RawTileEffectSettings
+}
+
+// SetEffectArgs is the args to be translated into RawSetTileEffectPayload.
+type SetEffectArgs struct {
+	// Type of effect, EffectOff stops the running effect.
+	Type EffectType
+
+	// Speed is how long one cycle of the effect takes.
+	Speed time.Duration
+
+	// Duration is how long the effect runs for, 0 means forever.
+	Duration time.Duration
+
+	// Palette is the colors used by EffectMorph, at most MaxPaletteSize.
+	// The device's default palette is used when it's empty.
+	Palette []lifxlan.Color
+
+	// Sky is the kind of sky shown by EffectSky.
+	Sky SkyType
+}
+
+func (td *device) GetEffect(ctx context.Context, conn net.Conn) (*RawTileEffectSettings, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if conn == nil {
+		newConn, err := td.Dial()
+		if err != nil {
+			return nil, err
+		}
+		defer newConn.Close()
+		conn = newConn
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	seq, err := td.Send(
+		ctx,
+		conn,
+		0, // flags
+		GetTileEffect,
+		&RawGetTileEffectPayload{},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		resp, err := lifxlan.ReadNextResponse(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Sequence != seq || resp.Source != td.Source() {
+			continue
+		}
+
+		switch resp.Message {
+		case StateTileEffect:
+			var raw RawStateTileEffectPayload
+			r := bytes.NewReader(resp.Payload)
+			if err := binary.Read(r, binary.LittleEndian, &raw); err != nil {
+				return nil, err
+			}
+			return &raw.RawTileEffectSettings, nil
+
+		case lifxlan.StateUnhandled:
+			// Firmware without effects
+			var raw lifxlan.RawStateUnhandledPayload
+			r := bytes.NewReader(resp.Payload)
+			if err := binary.Read(r, binary.LittleEndian, &raw); err != nil {
+				return nil, err
+			}
+			return nil, raw
+		}
+	}
+}
+
+func (td *device) SetEffect(
+	ctx context.Context,
+	conn net.Conn,
+	args *SetEffectArgs,
+	ack bool,
+) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if conn == nil {
+		newConn, err := td.Dial()
+		if err != nil {
+			return err
+		}
+		defer newConn.Close()
+		conn = newConn
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+
+	payload := &RawSetTileEffectPayload{
+		RawTileEffectSettings: RawTileEffectSettings{
+			Type:     args.Type,
+			Speed:    uint32(args.Speed.Milliseconds()),
+			Duration: uint64(args.Duration),
+		},
+	}
+	if args.Type == EffectSky {
+		payload.Parameters[0] = uint8(args.Sky)
+	}
+	for i, c := range args.Palette {
+		if i >= MaxPaletteSize {
+			break
+		}
+		payload.Palette[i] = td.SanitizeColor(c)
+		payload.PaletteCount++
+	}
+
+	var flags lifxlan.AckResFlag
+	if ack {
+		flags |= lifxlan.FlagAckRequired
+	}
+
+	seq, err := td.Send(
+		ctx,
+		conn,
+		flags,
+		SetTileEffect,
+		payload,
+	)
+	if err != nil {
+		return err
+	}
+
+	if ack {
+		return lifxlan.WaitForAcks(ctx, conn, td.Source(), seq)
+	}
+	return nil
+}
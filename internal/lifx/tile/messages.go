@@ -11,4 +11,7 @@ const (
 	GetTileState64   lifxlan.MessageType = 707
 	StateTileState64 lifxlan.MessageType = 711
 	SetTileState64   lifxlan.MessageType = 715
+	GetTileEffect    lifxlan.MessageType = 718
+	SetTileEffect    lifxlan.MessageType = 719
+	StateTileEffect  lifxlan.MessageType = 720
 )
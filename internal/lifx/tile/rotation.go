@@ -5,9 +5,12 @@ import (
 	"math"
 )
 
-// Rotation defines the rotation of a single tile.
+// Rotation defines the rotation of a single tile, measured by its
+// accelerometer.
 //
-// NOTE: Currently only RotationRightSideUp is fully supported.
+// RotationRotateRight means the tile is turned clockwise, with its top facing
+// right. Tiles facing up or down are lying flat, and are drawn as if they
+// were right side up.
 type Rotation int
 
 // Possible Rotation values.
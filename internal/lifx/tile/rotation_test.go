@@ -0,0 +1,219 @@
+package tile_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/emulator"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/tile"
+	"go.yhsif.com/lifxlan"
+)
+
+func TestRotate(t *testing.T) {
+	// A 3x2 tile, so mixing up the width and height shows.
+	corners := []tile.Coordinate{
+		{X: 0, Y: 0}, // top left
+		{X: 2, Y: 0}, // top right
+		{X: 0, Y: 1}, // bottom left
+	}
+	for _, c := range []struct {
+		rotation tile.Rotation
+		expected []tile.Coordinate
+	}{
+		{
+			rotation: tile.RotationRightSideUp,
+			expected: []tile.Coordinate{{X: 0, Y: 1}, {X: 2, Y: 1}, {X: 0, Y: 0}},
+		},
+		{
+			rotation: tile.RotationUpsideDown,
+			expected: []tile.Coordinate{{X: 2, Y: 0}, {X: 0, Y: 0}, {X: 2, Y: 1}},
+		},
+		{
+			rotation: tile.RotationRotateRight,
+			expected: []tile.Coordinate{{X: 1, Y: 2}, {X: 1, Y: 0}, {X: 0, Y: 2}},
+		},
+		{
+			rotation: tile.RotationRotateLeft,
+			expected: []tile.Coordinate{{X: 0, Y: 0}, {X: 0, Y: 2}, {X: 1, Y: 0}},
+		},
+		{
+			rotation: tile.RotationFaceUp,
+			expected: []tile.Coordinate{{X: 0, Y: 1}, {X: 2, Y: 1}, {X: 0, Y: 0}},
+		},
+		{
+			rotation: tile.RotationFaceDown,
+			expected: []tile.Coordinate{{X: 0, Y: 1}, {X: 2, Y: 1}, {X: 0, Y: 0}},
+		},
+	} {
+		t.Run(c.rotation.String(), func(t *testing.T) {
+			tl := tile.Tile{Width: 3, Height: 2, Rotation: c.rotation}
+			for i, corner := range corners {
+				x, y := tl.Rotate(corner.X, corner.Y)
+				if x != c.expected[i].X || y != c.expected[i].Y {
+					t.Errorf(
+						"Rotate(%d, %d) expected (%d, %d), got (%d, %d)",
+						corner.X,
+						corner.Y,
+						c.expected[i].X,
+						c.expected[i].Y,
+						x,
+						y,
+					)
+				}
+			}
+		})
+	}
+}
+
+func TestParseBoardRotations(t *testing.T) {
+	square := func(x, y float32, rotation tile.Rotation) *tile.Tile {
+		return &tile.Tile{
+			UserX:    x,
+			UserY:    y,
+			Width:    2,
+			Height:   2,
+			Rotation: rotation,
+		}
+	}
+
+	for _, c := range []struct {
+		label string
+		tiles []*tile.Tile
+		size  tile.Coordinate
+		// topLeft is where the top left pixel of each tile is on the board.
+		topLeft []tile.Coordinate
+	}{
+		{
+			label: "Row",
+			tiles: []*tile.Tile{
+				square(0, 0, tile.RotationRightSideUp),
+				square(1, 0, tile.RotationUpsideDown),
+				square(2, 0, tile.RotationRotateLeft),
+				square(3, 0, tile.RotationRotateRight),
+			},
+			size:    tile.Coordinate{X: 8, Y: 2},
+			topLeft: []tile.Coordinate{{X: 0, Y: 1}, {X: 3, Y: 0}, {X: 4, Y: 0}, {X: 7, Y: 1}},
+		},
+		{
+			label: "Column",
+			tiles: []*tile.Tile{
+				square(0, 0, tile.RotationUpsideDown),
+				square(0, 1, tile.RotationRotateRight),
+				square(0, 2, tile.RotationFaceUp),
+			},
+			size:    tile.Coordinate{X: 2, Y: 6},
+			topLeft: []tile.Coordinate{{X: 1, Y: 0}, {X: 1, Y: 3}, {X: 0, Y: 5}},
+		},
+		{
+			label: "Gap",
+			tiles: []*tile.Tile{
+				square(-1, 0, tile.RotationRotateLeft),
+				square(1, 0, tile.RotationFaceDown),
+			},
+			size:    tile.Coordinate{X: 6, Y: 2},
+			topLeft: []tile.Coordinate{{X: 0, Y: 0}, {X: 4, Y: 1}},
+		},
+	} {
+		t.Run(c.label, func(t *testing.T) {
+			board := tile.ParseBoard(c.tiles)
+			if board.Coordinate != c.size {
+				t.Fatalf("Expected board size %v, got %v", c.size, board.Coordinate)
+			}
+			for i, expected := range c.topLeft {
+				if actual := board.ReverseData[i][0][0]; actual != expected {
+					t.Errorf("Tile %d: expected top left pixel at %v, got %v", i, expected, actual)
+				}
+			}
+
+			// Every pixel of every tile is on the board exactly once.
+			n := 0
+			for x := range board.Data {
+				for y, data := range board.Data[x] {
+					if data == nil {
+						continue
+					}
+					n++
+					actual := board.ReverseData[data.Index][data.X][data.Y]
+					if actual.X != x || actual.Y != y {
+						t.Errorf("%v: expected to map back to (%d, %d), got %v", data, x, y, actual)
+					}
+				}
+			}
+			if n != len(c.tiles)*4 {
+				t.Errorf("Expected %d pixels on the board, got %d", len(c.tiles)*4, n)
+			}
+		})
+	}
+}
+
+func TestRotatedColors(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	rotations := []tile.Rotation{
+		tile.RotationRightSideUp,
+		tile.RotationRotateRight,
+		tile.RotationUpsideDown,
+		tile.RotationRotateLeft,
+		tile.RotationFaceUp,
+	}
+	em, err := emulator.Start(emulator.Config{Version: emulator.ProductTile, Rotations: rotations})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { em.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	td, err := tile.Wrap(ctx, em.LIFXDevice(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if td.Width() != 40 || td.Height() != 8 {
+		t.Fatalf("Expected a 40x8 board, got %dx%d", td.Width(), td.Height())
+	}
+
+	// Every point on the board gets its own hue.
+	cb := tile.MakeColorBoard(td.Width(), td.Height())
+	for x := range cb {
+		for y := range cb[x] {
+			cb[x][y] = &lifxlan.Color{Hue: uint16(x*100 + y), Brightness: 0xffff, Kelvin: 3500}
+		}
+	}
+	if err := td.SetColors(ctx, nil, cb, 0, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Where the top left pixel of each tile is on the board.
+	for i, expected := range []tile.Coordinate{
+		{X: 0, Y: 7},
+		{X: 15, Y: 7},
+		{X: 23, Y: 0},
+		{X: 24, Y: 0},
+		{X: 32, Y: 7},
+	} {
+		if actual := em.TileColors(i)[0].Hue; actual != cb[expected.X][expected.Y].Hue {
+			t.Errorf(
+				"Tile %d (%v): expected top left pixel hue %d, got %d",
+				i,
+				rotations[i],
+				cb[expected.X][expected.Y].Hue,
+				actual,
+			)
+		}
+	}
+
+	actual, err := td.GetColors(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := range cb {
+		for y := range cb[x] {
+			if c := actual.GetColor(x, y); c == nil || c.Hue != cb[x][y].Hue {
+				t.Errorf("(%d, %d): expected hue %d, got %v", x, y, cb[x][y].Hue, c)
+			}
+		}
+	}
+}
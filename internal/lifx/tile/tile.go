@@ -49,17 +49,33 @@ func ParseTile(raw *RawTileDevice) *Tile {
 	}
 }
 
-// Rotate rotates a given coordinate (x, y) based on tile's rotation and size.
+// Rotate returns the coordinate of the pixel (x, y) of the tile on the board,
+// relative to the bottom left corner of the tile, based on tile's rotation
+// and size.
 //
-// x, y must satisfy: (0 <= x < width) && (0 <= y < height)
+// (x, y) is the column and row of the pixel in the colors sent to and read
+// from the tile, with (0, 0) at the top left corner of the tile when it is
+// right side up.
 //
-// TODO: This function currently only handles RotationRightSideUp correctly.
+// x, y must satisfy: (0 <= x < width) && (0 <= y < height)
 func (t Tile) Rotate(x, y int) (int, int) {
+	w := int(t.Width)
+	h := int(t.Height)
 	switch t.Rotation {
 	default:
-		return x, y
-	case RotationRightSideUp:
-		return y, int(t.Width) - 1 - x
+		// RotationRightSideUp, RotationFaceDown and RotationFaceUp.
+		//
+		// Which way a tile lying flat is turned can't be measured,
+		// so it's assumed to be right side up.
+		return x, h - 1 - y
+	case RotationUpsideDown:
+		return w - 1 - x, y
+	case RotationRotateRight:
+		// The top of the tile faces right.
+		return h - 1 - y, w - 1 - x
+	case RotationRotateLeft:
+		// The top of the tile faces left.
+		return y, x
 	}
 }
 
@@ -68,7 +84,8 @@ func (t Tile) Rotate(x, y int) (int, int) {
 //
 // "non-normalized" means that the coordinate might be negative.
 //
-// The returned coordinates are guaranteed to be of the size of Width*Height.
+// The returned coordinates are guaranteed to be of the size of Width*Height,
+// indexed by the column and row of the pixel on the tile.
 func (t Tile) BoardCoordinates() (
 	coordinates [][]Coordinate,
 	min Coordinate,
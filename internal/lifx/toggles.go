@@ -0,0 +1,127 @@
+package lifx
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"time"
+
+	lifxrelay "github.com/denwilliams/go-lifx-mqtt/internal/lifx/relay"
+)
+
+const (
+	// toggleWindow is how long relay changes are collected before they are
+	// published together. A button toggling several relays is reported a
+	// relay at a time.
+	toggleWindow = 250 * time.Millisecond
+	// commandWindow is how long after the bridge sets a relay that changes
+	// to it are taken to be from the bridge, even if the switch's reply was
+	// lost.
+	commandWindow = 5 * time.Second
+)
+
+// relayEvent is published when a switch's relays change without the bridge
+// changing them. Switches don't report button presses over the LAN, so
+// Button and Gesture are only a hint: the button action configured to toggle
+// exactly these relays, if there is one.
+type relayEvent struct {
+	Relays  []int  `json:"relays"`
+	Button  *int   `json:"button,omitempty"`
+	Gesture string `json:"gesture,omitempty"`
+}
+
+// relayCommanded records the bridge setting the relay at index, so the change
+// isn't published as a toggle.
+func (l *lifxdevice) relayCommanded(index uint8) {
+	l.toggleMu.Lock()
+	defer l.toggleMu.Unlock()
+
+	if l.commanded == nil {
+		l.commanded = make(map[uint8]time.Time)
+	}
+	l.commanded[index] = time.Now()
+}
+
+// relayToggled records a relay change the bridge didn't make, to be published
+// once the toggle window has passed. The caller must hold l.mu.
+func (l *lifxdevice) relayToggled(emitter StatusEmitter, index uint8) {
+	l.stateMu.RLock()
+	// Until the first refresh the cached relays aren't known, so every relay
+	// that is on would look like it had been toggled
+	refreshed := !l.lastRefresh.IsZero()
+	l.stateMu.RUnlock()
+	if !refreshed {
+		return
+	}
+
+	l.toggleMu.Lock()
+	defer l.toggleMu.Unlock()
+
+	if time.Since(l.commanded[index]) < commandWindow {
+		return
+	}
+	for _, i := range l.toggled {
+		if i == int(index) {
+			return
+		}
+	}
+	l.toggled = append(l.toggled, int(index))
+	if l.toggleTimer == nil {
+		l.toggleTimer = time.AfterFunc(toggleWindow, func() {
+			l.emitToggled(emitter)
+		})
+	}
+}
+
+// emitToggled emits an event for the relays changed during the toggle window.
+func (l *lifxdevice) emitToggled(emitter StatusEmitter) {
+	l.toggleMu.Lock()
+	toggled := l.toggled
+	l.toggled = nil
+	l.toggleTimer = nil
+	l.toggleMu.Unlock()
+
+	sort.Ints(toggled)
+	event := &relayEvent{Relays: toggled}
+	l.matchButton(event)
+	l.logger().With("relays", toggled, "button", event.Button, "gesture", event.Gesture).Info("Relays toggled")
+	emitter.EmitEvent(context.Background(), l.id, "relays", event)
+}
+
+// matchButton sets the button of event to the one with an action toggling
+// exactly its relays, unless none or several buttons have one. A press and a
+// hold toggling the same relays can't be told apart, so the gesture is only
+// set when a single action matches.
+func (l *lifxdevice) matchButton(event *relayEvent) {
+	l.stateMu.RLock()
+	defer l.stateMu.RUnlock()
+
+	if l.buttons == nil {
+		return
+	}
+	button, gesture, matches := -1, "", 0
+	for i, b := range l.buttons.Buttons {
+		for _, a := range b.Actions {
+			if a.Target != lifxrelay.TargetRelays.String() {
+				continue
+			}
+			actionRelays := append([]int(nil), a.Relays...)
+			sort.Ints(actionRelays)
+			if !reflect.DeepEqual(actionRelays, event.Relays) {
+				continue
+			}
+			if button >= 0 && button != i {
+				return
+			}
+			button, gesture = i, a.Gesture
+			matches++
+		}
+	}
+	if button < 0 {
+		return
+	}
+	event.Button = &button
+	if matches == 1 {
+		event.Gesture = gesture
+	}
+}
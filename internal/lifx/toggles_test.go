@@ -0,0 +1,154 @@
+package lifx_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/emulator"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/relay"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"go.yhsif.com/lifxlan"
+)
+
+func TestRelayToggles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	lc, emitter, devices := startClient(t, emulator.Config{Label: "Switch", Version: emulator.ProductSwitch})
+	sw := devices[0]
+	id := deviceID(sw)
+	ctx := context.Background()
+
+	if err := lc.Refresh(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	// Holding the second button toggles the last two relays
+	var c mqtt.Command
+	payload := `{"buttons": {"buttons": [null, {"actions": [
+		{"gesture": "press", "target": "relays", "relays": [1]},
+		{"gesture": "hold", "target": "relays", "relays": [3, 2]}
+	]}]}}`
+	if err := json.Unmarshal([]byte(payload), &c); err != nil {
+		t.Fatal(err)
+	}
+	if err := lc.HandleCommand(ctx, id, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	// toggle polls until an event is emitted for the relays toggled by
+	// pressing button.
+	toggle := func(t *testing.T, button int, gesture relay.ButtonGesture) string {
+		t.Helper()
+		before := emitter.last(id, "event/relays")
+		sw.Press(button, gesture)
+		eventually(t, "the relays event", func() bool {
+			lc.PollDevices()
+			return emitter.last(id, "event/relays") != before
+		})
+		data, _ := json.Marshal(emitter.last(id, "event/relays"))
+		return string(data)
+	}
+	// quiet polls, returning true if no event is emitted.
+	quiet := func() bool {
+		before := emitter.last(id, "event/relays")
+		lc.PollDevices()
+		time.Sleep(500 * time.Millisecond)
+		return emitter.last(id, "event/relays") == before
+	}
+
+	t.Run("Press", func(t *testing.T) {
+		if event := toggle(t, 0, relay.GesturePress); event != `{"relays":[0],"button":0,"gesture":"press"}` {
+			t.Errorf("Unexpected event %s", event)
+		}
+		if !sw.RelayPower(0).On() {
+			t.Errorf("Expected the press to turn on relay 0")
+		}
+	})
+
+	t.Run("Hold", func(t *testing.T) {
+		if event := toggle(t, 1, relay.GestureHold); event != `{"relays":[2,3],"button":1,"gesture":"hold"}` {
+			t.Errorf("Unexpected event %s", event)
+		}
+		if s := lc.Device(id); !reflect.DeepEqual(s.Relays, []bool{true, false, true, true}) {
+			t.Errorf("Expected the relays to be published, got %v", s.Relays)
+		}
+	})
+
+	t.Run("AmbiguousGesture", func(t *testing.T) {
+		// Pressing and holding the last button both toggle the last relay
+		var c mqtt.Command
+		payload := `{"buttons": {"buttons": [null, null, null, {"actions": [
+			{"gesture": "press", "target": "relays", "relays": [3]},
+			{"gesture": "hold", "target": "relays", "relays": [3]}
+		]}]}}`
+		if err := json.Unmarshal([]byte(payload), &c); err != nil {
+			t.Fatal(err)
+		}
+		if err := lc.HandleCommand(ctx, id, &c); err != nil {
+			t.Fatal(err)
+		}
+
+		if event := toggle(t, 3, relay.GestureHold); event != `{"relays":[3],"button":3}` {
+			t.Errorf("Expected an event without a gesture, got %s", event)
+		}
+	})
+
+	t.Run("NoButton", func(t *testing.T) {
+		// As if changed from the LIFX app
+		sw.SetRelayPower(0, lifxlan.PowerOff)
+		sw.SetRelayPower(1, lifxlan.PowerOn)
+		before := emitter.last(id, "event/relays")
+		eventually(t, "the relays event", func() bool {
+			lc.PollDevices()
+			return emitter.last(id, "event/relays") != before
+		})
+		data, _ := json.Marshal(emitter.last(id, "event/relays"))
+		if string(data) != `{"relays":[0,1]}` {
+			t.Errorf("Expected an event without a button, got %s", data)
+		}
+	})
+
+	t.Run("FailedRefreshIgnored", func(t *testing.T) {
+		// Only relay 2 on, so turning it back on would match the third button
+		for i, on := range []bool{false, false, true, false} {
+			sw.SetRelayPower(i, getPower(on))
+		}
+		if err := lc.Refresh(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+
+		// The relays time out, so aren't known to be off
+		sw.Ignore(relay.GetRPower)
+		refreshCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+		lc.Refresh(refreshCtx, id)
+		cancel()
+		sw.Ignore()
+
+		if !quiet() {
+			t.Errorf("Expected a failed refresh not to be a toggle")
+		}
+		if s := lc.Device(id); !s.Relays[2] {
+			t.Errorf("Expected relay 2 to still be on, got %v", s.Relays)
+		}
+	})
+
+	t.Run("OwnCommandsIgnored", func(t *testing.T) {
+		if err := lc.HandleCommand(ctx, id, &mqtt.Command{Relays: map[string]bool{"2": false}}); err != nil {
+			t.Fatal(err)
+		}
+		if !quiet() {
+			t.Errorf("Expected turning off relay 2 from the bridge not to be a toggle")
+		}
+	})
+}
+
+func getPower(on bool) lifxlan.Power {
+	if on {
+		return lifxlan.PowerOn
+	}
+	return lifxlan.PowerOff
+}
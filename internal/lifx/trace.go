@@ -0,0 +1,38 @@
+package lifx
+
+import (
+	"context"
+	"net"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startSpan starts a span named lifx.<name> tagged with the device id.
+func (l *lifxdevice) startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "lifx."+name, trace.WithAttributes(attribute.String("lifx.device.id", l.id)))
+}
+
+// lock acquires l.mu, tracing how long it waited for other commands.
+func (l *lifxdevice) lock(ctx context.Context) {
+	_, span := l.startSpan(ctx, "lock")
+	l.mu.Lock()
+	span.End()
+}
+
+// dial opens a connection to the device.
+func (l *lifxdevice) dial(ctx context.Context) (net.Conn, error) {
+	_, span := l.startSpan(ctx, "dial")
+	conn, err := l.device.Dial()
+	tracing.End(span, err)
+	return conn, err
+}
+
+// request traces a single LIFX request and its ack or response.
+func (l *lifxdevice) request(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	ctx, span := l.startSpan(ctx, name)
+	err := fn(ctx)
+	tracing.End(span, err)
+	return err
+}
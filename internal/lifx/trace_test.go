@@ -0,0 +1,114 @@
+package lifx_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.yhsif.com/lifxlan"
+	"go.yhsif.com/lifxlan/light"
+	"go.yhsif.com/lifxlan/mock"
+)
+
+type nopEmitter struct{}
+
+func (nopEmitter) EmitStatus(context.Context, string, string, interface{}) error {
+	return nil
+}
+
+func (nopEmitter) EmitRetainedStatus(context.Context, string, string, interface{}) error {
+	return nil
+}
+
+func (nopEmitter) EmitEvent(context.Context, string, string, interface{}) error {
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	logging.Init(&strings.Builder{}, 0)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	backup := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(backup)
+	})
+
+	// The payloads are set before the service starts reading them
+	service := &mock.Service{
+		TB:         t,
+		Handlers:   make(map[lifxlan.MessageType]mock.HandlerFunc),
+		HandleAcks: true,
+		RawStateVersionPayload: &lifxlan.RawStateVersionPayload{
+			Version: lifxlan.HardwareVersion{VendorID: 1, ProductID: 27},
+		},
+		RawStatePowerPayload: &lifxlan.RawStatePowerPayload{Level: lifxlan.PowerOn},
+		RawStatePayload:      &light.RawStatePayload{Power: lifxlan.PowerOn},
+	}
+	device := service.Start()
+
+	lc := lifx.NewClient(nopEmitter{})
+	if err := lc.Add(device); err != nil {
+		t.Fatal(err)
+	}
+
+	on := true
+	duration := mqtt.Duration(0)
+	id := strings.Replace(device.Target().String(), ":", "", -1)
+	if err := lc.HandleCommand(context.Background(), id, &mqtt.Command{Power: &on, Duration: &duration}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The follow-up refresh happens a second after the command
+	var spans tracetest.SpanStubs
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		spans = exporter.GetSpans()
+		if findSpan(spans, "lifx.Refresh") != nil {
+			break
+		}
+	}
+
+	root := findSpan(spans, "lifx.HandleCommand")
+	if root == nil {
+		t.Fatalf("Expected a lifx.HandleCommand span, got %v", spanNames(spans))
+	}
+	for _, name := range []string{"lifx.TurnOn", "lifx.lock", "lifx.dial", "lifx.SetLightPower", "lifx.Refresh", "lifx.GetPower", "lifx.GetColor"} {
+		s := findSpan(spans, name)
+		if s == nil {
+			t.Errorf("Expected a %s span, got %v", name, spanNames(spans))
+			continue
+		}
+		if s.SpanContext.TraceID() != root.SpanContext.TraceID() {
+			t.Errorf("Expected %s to be part of the command trace", name)
+		}
+	}
+}
+
+func findSpan(spans tracetest.SpanStubs, name string) *tracetest.SpanStub {
+	for i := range spans {
+		if spans[i].Name == name {
+			return &spans[i]
+		}
+	}
+	return nil
+}
+
+func spanNames(spans tracetest.SpanStubs) []string {
+	names := make([]string, len(spans))
+	for i, s := range spans {
+		names[i] = s.Name
+	}
+	return names
+}
@@ -0,0 +1,132 @@
+package lifx
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+)
+
+// Transition holds default transition times for commands without a
+// duration. Unset fields fall back to a less specific Transition.
+type Transition struct {
+	// Duration is used for color and brightness changes, and for power
+	// changes if PowerOn or PowerOff aren't set.
+	Duration *mqtt.Duration `json:"duration,omitempty"`
+	// PowerOn is used when turning on without changing the color.
+	PowerOn *mqtt.Duration `json:"power_on,omitempty"`
+	// PowerOff is used when turning off.
+	PowerOff *mqtt.Duration `json:"power_off,omitempty"`
+}
+
+// TransitionConfig holds the default transitions of devices, looked up by
+// device id, then by the device's group (case insensitive), then Default.
+type TransitionConfig struct {
+	Default Transition            `json:"default"`
+	Devices map[string]Transition `json:"devices,omitempty"`
+	Groups  map[string]Transition `json:"groups,omitempty"`
+}
+
+// LoadTransitionConfig reads a TransitionConfig from a JSON file, eg:
+//
+//	{
+//	  "default": {"duration": "1.5s", "power_off": "5s"},
+//	  "devices": {"d073d5000001": {"power_on": "PT30S"}},
+//	  "groups": {"Bedroom": {"duration": "3s"}}
+//	}
+func LoadTransitionConfig(path string) (*TransitionConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg TransitionConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// transitionKind says which Transition field applies to a command.
+type transitionKind int
+
+const (
+	transitionChange transitionKind = iota
+	transitionOn
+	transitionOff
+)
+
+// get returns the duration for kind, if set.
+func (t Transition) get(kind transitionKind) *mqtt.Duration {
+	switch {
+	case kind == transitionOn && t.PowerOn != nil:
+		return t.PowerOn
+	case kind == transitionOff && t.PowerOff != nil:
+		return t.PowerOff
+	}
+	return t.Duration
+}
+
+// SetTransitions replaces the default transitions.
+func (lc *LIFXClient) SetTransitions(cfg TransitionConfig) {
+	lc.transitionMu.Lock()
+	defer lc.transitionMu.Unlock()
+	lc.transitions = normalizeTransitionConfig(cfg)
+}
+
+// transition returns the default transition time in milliseconds of kind
+// for the device with id.
+func (lc *LIFXClient) transition(id string, kind transitionKind) uint32 {
+	lc.transitionMu.RLock()
+	cfg := lc.transitions
+	lc.transitionMu.RUnlock()
+
+	levels := []Transition{}
+	if t, ok := cfg.Devices[id]; ok {
+		levels = append(levels, t)
+	}
+	if l := lc.devices.Get(id); l != nil && len(cfg.Groups) > 0 {
+		for name, t := range cfg.Groups {
+			if l.inGroup(name) {
+				levels = append(levels, t)
+				break
+			}
+		}
+	}
+	levels = append(levels, cfg.Default)
+
+	for _, t := range levels {
+		if d := t.get(kind); d != nil {
+			return uint32(*d)
+		}
+	}
+	return defaultDuration
+}
+
+// transitionKindOf classifies a command by what it does.
+func transitionKindOf(command *mqtt.Command) transitionKind {
+	if command.Power != nil && !*command.Power {
+		return transitionOff
+	}
+	if command.Brightness != nil && *command.Brightness == 0 && command.Board == nil && command.Image == nil && command.Text == nil {
+		return transitionOff
+	}
+	if command.Power != nil && command.Brightness == nil && command.Temperature == nil && command.Color == nil && command.Board == nil && command.Image == nil && command.Text == nil {
+		return transitionOn
+	}
+	return transitionChange
+}
+
+// normalizeTransitionConfig lower cases device ids, stripping any colons, so
+// they match device ids.
+func normalizeTransitionConfig(cfg TransitionConfig) TransitionConfig {
+	if cfg.Devices == nil {
+		return cfg
+	}
+	devices := make(map[string]Transition, len(cfg.Devices))
+	for id, t := range cfg.Devices {
+		devices[strings.ToLower(strings.Replace(id, ":", "", -1))] = t
+	}
+	cfg.Devices = devices
+	return cfg
+}
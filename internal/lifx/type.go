@@ -8,8 +8,21 @@ const (
 	Unknown LIFXType = 0
 	Light   LIFXType = 100
 	Switch  LIFXType = 200
+	Matrix  LIFXType = 300
 )
 
+func (t LIFXType) String() string {
+	switch t {
+	case Light:
+		return "light"
+	case Switch:
+		return "switch"
+	case Matrix:
+		return "matrix"
+	}
+	return "unknown"
+}
+
 func getType(hw *lifxlan.HardwareVersion) (LIFXType, *lifxlan.Product) {
 	if hw == nil {
 		return Unknown, nil
@@ -29,7 +42,11 @@ func getType(hw *lifxlan.HardwareVersion) (LIFXType, *lifxlan.Product) {
 		return Switch, &product
 	}
 
+	isMatrix := product.Features.Matrix
+	if isMatrix != nil && *isMatrix {
+		return Matrix, &product
+	}
+
 	// Could do more here, but for now, just assume it's a light.
-	// Might want to separate tiles and candles
 	return Light, &product
 }
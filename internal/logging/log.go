@@ -1,49 +1,316 @@
 package logging
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-var (
-	debugLogger   *log.Logger
-	infoLogger    *log.Logger
-	warningLogger *log.Logger
-	errorLogger   *log.Logger
+// Level is the minimum severity of messages that are logged.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
 )
 
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// prefix is the text format prefix for the level.
+func (l Level) prefix() string {
+	switch l {
+	case LevelDebug:
+		return "DEBG: "
+	case LevelInfo:
+		return "INFO: "
+	case LevelWarn:
+		return "WARN: "
+	}
+	return "ERRO: "
+}
+
+// ParseLevel parses debug, info, warn (or warning) and error, ignoring case.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+// Format is the output format of log lines.
+type Format int
+
+const (
+	// FormatText is the classic "INFO: message key=value" format.
+	FormatText Format = iota
+	// FormatLogfmt is "time=... level=info msg=... key=value".
+	FormatLogfmt
+	// FormatJSON is one JSON object per line.
+	FormatJSON
+)
+
+// ParseFormat parses text, logfmt and json, ignoring case.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "text":
+		return FormatText, nil
+	case "logfmt":
+		return FormatLogfmt, nil
+	case "json":
+		return FormatJSON, nil
+	}
+	return FormatText, fmt.Errorf("unknown log format %q", s)
+}
+
 const DefaultFlags = log.Ldate | log.Ltime
 
+// Config configures the output of all loggers.
+type Config struct {
+	// Out receives all messages. If nil, errors go to stderr and everything
+	// else to stdout.
+	Out io.Writer
+	// Flags are the log package flags used for the timestamp. Only
+	// log.Ldate and log.Ltime affect the logfmt and JSON formats, where they
+	// enable the time field.
+	Flags  int
+	Level  Level
+	Format Format
+}
+
+var (
+	mu     sync.Mutex
+	config = Config{Flags: DefaultFlags, Level: LevelInfo}
+	// Loggers for the text format, one per level
+	textLoggers [LevelError + 1]*log.Logger
+)
+
+// Init sets up text output at info level, so debug messages are not logged.
 func Init(out io.Writer, flag int) {
-	so := out
-	se := out
+	Configure(Config{Out: out, Flags: flag, Level: LevelInfo, Format: FormatText})
+}
+
+// Configure sets up the output of all loggers.
+func Configure(cfg Config) {
+	mu.Lock()
+	defer mu.Unlock()
 
-	if so == nil {
-		so = os.Stdout
+	config = cfg
+	for l := LevelDebug; l <= LevelError; l++ {
+		textLoggers[l] = log.New(writerFor(l), l.prefix(), cfg.Flags)
 	}
-	if se == nil {
-		se = os.Stderr
+}
+
+func writerFor(level Level) io.Writer {
+	if config.Out != nil {
+		return config.Out
 	}
+	if level == LevelError {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// Logger logs messages with a set of key/value fields.
+//
+// The zero value logs without fields.
+type Logger struct {
+	fields []interface{}
+}
+
+var root = &Logger{}
+
+// With returns a logger that adds the key/value pairs to every message, eg:
+// logging.With("device", id).Info("Refreshing").
+func With(kv ...interface{}) *Logger {
+	return root.With(kv...)
+}
+
+// With returns a logger with the key/value pairs added to this logger's
+// fields.
+func (lg *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(lg.fields)+len(kv))
+	fields = append(fields, lg.fields...)
+	fields = append(fields, kv...)
+	return &Logger{fields: fields}
+}
+
+func (lg *Logger) Debug(format string, v ...interface{}) {
+	lg.log(LevelDebug, format, v...)
+}
 
-	debugLogger = log.New(so, "DEBG: ", flag)
-	infoLogger = log.New(so, "INFO: ", flag)
-	warningLogger = log.New(so, "WARN: ", flag)
-	errorLogger = log.New(se, "ERRO: ", flag)
+func (lg *Logger) Info(format string, v ...interface{}) {
+	lg.log(LevelInfo, format, v...)
+}
+
+func (lg *Logger) Warn(format string, v ...interface{}) {
+	lg.log(LevelWarn, format, v...)
+}
+
+func (lg *Logger) Error(format string, v ...interface{}) {
+	lg.log(LevelError, format, v...)
 }
 
 func Debug(format string, v ...interface{}) {
-	// debugLogger.Printf(format+"\n", v...)
+	root.log(LevelDebug, format, v...)
 }
 
 func Info(format string, v ...interface{}) {
-	infoLogger.Printf(format+"\n", v...)
+	root.log(LevelInfo, format, v...)
 }
 
 func Warn(format string, v ...interface{}) {
-	warningLogger.Printf(format+"\n", v...)
+	root.log(LevelWarn, format, v...)
 }
 
 func Error(format string, v ...interface{}) {
-	errorLogger.Printf(format+"\n", v...)
+	root.log(LevelError, format, v...)
+}
+
+func (lg *Logger) log(level Level, format string, v ...interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if level < config.Level || textLoggers[level] == nil {
+		return
+	}
+
+	msg := fmt.Sprintf(format, v...)
+
+	switch config.Format {
+	case FormatLogfmt:
+		writeLine(level, formatLogfmt(level, msg, lg.fields))
+	case FormatJSON:
+		writeLine(level, formatJSON(level, msg, lg.fields))
+	default:
+		var buf bytes.Buffer
+		buf.WriteString(msg)
+		appendLogfmtFields(&buf, lg.fields)
+		textLoggers[level].Println(buf.String())
+	}
+}
+
+func writeLine(level Level, line []byte) {
+	writerFor(level).Write(append(line, '\n'))
+}
+
+func withTime() bool {
+	return config.Flags&(log.Ldate|log.Ltime) != 0
+}
+
+// pairs calls fn for each key/value pair in fields. A trailing key without a
+// value gets "(MISSING)".
+func pairs(fields []interface{}, fn func(key string, value interface{})) {
+	for i := 0; i < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+		var value interface{} = "(MISSING)"
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+		fn(key, value)
+	}
+}
+
+func formatLogfmt(level Level, msg string, fields []interface{}) []byte {
+	var buf bytes.Buffer
+	if withTime() {
+		buf.WriteString("time=")
+		buf.WriteString(time.Now().Format(time.RFC3339))
+		buf.WriteByte(' ')
+	}
+	buf.WriteString("level=")
+	buf.WriteString(level.String())
+	buf.WriteString(" msg=")
+	buf.WriteString(logfmtValue(msg))
+	appendLogfmtFields(&buf, fields)
+	return buf.Bytes()
+}
+
+func appendLogfmtFields(buf *bytes.Buffer, fields []interface{}) {
+	pairs(fields, func(key string, value interface{}) {
+		buf.WriteByte(' ')
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(stringify(value)))
+	})
+}
+
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func stringify(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
+
+func formatJSON(level Level, msg string, fields []interface{}) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	if withTime() {
+		writeJSONPair(&buf, "time", time.Now().Format(time.RFC3339))
+		buf.WriteByte(',')
+	}
+	writeJSONPair(&buf, "level", level.String())
+	buf.WriteByte(',')
+	writeJSONPair(&buf, "msg", msg)
+	pairs(fields, func(key string, value interface{}) {
+		buf.WriteByte(',')
+		writeJSONPair(&buf, key, value)
+	})
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+func writeJSONPair(buf *bytes.Buffer, key string, value interface{}) {
+	k, _ := json.Marshal(key)
+	buf.Write(k)
+	buf.WriteByte(':')
+
+	switch value.(type) {
+	case error, fmt.Stringer:
+		value = stringify(value)
+	}
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(v)
 }
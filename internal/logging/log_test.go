@@ -35,3 +35,64 @@ func TestLogging(t *testing.T) {
 	}
 	buf.Reset()
 }
+
+func TestLevel(t *testing.T) {
+	var buf bytes.Buffer
+
+	logging.Configure(logging.Config{Out: &buf, Level: logging.LevelWarn})
+
+	logging.Info("info message")
+	if buf.String() != "" {
+		t.Errorf("Info message should not be logged at warn level")
+	}
+
+	logging.Warn("warning message")
+	if got, want := buf.String(), "WARN: warning message\n"; got != want {
+		t.Errorf("Warning message was not logged correctly. Got %q, want %q", got, want)
+	}
+	buf.Reset()
+
+	logging.Configure(logging.Config{Out: &buf, Level: logging.LevelDebug})
+
+	logging.Debug("debug message")
+	if got, want := buf.String(), "DEBG: debug message\n"; got != want {
+		t.Errorf("Debug message was not logged correctly. Got %q, want %q", got, want)
+	}
+}
+
+func TestFields(t *testing.T) {
+	cases := []struct {
+		format logging.Format
+		want   string
+	}{
+		{logging.FormatText, "INFO: set light device=d073d5000000 label=\"Living Room\" on=true\n"},
+		{logging.FormatLogfmt, "level=info msg=\"set light\" device=d073d5000000 label=\"Living Room\" on=true\n"},
+		{logging.FormatJSON, `{"level":"info","msg":"set light","device":"d073d5000000","label":"Living Room","on":true}` + "\n"},
+	}
+
+	for _, c := range cases {
+		var buf bytes.Buffer
+		logging.Configure(logging.Config{Out: &buf, Level: logging.LevelInfo, Format: c.format})
+
+		logger := logging.With("device", "d073d5000000")
+		logger.With("label", "Living Room", "on", true).Info("set %s", "light")
+		if got := buf.String(); got != c.want {
+			t.Errorf("Message was not logged correctly. Got %q, want %q", got, c.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	if level, err := logging.ParseLevel("WARNING"); err != nil || level != logging.LevelWarn {
+		t.Errorf("Expected warn level, got %v %v", level, err)
+	}
+	if _, err := logging.ParseLevel("verbose"); err == nil {
+		t.Errorf("Expected an error for an unknown level")
+	}
+	if format, err := logging.ParseFormat("json"); err != nil || format != logging.FormatJSON {
+		t.Errorf("Expected json format, got %v %v", format, err)
+	}
+	if _, err := logging.ParseFormat("xml"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
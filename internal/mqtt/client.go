@@ -1,56 +1,89 @@
 package mqtt
 
 import (
+	"context"
 	"encoding/json"
 	"net/url"
 	"strings"
+	"sync/atomic"
 
 	"github.com/dchest/uniuri"
 	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"github.com/denwilliams/go-lifx-mqtt/internal/tracing"
 	pm "github.com/eclipse/paho.mqtt.golang"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func NewMQTTClient(uri *url.URL, baseTopic string, subscribeTopic string) *MQTTClient {
-	// Create a new MQTT client with the default options
-	opts := pm.NewClientOptions().AddBroker(uri.String()).SetClientID("lifx_mqtt_" + uniuri.New()).SetOnConnectHandler(onConnectHandler).SetConnectionLostHandler(onConnectionLostHandler)
+	mc := &MQTTClient{baseTopic: baseTopic, subscribeTopic: subscribeTopic}
+
+	// Create a new MQTT client with the default options. Paho reconnects
+	// automatically after the connection is lost.
+	opts := pm.NewClientOptions().AddBroker(uri.String()).SetClientID("lifx_mqtt_" + uniuri.New()).SetOnConnectHandler(mc.onConnect).SetConnectionLostHandler(mc.onConnectionLost)
 
 	client := pm.NewClient(opts)
-	return &MQTTClient{client: &client, baseTopic: baseTopic, subscribeTopic: subscribeTopic}
+	mc.client = &client
+	return mc
 }
 
 type MQTTClient struct {
 	client         *pm.Client
 	baseTopic      string
 	subscribeTopic string
+	messageHandler pm.MessageHandler
+	// routes handle topics under the command topic by their first level
+	routes map[string]RouteHandler
+	// lost is set when the connection drops so the subscription is renewed
+	// on reconnect
+	lost atomic.Bool
+}
+
+// RouteHandler handles the raw payload of a message routed by Handle.
+type RouteHandler func(ctx context.Context, id string, payload []byte) error
+
+// Handle routes messages on {prefix}/set/{name}/{id} to h instead of parsing
+// them as commands. It must be called before Connect.
+func (mc *MQTTClient) Handle(name string, h RouteHandler) {
+	if mc.routes == nil {
+		mc.routes = make(map[string]RouteHandler)
+	}
+	mc.routes[name] = h
 }
 
 func (mc *MQTTClient) Publish(topic string, data interface{}) error {
+	return mc.publish(topic, data, false)
+}
+
+// PublishRetained publishes a message that the broker keeps for future
+// subscribers.
+func (mc *MQTTClient) PublishRetained(topic string, data interface{}) error {
+	return mc.publish(topic, data, true)
+}
+
+func (mc *MQTTClient) publish(topic string, data interface{}, retained bool) error {
 	payload, err := serializePayload(data)
 	if err != nil {
+		publishFailures.Inc()
 		return err
 	}
 
 	fullTopic := mc.baseTopic + topic
 
 	// Publish a message to the topic with a QoS of 1
-	if token := (*mc.client).Publish(fullTopic, 1, false, payload); token.Wait() && token.Error() != nil {
+	if token := (*mc.client).Publish(fullTopic, 1, retained, payload); token.Wait() && token.Error() != nil {
 		// TODO: don't panic, just return
 		// panic(token.Error())
-		logging.Warn("Error publishing message: %s", token.Error())
-		return err
+		logging.With("topic", fullTopic).Warn("Error publishing message: %s", token.Error())
+		publishFailures.Inc()
+		return token.Error()
 	}
 
+	messagesPublished.Inc()
 	return nil
 }
 
 func (mc *MQTTClient) Connect(h CommandHandler) {
-	// Connect to the MQTT broker
-	if token := (*mc.client).Connect(); token.Wait() && token.Error() != nil {
-		panic(token.Error())
-	}
-
-	// logging.Info("Connected to MQTT")
-
 	prefix := strings.Replace(mc.subscribeTopic, "#", "", 1)
 
 	// Set up a callback function to handle incoming messages
@@ -60,36 +93,75 @@ func (mc *MQTTClient) Connect(h CommandHandler) {
 			return
 		}
 		id := strings.Replace(topic, prefix, "", 1)
+		messagesReceived.Inc()
+
+		ctx, span := tracing.Start(context.Background(), "mqtt.receive",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(attribute.String("messaging.destination.name", topic)))
 
 		bytes := msg.Payload()
+		if name, sub, ok := strings.Cut(id, "/"); ok && mc.routes[name] != nil {
+			logging.With("topic", topic).Debug("Received message")
+			go func() {
+				err := mc.routes[name](ctx, sub, bytes)
+				if err != nil {
+					logging.With("topic", topic).Warn("Error handling message: %s", err)
+				}
+				tracing.End(span, err)
+			}()
+			return
+		}
+
 		payload, err := parsePayload(&bytes)
 		if err != nil {
-			logging.Warn("Error unmarshalling JSON: %s %v", err, string(bytes))
+			parseErrors.Inc()
+			logging.With("topic", topic, "payload", string(bytes)).Warn("Error unmarshalling JSON: %s", err)
+			tracing.End(span, err)
 			return
 		}
-		logging.Debug("Received message on topic %s: %s", id, payload.String())
+		logging.With("topic", topic, "command", payload.String()).Debug("Received message")
 
 		// messages := make(chan string)
 		// go func() { messages <- "ping" }()
 		// msg := <-messages
 
 		go func() {
-			h.HandleCommand(id, payload)
+			tracing.End(span, h.HandleCommand(ctx, id, payload))
 		}()
 	}
 
-	// Subscribe to the topic with a QoS of 1
-	if token := (*mc.client).Subscribe(mc.subscribeTopic, 1, messageHandler); token.Wait() && token.Error() != nil {
+	// Set before connecting, as onConnect reads it when reconnecting
+	mc.messageHandler = messageHandler
+
+	// Connect to the MQTT broker
+	if token := (*mc.client).Connect(); token.Wait() && token.Error() != nil {
 		panic(token.Error())
 	}
-	logging.Info("Subscribed to %s", mc.subscribeTopic)
+
+	if err := mc.subscribe(); err != nil {
+		panic(err)
+	}
+}
+
+// subscribe subscribes to the command topic with a QoS of 1.
+func (mc *MQTTClient) subscribe() error {
+	if token := (*mc.client).Subscribe(mc.subscribeTopic, 1, mc.messageHandler); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	logging.With("topic", mc.subscribeTopic).Info("Subscribed")
+	return nil
+}
+
+// IsConnected returns true if the client is currently connected to the broker.
+func (mc *MQTTClient) IsConnected() bool {
+	return (*mc.client).IsConnectionOpen()
 }
 
 func (mc *MQTTClient) Disconnect() {
 	logging.Info("Disconnecting from MQTT")
 
 	// Unsubscribe from the topic
-	if token := (*mc.client).Unsubscribe(mc.baseTopic); token.Wait() && token.Error() != nil {
+	if token := (*mc.client).Unsubscribe(mc.subscribeTopic); token.Wait() && token.Error() != nil {
 		panic(token.Error())
 	}
 
@@ -119,10 +191,22 @@ func serializePayload(payload interface{}) ([]byte, error) {
 	return json.Marshal(payload)
 }
 
-func onConnectHandler(c pm.Client) {
+func (mc *MQTTClient) onConnect(c pm.Client) {
 	logging.Info("Connected to MQTT")
+
+	// The broker may have forgotten the subscription, eg: after a restart
+	if mc.lost.Swap(false) && mc.messageHandler != nil {
+		// Paho waits for this handler to return before processing the
+		// subscription ack, so subscribe in the background
+		go func() {
+			if err := mc.subscribe(); err != nil {
+				logging.With("topic", mc.subscribeTopic).Error("Error resubscribing: %s", err)
+			}
+		}()
+	}
 }
 
-func onConnectionLostHandler(c pm.Client, err error) {
-	panic(err.Error())
+func (mc *MQTTClient) onConnectionLost(c pm.Client, err error) {
+	logging.Warn("Lost connection to MQTT, reconnecting: %s", err)
+	mc.lost.Store(true)
 }
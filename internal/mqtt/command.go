@@ -1,18 +1,213 @@
 package mqtt
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 type Command struct {
-	Brightness  *uint16 `json:"brightness"`
-	Color       *string `json:"color"`
-	Temperature *uint16 `json:"temp"`
-	Duration    *uint32 `json:"duration"`
-	Relay0      *bool   `json:"relay0"`
-	Relay1      *bool   `json:"relay1"`
-	Relay2      *bool   `json:"relay2"`
-	Relay3      *bool   `json:"relay3"`
+	Power       *bool     `json:"power"`
+	Brightness  *uint16   `json:"brightness"`
+	Color       *string   `json:"color"`
+	Temperature *uint16   `json:"temp"`
+	Duration    *Duration `json:"duration"`
+	// Relays turns relays of a switch on or off, keyed by index or name
+	Relays map[string]bool `json:"relays"`
+	// Board is rows of hex colors, top row first, for matrix (tile) devices
+	Board [][]string `json:"board"`
+	// Fade is a long-running transition through several colors over Duration
+	Fade *Fade `json:"fade"`
+	// Adaptive turns adaptive color temperature on or off
+	Adaptive *Adaptive `json:"adaptive"`
+	// Effect starts a continuous effect, or stops one
+	Effect *Effect `json:"effect"`
+	// Image shows a picture or animation on matrix (tile) devices
+	Image *Image `json:"image"`
+	// Text shows a message on matrix (tile) devices
+	Text *Text `json:"text"`
+	// Buttons configures the buttons of a switch
+	Buttons *ButtonConfig `json:"buttons"`
+}
+
+// UnmarshalJSON also accepts relay0, relay1 and so on, as relays by index.
+func (c *Command) UnmarshalJSON(b []byte) error {
+	// A plain type so this method isn't called again
+	type command Command
+	if err := json.Unmarshal(b, (*command)(c)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	for key, value := range fields {
+		index, ok := strings.CutPrefix(key, "relay")
+		if !ok {
+			continue
+		}
+		if _, err := strconv.ParseUint(index, 10, 8); err != nil {
+			continue
+		}
+		var power *bool
+		if err := json.Unmarshal(value, &power); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if power == nil {
+			continue
+		}
+		if c.Relays == nil {
+			c.Relays = make(map[string]bool)
+		}
+		c.Relays[index] = *power
+	}
+	return nil
+}
+
+// ButtonConfig is the configuration of a switch's buttons. Fields that aren't
+// given are left unchanged.
+type ButtonConfig struct {
+	// HapticDuration is how long the switch vibrates when a button is
+	// pressed, 0 for not at all
+	HapticDuration *Duration `json:"haptic_duration,omitempty"`
+	// BacklightOn and BacklightOff are the hex colors of a button's backlight
+	// while what it controls is on and off
+	BacklightOn  string `json:"backlight_on,omitempty"`
+	BacklightOff string `json:"backlight_off,omitempty"`
+	// Buttons are the actions of each button from the first, null leaves a
+	// button unchanged
+	Buttons []*Button `json:"buttons,omitempty"`
+}
+
+// Button is the actions of a single button.
+type Button struct {
+	Actions []ButtonAction `json:"actions"`
+}
+
+// ButtonAction is what a button does when it is pressed a certain way.
+type ButtonAction struct {
+	// Gesture is "press", "hold", "press_press", "press_hold" or "hold_hold"
+	Gesture string `json:"gesture"`
+	// Target is what is toggled, "relays" of the switch itself, a "device",
+	// "device_relays" of another switch, or a "location", "group" or "scene"
+	Target string `json:"target"`
+	// Relays are the indexes of the relays toggled, for relays and
+	// device_relays
+	Relays []int `json:"relays,omitempty"`
+	// Device is the id of the device, for device and device_relays
+	Device string `json:"device,omitempty"`
+	// ID is the uuid of the location, group or scene, as 32 hex digits
+	ID string `json:"id,omitempty"`
+}
+
+// Text is a message drawn on a matrix device's board in a bitmap font.
+// Text that doesn't fit, or is given a Speed, scrolls across the board from
+// right to left until it has passed Repeat times or another command arrives.
+type Text struct {
+	Text string `json:"text"`
+	// Color is the hex color of the text, defaulting to white
+	Color string `json:"color,omitempty"`
+	// Background is the hex color behind the text, defaulting to off
+	Background string `json:"background,omitempty"`
+	// Speed is how many pixels the text scrolls per second, defaulting to 10
+	Speed float64 `json:"speed,omitempty"`
+	// Repeat is how many times the text scrolls past, 0 for forever
+	Repeat int `json:"repeat,omitempty"`
+}
+
+// Image is a picture or animation, scaled to fit a matrix device's board.
+// Animations play until they finish or another command arrives.
+type Image struct {
+	// Data is a PNG, GIF or JPEG, or raw RGB pixels, base64 encoded in JSON
+	Data []byte `json:"data"`
+	// Format is "rgb" for raw pixels, otherwise it is detected from Data
+	Format string `json:"format,omitempty"`
+	// Width and Height are the size of raw pixels, defaulting to the board's
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// Loops is how many times to play an animation, defaulting to the GIF's
+	// own loop count
+	Loops int `json:"loops,omitempty"`
+}
+
+// Effect is a continuous effect, running until it is stopped or another
+// command arrives.
+type Effect struct {
+	// Name is "colorloop", "candle", "strobe" or "breathe", rendered by the
+	// bridge, "morph", "flame" or "sky" for tiles, or "move" for strips,
+	// which run on the device, or "none" to stop an effect
+	Name string `json:"name"`
+	// Colors are hex colors, used by strobe and breathe, and as the palette
+	// of morph
+	Colors []string `json:"colors,omitempty"`
+	// Brightness is a percentage, defaulting to full
+	Brightness *uint16 `json:"brightness,omitempty"`
+	// Period is how long one cycle of the effect takes, the speed of device
+	// effects
+	Period *Duration `json:"period,omitempty"`
+	// FPS overrides the default frame rate
+	FPS float64 `json:"fps,omitempty"`
+	// Sky is "sunrise", "sunset" or "clouds", for sky
+	Sky string `json:"sky,omitempty"`
+	// Direction is "right" or "left", for move
+	Direction string `json:"direction,omitempty"`
+}
+
+// Adaptive adjusts a light's color temperature, and optionally brightness,
+// with the height of the sun while the light is on. It is given as true,
+// false or an object of settings, which implies enabled.
+type Adaptive struct {
+	Enabled bool `json:"enabled"`
+	// MinTemperature and MaxTemperature narrow the device's kelvin range
+	MinTemperature uint16 `json:"min_temp,omitempty"`
+	MaxTemperature uint16 `json:"max_temp,omitempty"`
+	// MinBrightness and MaxBrightness are percentages. Brightness is only
+	// adjusted if one is set.
+	MinBrightness *uint16 `json:"min_brightness,omitempty"`
+	MaxBrightness *uint16 `json:"max_brightness,omitempty"`
+}
+
+func (a *Adaptive) UnmarshalJSON(b []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(b, &enabled); err == nil {
+		*a = Adaptive{Enabled: enabled}
+		return nil
+	}
+
+	// A plain type so this method isn't called again
+	type settings Adaptive
+	s := settings{Enabled: true}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*a = Adaptive(s)
+	return nil
+}
+
+// AdjustsBrightness returns true if brightness is adjusted as well as color
+// temperature.
+func (a *Adaptive) AdjustsBrightness() bool {
+	return a.MinBrightness != nil || a.MaxBrightness != nil
+}
+
+// Fade is a curve of colors to transition through, either a preset or stops.
+type Fade struct {
+	// Preset is a built in curve, "sunrise" or "sunset"
+	Preset string     `json:"preset,omitempty"`
+	Stops  []FadeStop `json:"stops,omitempty"`
+}
+
+// FadeStop is a color on a fade's curve. Stops without At are spread evenly
+// between their neighbours.
+type FadeStop struct {
+	// At is how far through the fade the color is reached, from 0 to 1
+	At          *float64 `json:"at,omitempty"`
+	Color       *string  `json:"color,omitempty"`
+	Brightness  *uint16  `json:"brightness,omitempty"`
+	Temperature *uint16  `json:"temp,omitempty"`
 }
 
 func safeUint16(s *uint16) string {
@@ -22,6 +217,20 @@ func safeUint16(s *uint16) string {
 	return fmt.Sprintf("%d", *s)
 }
 
+func safeBool(s *bool) string {
+	if s == nil {
+		return "(nil)"
+	}
+	return fmt.Sprintf("%v", *s)
+}
+
+func safeDuration(d *Duration) string {
+	if d == nil {
+		return "(nil)"
+	}
+	return d.String()
+}
+
 func safeString(s *string) string {
 	if s == nil {
 		return "(nil)"
@@ -30,9 +239,9 @@ func safeString(s *string) string {
 }
 
 func (c *Command) String() string {
-	return fmt.Sprintf("brightness=%s color=%s temperature=%s duration=%d", safeUint16(c.Brightness), safeString(c.Color), safeUint16(c.Temperature), c.Duration)
+	return fmt.Sprintf("power=%s brightness=%s color=%s temperature=%s duration=%s", safeBool(c.Power), safeUint16(c.Brightness), safeString(c.Color), safeUint16(c.Temperature), safeDuration(c.Duration))
 }
 
 type CommandHandler interface {
-	HandleCommand(id string, command *Command) error
+	HandleCommand(ctx context.Context, id string, command *Command) error
 }
@@ -0,0 +1,40 @@
+package mqtt_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+)
+
+func TestCommandRelays(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]bool
+	}{
+		{"None", `{"power": true}`, nil},
+		{"Named", `{"relays": {"fan": true, "2": false}}`, map[string]bool{"fan": true, "2": false}},
+		{"Legacy", `{"relay0": true, "relay3": false, "relay1": null}`, map[string]bool{"0": true, "3": false}},
+		{"Both", `{"relays": {"fan": true}, "relay1": true}`, map[string]bool{"fan": true, "1": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c mqtt.Command
+			if err := json.Unmarshal([]byte(tt.in), &c); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(c.Relays, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, c.Relays)
+			}
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		var c mqtt.Command
+		if err := json.Unmarshal([]byte(`{"relay0": "on"}`), &c); err == nil {
+			t.Errorf("Expected an error, got %v", c.Relays)
+		}
+	})
+}
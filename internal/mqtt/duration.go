@@ -0,0 +1,99 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration is a transition time in milliseconds. In JSON it is either a
+// number of milliseconds, or a string holding a Go duration (eg: "2s",
+// "1m30s") or an ISO-8601 duration (eg: "PT5M", "PT1.5S").
+type Duration uint32
+
+// ErrInvalidDuration is returned for durations that can't be parsed.
+var ErrInvalidDuration = errors.New("invalid duration")
+
+// isoDuration matches the day and time parts of an ISO-8601 duration.
+var isoDuration = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// ParseDuration parses a Go or ISO-8601 duration, or a plain number of
+// milliseconds.
+func ParseDuration(s string) (Duration, error) {
+	s = strings.TrimSpace(s)
+	if ms, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return Duration(ms), nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return FromDuration(d)
+	}
+
+	m := isoDuration.FindStringSubmatch(strings.ToUpper(s))
+	if m == nil || s == "P" || strings.HasSuffix(strings.ToUpper(s), "T") {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidDuration, s)
+	}
+	var d float64
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+1] == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(m[i+1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidDuration, s)
+		}
+		d += v * float64(unit)
+	}
+	if d > math.MaxInt64 {
+		return 0, fmt.Errorf("%w: %q is too long", ErrInvalidDuration, s)
+	}
+	return FromDuration(time.Duration(d))
+}
+
+// FromDuration converts d to whole milliseconds.
+func FromDuration(d time.Duration) (Duration, error) {
+	if d < 0 {
+		return 0, fmt.Errorf("%w: %s is negative", ErrInvalidDuration, d)
+	}
+	if d.Milliseconds() > math.MaxUint32 {
+		return 0, fmt.Errorf("%w: %s is too long", ErrInvalidDuration, d)
+	}
+	return Duration(d.Milliseconds()), nil
+}
+
+// Duration returns d as a time.Duration.
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d) * time.Millisecond
+}
+
+func (d Duration) String() string {
+	return d.Duration().String()
+}
+
+// MarshalJSON encodes d as a number of milliseconds.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(uint32(d))
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		parsed, err := ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*d = parsed
+		return nil
+	}
+
+	var ms uint32
+	if err := json.Unmarshal(b, &ms); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidDuration, b)
+	}
+	*d = Duration(ms)
+	return nil
+}
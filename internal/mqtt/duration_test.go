@@ -0,0 +1,88 @@
+package mqtt_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want mqtt.Duration
+	}{
+		{"1500", 1500},
+		{"0", 0},
+		{"2s", 2000},
+		{"1m30s", 90000},
+		{"250ms", 250},
+		{"PT5M", 300000},
+		{"PT1.5S", 1500},
+		{"pt2h", 7200000},
+		{"P1D", 86400000},
+		{"P1DT1H", 90000000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := mqtt.ParseDuration(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+
+	for _, in := range []string{"", "soon", "-1s", "P", "PT", "P1DT", "PT5X", "P1000000D"} {
+		t.Run("Invalid"+in, func(t *testing.T) {
+			if _, err := mqtt.ParseDuration(in); !errors.Is(err, mqtt.ErrInvalidDuration) {
+				t.Errorf("Expected ErrInvalidDuration, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCommandDuration(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    mqtt.Duration
+	}{
+		{`{"duration": 1500}`, 1500},
+		{`{"duration": "2s"}`, 2000},
+		{`{"duration": "PT5M"}`, 300000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.payload, func(t *testing.T) {
+			var c mqtt.Command
+			if err := json.Unmarshal([]byte(tt.payload), &c); err != nil {
+				t.Fatal(err)
+			}
+			if c.Duration == nil || *c.Duration != tt.want {
+				t.Errorf("Expected %d, got %v", tt.want, c.Duration)
+			}
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		var c mqtt.Command
+		if err := json.Unmarshal([]byte(`{"duration": "later"}`), &c); err == nil {
+			t.Errorf("Expected an error")
+		}
+	})
+
+	t.Run("Marshal", func(t *testing.T) {
+		d := mqtt.Duration(2000)
+		b, err := json.Marshal(mqtt.Command{Duration: &d})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got map[string]interface{}
+		json.Unmarshal(b, &got)
+		if got["duration"] != float64(2000) {
+			t.Errorf("Expected duration 2000, got %v", got["duration"])
+		}
+	})
+}
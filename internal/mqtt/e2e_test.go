@@ -0,0 +1,217 @@
+package mqtt_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx/emulator"
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	pm "github.com/eclipse/paho.mqtt.golang"
+	broker "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/rs/zerolog"
+)
+
+// startBroker starts an embedded MQTT broker listening on addr.
+func startBroker(t *testing.T, addr string) *broker.Server {
+	t.Helper()
+
+	log := zerolog.New(io.Discard)
+	server := broker.New(&broker.Options{Logger: &log})
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.AddListener(listeners.NewTCP("tcp", addr, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+// freeAddr returns a local address that nothing is listening on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// observer records the last message published to every topic.
+type observer struct {
+	client pm.Client
+
+	mu       sync.Mutex
+	messages map[string]string
+}
+
+func newObserver(t *testing.T, uri string, topic string) *observer {
+	t.Helper()
+
+	o := &observer{messages: map[string]string{}}
+	opts := pm.NewClientOptions().AddBroker(uri).SetClientID("observer")
+	o.client = pm.NewClient(opts)
+	if token := o.client.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+	t.Cleanup(func() { o.client.Disconnect(0) })
+
+	token := o.client.Subscribe(topic, 1, func(c pm.Client, msg pm.Message) {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		o.messages[msg.Topic()] = string(msg.Payload())
+	})
+	if token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+	return o
+}
+
+func (o *observer) publish(t *testing.T, topic string, payload string) {
+	t.Helper()
+	if token := o.client.Publish(topic, 1, false, payload); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+}
+
+func (o *observer) last(topic string) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.messages[topic]
+}
+
+// eventually waits up to 10 seconds for cond to be true.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("Timed out waiting for %s", what)
+}
+
+func TestEndToEnd(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode.")
+	}
+
+	logging.Init(&strings.Builder{}, 0)
+
+	addr := freeAddr(t)
+	server := startBroker(t, addr)
+	t.Cleanup(func() { server.Close() })
+
+	bulb, err := emulator.Start(emulator.Config{Label: "Bulb", Version: emulator.ProductA19})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bulb.Close() })
+	id := strings.Replace(bulb.Target().String(), ":", "", -1)
+
+	uri := &url.URL{Scheme: "tcp", Host: addr}
+	mc := mqtt.NewMQTTClient(uri, "lifx", "lifx/set/#")
+	lc := lifx.NewClient(mqtt.NewMqttStatusEmitter(mc))
+	if err := lc.Add(bulb.LIFXDevice()); err != nil {
+		t.Fatal(err)
+	}
+	lc.LoadDevices()
+	eventually(t, "the bulb to load", func() bool {
+		return lc.Health().Loaded == 1
+	})
+
+	var routedMu sync.Mutex
+	routed := map[string]string{}
+	mc.Handle("schedule", func(ctx context.Context, id string, payload []byte) error {
+		routedMu.Lock()
+		defer routedMu.Unlock()
+		routed[id] = string(payload)
+		return nil
+	})
+
+	mc.Connect(lc)
+	t.Cleanup(mc.Disconnect)
+
+	obs := newObserver(t, uri.String(), "lifx/status/#")
+	powerTopic := "lifx/status/" + id + "/power"
+
+	t.Run("Command", func(t *testing.T) {
+		obs.publish(t, "lifx/set/"+id, `{"power":true,"duration":0}`)
+		eventually(t, "the bulb to turn on", func() bool {
+			return bulb.Power().On()
+		})
+		eventually(t, "the power status", func() bool {
+			return obs.last(powerTopic) == "true"
+		})
+	})
+
+	t.Run("EncodedString", func(t *testing.T) {
+		obs.publish(t, "lifx/set/"+id, `"{\"brightness\":50,\"temp\":3000,\"duration\":0}"`)
+		eventually(t, "the bulb to change color", func() bool {
+			return bulb.Color().Kelvin == 3000
+		})
+	})
+
+	t.Run("InvalidPayload", func(t *testing.T) {
+		obs.publish(t, "lifx/set/"+id, `{"power":`)
+		obs.publish(t, "lifx/set/"+id, `{"power":false,"duration":0}`)
+		eventually(t, "the bulb to turn off", func() bool {
+			return !bulb.Power().On()
+		})
+	})
+
+	t.Run("UnknownDevice", func(t *testing.T) {
+		obs.publish(t, "lifx/set/d073d5ffffff", `{"power":true}`)
+		obs.publish(t, "lifx/set/"+id, `{"power":true,"duration":0}`)
+		eventually(t, "the bulb to turn on", func() bool {
+			return bulb.Power().On()
+		})
+	})
+
+	t.Run("Route", func(t *testing.T) {
+		obs.publish(t, "lifx/set/schedule/night", `{"cron":"0 23 * * *"}`)
+		eventually(t, "the message to be routed", func() bool {
+			routedMu.Lock()
+			defer routedMu.Unlock()
+			return routed["night"] == `{"cron":"0 23 * * *"}`
+		})
+	})
+
+	t.Run("Reconnect", func(t *testing.T) {
+		server.Close()
+		eventually(t, "the connection to drop", func() bool {
+			return !mc.IsConnected()
+		})
+
+		server = startBroker(t, addr)
+		eventually(t, "the client to reconnect", func() bool {
+			return mc.IsConnected()
+		})
+
+		// Replace the observer rather than wait for it to reconnect
+		obs.client.Disconnect(0)
+		obs = newObserver(t, uri.String(), "lifx/status/#")
+		eventually(t, "the command to be handled", func() bool {
+			obs.publish(t, "lifx/set/"+id, `{"power":false,"duration":0}`)
+			time.Sleep(100 * time.Millisecond)
+			return !bulb.Power().On()
+		})
+		eventually(t, "the power status", func() bool {
+			return obs.last(powerTopic) == "false"
+		})
+	})
+}
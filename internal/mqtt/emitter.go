@@ -17,6 +17,18 @@ type MqttStatusEmitter struct {
 
 func (e *MqttStatusEmitter) EmitStatus(ctx context.Context, id string, statusKey string, data interface{}) error {
 	topic := fmt.Sprintf("/status/%s/%s", id, statusKey)
-	logging.Info("Publishing to %s %v", topic, data)
+	logging.With("topic", topic).Info("Publishing %v", data)
+	return e.client.Publish(topic, data)
+}
+
+func (e *MqttStatusEmitter) EmitRetainedStatus(ctx context.Context, id string, statusKey string, data interface{}) error {
+	topic := fmt.Sprintf("/status/%s/%s", id, statusKey)
+	logging.With("topic", topic, "retained", true).Info("Publishing %v", data)
+	return e.client.PublishRetained(topic, data)
+}
+
+func (e *MqttStatusEmitter) EmitEvent(ctx context.Context, id string, eventKey string, data interface{}) error {
+	topic := fmt.Sprintf("/event/%s/%s", id, eventKey)
+	logging.With("topic", topic).Info("Publishing %v", data)
 	return e.client.Publish(topic, data)
 }
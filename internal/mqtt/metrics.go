@@ -0,0 +1,28 @@
+package mqtt
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	messagesReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mqtt_messages_received_total",
+		Help: "The total number of MQTT command messages received",
+	})
+
+	messagesPublished = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mqtt_messages_published_total",
+		Help: "The total number of MQTT messages published",
+	})
+
+	publishFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mqtt_publish_failures_total",
+		Help: "The total number of MQTT messages that failed to publish",
+	})
+
+	parseErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "mqtt_parse_errors_total",
+		Help: "The total number of MQTT command messages that could not be parsed",
+	})
+)
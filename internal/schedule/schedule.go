@@ -0,0 +1,445 @@
+// Package schedule runs commands and scenes at times given by cron
+// expressions or solar events, so lights keep to their schedule without a
+// home automation server. Entries are persisted to a JSON file.
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dchest/uniuri"
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"github.com/denwilliams/go-lifx-mqtt/internal/solar"
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	// ErrNotFound is returned for unknown entries.
+	ErrNotFound = errors.New("not found")
+	// ErrInvalid is returned for entries that can't be scheduled.
+	ErrInvalid = errors.New("invalid schedule")
+)
+
+// idleWait is how long Run sleeps when nothing is scheduled, in case the
+// next solar event moves into range.
+var idleWait = 24 * time.Hour
+
+// Entry is a scheduled action. It runs at the times of either Cron or Solar,
+// and applies either Command to Target or Scene.
+type Entry struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// Cron is a standard 5 field cron expression, eg: "0 23 * * *", or a
+	// descriptor like "@daily" or "@every 1h"
+	Cron string `json:"cron,omitempty"`
+	// Solar is a solar event, "dawn", "sunrise", "noon", "sunset" or "dusk"
+	Solar solar.Event `json:"solar,omitempty"`
+	// Offset moves a solar event earlier or later, eg: "-30m"
+	Offset string `json:"offset,omitempty"`
+	// Target is a device id or "group/{name}" for Command
+	Target  string                   `json:"target,omitempty"`
+	Command *mqtt.Command            `json:"command,omitempty"`
+	Scene   map[string]*mqtt.Command `json:"scene,omitempty"`
+	// Disabled entries are kept but don't run
+	Disabled bool `json:"disabled,omitempty"`
+
+	Next      *time.Time `json:"next,omitempty"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// Handler applies scheduled actions, implemented by lifx.LIFXClient.
+type Handler interface {
+	HandleCommand(ctx context.Context, id string, command *mqtt.Command) error
+	ApplyScene(ctx context.Context, scene map[string]*mqtt.Command) map[string]error
+}
+
+// Config configures a Scheduler.
+type Config struct {
+	// Path is the file entries are persisted to, none if empty
+	Path string
+	// Coordinates are required for solar events
+	Coordinates *solar.Coordinates
+}
+
+// Scheduler runs entries.
+type Scheduler struct {
+	h   Handler
+	cfg Config
+
+	mu       sync.Mutex
+	entries  map[string]*entry
+	onChange func([]Entry)
+	// wake interrupts Run when entries change
+	wake chan struct{}
+}
+
+// entry is an Entry with its parsed schedule.
+type entry struct {
+	Entry
+	cron   cron.Schedule
+	offset time.Duration
+}
+
+// New creates a Scheduler, loading any entries saved at cfg.Path.
+func New(h Handler, cfg Config) (*Scheduler, error) {
+	s := &Scheduler{h: h, cfg: cfg, entries: make(map[string]*entry), wake: make(chan struct{}, 1)}
+	if cfg.Path == "" {
+		return s, nil
+	}
+
+	b, err := os.ReadFile(cfg.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved []Entry
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.Path, err)
+	}
+
+	now := time.Now()
+	for _, e := range saved {
+		parsed, err := s.parse(e)
+		if err != nil {
+			return nil, fmt.Errorf("%s: entry %s: %w", cfg.Path, e.ID, err)
+		}
+		s.schedule(parsed, now)
+		s.entries[e.ID] = parsed
+	}
+	return s, nil
+}
+
+// OnChange calls f with every entry whenever entries are changed or run.
+func (s *Scheduler) OnChange(f func([]Entry)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = f
+}
+
+// Entries returns every entry, sorted by id.
+func (s *Scheduler) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list()
+}
+
+// Entry returns the entry with id.
+func (s *Scheduler) Entry(id string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[id]
+	if !ok {
+		return Entry{}, ErrNotFound
+	}
+	return e.Entry, nil
+}
+
+// Put adds an entry, or replaces the entry with the same id. Entries without
+// an id are given one.
+func (s *Scheduler) Put(e Entry) (Entry, error) {
+	if e.ID == "" {
+		e.ID = uniuri.NewLen(10)
+	}
+	e.Next, e.LastRun, e.LastError = nil, nil, ""
+
+	parsed, err := s.parse(e)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	s.mu.Lock()
+	if previous, ok := s.entries[e.ID]; ok {
+		parsed.LastRun, parsed.LastError = previous.LastRun, previous.LastError
+	}
+	s.schedule(parsed, time.Now())
+	s.entries[e.ID] = parsed
+	// Copied while locked as Run reschedules the entry
+	saved := parsed.Entry
+	entries, err := s.changed()
+	s.mu.Unlock()
+	s.notify(entries)
+
+	logging.With("schedule", e.ID).Info("Saved schedule, next run %v", saved.Next)
+	return saved, err
+}
+
+// Delete removes the entry with id.
+func (s *Scheduler) Delete(id string) error {
+	s.mu.Lock()
+	if _, ok := s.entries[id]; !ok {
+		s.mu.Unlock()
+		return ErrNotFound
+	}
+	delete(s.entries, id)
+	entries, err := s.changed()
+	s.mu.Unlock()
+
+	logging.With("schedule", id).Info("Deleted schedule")
+	s.notify(entries)
+	return err
+}
+
+// HandleMessage handles a message on the schedule topic for id. The payload
+// is an Entry to save, or empty to delete the entry.
+func (s *Scheduler) HandleMessage(ctx context.Context, id string, payload []byte) error {
+	if len(payload) == 0 {
+		err := s.Delete(id)
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	var e Entry
+	if err := json.Unmarshal(payload, &e); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
+	e.ID = id
+	_, err := s.Put(e)
+	return err
+}
+
+// Run runs entries as they become due until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		timer := time.NewTimer(s.runDue(ctx))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-s.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// runDue starts every entry that is due, returning how long until the next
+// one is.
+func (s *Scheduler) runDue(ctx context.Context) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var due []*entry
+	for _, e := range s.entries {
+		if e.Next != nil && !e.Next.After(now) {
+			due = append(due, e)
+			s.schedule(e, now)
+		}
+	}
+	for _, e := range due {
+		go s.run(ctx, e.ID, e.Entry)
+	}
+
+	wait := idleWait
+	for _, e := range s.entries {
+		if e.Next != nil && e.Next.Sub(now) < wait {
+			wait = e.Next.Sub(now)
+		}
+	}
+	return wait
+}
+
+// run applies an entry's action and records the result.
+func (s *Scheduler) run(ctx context.Context, id string, e Entry) {
+	logger := logging.With("schedule", id)
+	logger.Info("Running schedule")
+
+	var err error
+	if e.Scene != nil {
+		errs := s.h.ApplyScene(ctx, e.Scene)
+		if len(errs) > 0 {
+			err = sceneError(errs)
+		}
+	} else {
+		err = s.h.HandleCommand(ctx, e.Target, e.Command)
+	}
+	if err != nil {
+		logger.Warn("Error running schedule %s", err)
+	}
+
+	s.mu.Lock()
+	current, ok := s.entries[id]
+	if !ok {
+		// Deleted while running
+		s.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	current.LastRun = &now
+	current.LastError = ""
+	if err != nil {
+		current.LastError = err.Error()
+	}
+	entries, err := s.changed()
+	s.mu.Unlock()
+
+	if err != nil {
+		logger.Warn("Error saving schedules %s", err)
+	}
+	s.notify(entries)
+}
+
+// parse validates e and parses its schedule.
+func (s *Scheduler) parse(e Entry) (*entry, error) {
+	parsed := &entry{Entry: e}
+
+	switch {
+	case e.Cron != "" && e.Solar != "":
+		return nil, fmt.Errorf("%w: cron and solar are both set", ErrInvalid)
+	case e.Cron != "":
+		sched, err := cron.ParseStandard(e.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalid, err)
+		}
+		parsed.cron = sched
+	case e.Solar != "":
+		if s.cfg.Coordinates == nil {
+			return nil, fmt.Errorf("%w: solar events need a latitude and longitude", ErrInvalid)
+		}
+		event, err := solar.ParseEvent(string(e.Solar))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalid, err)
+		}
+		parsed.Solar = event
+	default:
+		return nil, fmt.Errorf("%w: no cron or solar event", ErrInvalid)
+	}
+
+	if e.Offset != "" {
+		if e.Solar == "" {
+			return nil, fmt.Errorf("%w: offset is only for solar events", ErrInvalid)
+		}
+		offset, err := time.ParseDuration(e.Offset)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalid, err)
+		}
+		parsed.offset = offset
+	}
+
+	switch {
+	case e.Command != nil && e.Scene != nil:
+		return nil, fmt.Errorf("%w: command and scene are both set", ErrInvalid)
+	case e.Command != nil:
+		if e.Target == "" {
+			return nil, fmt.Errorf("%w: command has no target", ErrInvalid)
+		}
+	case e.Scene != nil:
+		if len(e.Scene) == 0 {
+			return nil, fmt.Errorf("%w: empty scene", ErrInvalid)
+		}
+	default:
+		return nil, fmt.Errorf("%w: no command or scene", ErrInvalid)
+	}
+	return parsed, nil
+}
+
+// schedule sets when e next runs after now.
+func (s *Scheduler) schedule(e *entry, now time.Time) {
+	e.Next = nil
+	if e.Disabled {
+		return
+	}
+
+	if e.cron != nil {
+		next := e.cron.Next(now)
+		if !next.IsZero() {
+			e.Next = &next
+		}
+		return
+	}
+
+	// The event after now-offset is the first after now once offset
+	next, ok := solar.Next(e.Solar, *s.cfg.Coordinates, now.Add(-e.offset))
+	if ok {
+		next = next.Add(e.offset)
+		e.Next = &next
+	}
+}
+
+// changed saves the entries and wakes Run, returning the entries for
+// notify. mu must be held.
+func (s *Scheduler) changed() ([]Entry, error) {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	entries := s.list()
+	if s.cfg.Path == "" {
+		return entries, nil
+	}
+	return entries, save(s.cfg.Path, entries)
+}
+
+// notify calls the OnChange callback. mu must not be held, so the callback
+// can read entries.
+func (s *Scheduler) notify(entries []Entry) {
+	s.mu.Lock()
+	f := s.onChange
+	s.mu.Unlock()
+	if f != nil {
+		f(entries)
+	}
+}
+
+// list returns every entry sorted by id. mu must be held.
+func (s *Scheduler) list() []Entry {
+	entries := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e.Entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries
+}
+
+// save writes entries to a temporary file and renames it over path, so a
+// crash never leaves a partly written file.
+func save(path string, entries []Entry) error {
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// sceneError combines the errors of a scene, sorted by id.
+func sceneError(errs map[string]error) error {
+	ids := make([]string, 0, len(errs))
+	for id := range errs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	msg := ""
+	for i, id := range ids {
+		if i > 0 {
+			msg += "; "
+		}
+		msg += id + ": " + errs[id].Error()
+	}
+	return errors.New(msg)
+}
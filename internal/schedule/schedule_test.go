@@ -0,0 +1,228 @@
+package schedule_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"github.com/denwilliams/go-lifx-mqtt/internal/schedule"
+	"github.com/denwilliams/go-lifx-mqtt/internal/solar"
+)
+
+// fakeHandler records the commands it is sent.
+type fakeHandler struct {
+	mu       sync.Mutex
+	commands map[string]int
+}
+
+func (h *fakeHandler) HandleCommand(ctx context.Context, id string, command *mqtt.Command) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.commands == nil {
+		h.commands = make(map[string]int)
+	}
+	h.commands[id]++
+	if id == "broken" {
+		return errors.New("unreachable")
+	}
+	return nil
+}
+
+func (h *fakeHandler) ApplyScene(ctx context.Context, scene map[string]*mqtt.Command) map[string]error {
+	errs := make(map[string]error)
+	for id, command := range scene {
+		if err := h.HandleCommand(ctx, id, command); err != nil {
+			errs[id] = err
+		}
+	}
+	return errs
+}
+
+func (h *fakeHandler) count(id string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.commands[id]
+}
+
+func eventually(t *testing.T, what string, f func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	logging.Init(&strings.Builder{}, 0)
+
+	on := true
+	london := &solar.Coordinates{Latitude: 51.5074, Longitude: -0.1278}
+
+	t.Run("Invalid", func(t *testing.T) {
+		s, err := schedule.New(&fakeHandler{}, schedule.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		command := &mqtt.Command{Power: &on}
+		tests := map[string]schedule.Entry{
+			"NoTime":          {Target: "d073d5000001", Command: command},
+			"BadCron":         {Cron: "every day", Target: "d073d5000001", Command: command},
+			"CronAndSolar":    {Cron: "@daily", Solar: solar.Sunset, Target: "d073d5000001", Command: command},
+			"NoCoordinates":   {Solar: solar.Sunset, Target: "d073d5000001", Command: command},
+			"CronOffset":      {Cron: "@daily", Offset: "1h", Target: "d073d5000001", Command: command},
+			"NoAction":        {Cron: "@daily"},
+			"NoTarget":        {Cron: "@daily", Command: command},
+			"CommandAndScene": {Cron: "@daily", Target: "d073d5000001", Command: command, Scene: map[string]*mqtt.Command{"d073d5000002": command}},
+			"EmptyScene":      {Cron: "@daily", Scene: map[string]*mqtt.Command{}},
+		}
+		for name, e := range tests {
+			t.Run(name, func(t *testing.T) {
+				if _, err := s.Put(e); !errors.Is(err, schedule.ErrInvalid) {
+					t.Errorf("Expected ErrInvalid, got %v", err)
+				}
+			})
+		}
+	})
+
+	t.Run("Solar", func(t *testing.T) {
+		s, err := schedule.New(&fakeHandler{}, schedule.Config{Coordinates: london})
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := s.Put(schedule.Entry{Solar: "Sunset", Offset: "-30m", Target: "group/kitchen", Command: &mqtt.Command{Power: &on}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.ID == "" {
+			t.Errorf("Expected an id to be generated")
+		}
+		if e.Solar != solar.Sunset {
+			t.Errorf("Expected sunset, got %q", e.Solar)
+		}
+
+		sunset, _ := solar.Next(solar.Sunset, *london, time.Now().Add(30*time.Minute))
+		if e.Next == nil || !e.Next.Equal(sunset.Add(-30*time.Minute)) {
+			t.Errorf("Expected next run at %s, got %v", sunset.Add(-30*time.Minute), e.Next)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		s, err := schedule.New(&fakeHandler{}, schedule.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, err := s.Put(schedule.Entry{Cron: "@daily", Target: "d073d5000001", Command: &mqtt.Command{Power: &on}, Disabled: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Next != nil {
+			t.Errorf("Expected no next run, got %s", e.Next)
+		}
+	})
+
+	t.Run("Run", func(t *testing.T) {
+		h := &fakeHandler{}
+		s, err := schedule.New(h, schedule.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go s.Run(ctx)
+
+		// Added after Run has started, so it has to be woken
+		_, err = s.Put(schedule.Entry{ID: "command", Cron: "@every 1s", Target: "d073d5000001", Command: &mqtt.Command{Power: &on}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = s.Put(schedule.Entry{ID: "scene", Cron: "@every 1s", Scene: map[string]*mqtt.Command{
+			"d073d5000002": {Power: &on},
+			"broken":       {Power: &on},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		eventually(t, "the command to run twice", func() bool {
+			return h.count("d073d5000001") >= 2
+		})
+		eventually(t, "the scene to run", func() bool {
+			return h.count("d073d5000002") >= 1
+		})
+		eventually(t, "the scene error to be recorded", func() bool {
+			e, err := s.Entry("scene")
+			return err == nil && e.LastRun != nil && e.LastError == "broken: unreachable"
+		})
+
+		if err := s.Delete("command"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Entry("command"); !errors.Is(err, schedule.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+		if err := s.Delete("command"); !errors.Is(err, schedule.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Persisted", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "schedules.json")
+		s, err := schedule.New(&fakeHandler{}, schedule.Config{Path: path, Coordinates: london})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var published []schedule.Entry
+		s.OnChange(func(entries []schedule.Entry) { published = entries })
+
+		ctx := context.Background()
+		if err := s.HandleMessage(ctx, "night", []byte(`{"cron": "0 23 * * *", "target": "group/kitchen", "command": {"power": false}}`)); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.HandleMessage(ctx, "evening", []byte(`{"solar": "dusk", "scene": {"d073d5000001": {"brightness": 50}}}`)); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.HandleMessage(ctx, "bad", []byte(`{`)); !errors.Is(err, schedule.ErrInvalid) {
+			t.Errorf("Expected ErrInvalid, got %v", err)
+		}
+		if len(published) != 2 || published[0].ID != "evening" || published[1].ID != "night" {
+			t.Errorf("Expected evening and night to be published, got %+v", published)
+		}
+
+		loaded, err := schedule.New(&fakeHandler{}, schedule.Config{Path: path, Coordinates: london})
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries := loaded.Entries()
+		if len(entries) != 2 {
+			t.Fatalf("Expected 2 entries, got %+v", entries)
+		}
+		if e := entries[1]; e.Cron != "0 23 * * *" || e.Target != "group/kitchen" || e.Command == nil || *e.Command.Power || e.Next == nil {
+			t.Errorf("Unexpected entry %+v", e)
+		}
+		if e := entries[0]; e.Solar != solar.Dusk || *e.Scene["d073d5000001"].Brightness != 50 {
+			t.Errorf("Unexpected entry %+v", e)
+		}
+
+		// An empty payload deletes
+		if err := loaded.HandleMessage(ctx, "night", nil); err != nil {
+			t.Fatal(err)
+		}
+		reloaded, err := schedule.New(&fakeHandler{}, schedule.Config{Path: path, Coordinates: london})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entries := reloaded.Entries(); len(entries) != 1 || entries[0].ID != "evening" {
+			t.Errorf("Expected only evening, got %+v", entries)
+		}
+	})
+}
@@ -0,0 +1,167 @@
+// Package solar calculates sunrise, sunset and twilight times locally, using
+// the sunrise equation:
+//
+// https://en.wikipedia.org/wiki/Sunrise_equation
+//
+// Times are accurate to within a minute or two, which is plenty for
+// scheduling lights.
+package solar
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Coordinates is a position on Earth in degrees, north and east positive.
+type Coordinates struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Event is a solar event that happens once a day.
+type Event string
+
+// Events, in the order they happen.
+const (
+	// Dawn is the start of civil twilight, when the sun is 6° below the
+	// horizon.
+	Dawn    Event = "dawn"
+	Sunrise Event = "sunrise"
+	// Noon is when the sun is highest.
+	Noon   Event = "noon"
+	Sunset Event = "sunset"
+	// Dusk is the end of civil twilight.
+	Dusk Event = "dusk"
+)
+
+// ParseEvent parses an event name, ignoring case.
+func ParseEvent(s string) (Event, error) {
+	switch e := Event(strings.ToLower(s)); e {
+	case Dawn, Sunrise, Noon, Sunset, Dusk:
+		return e, nil
+	}
+	return "", fmt.Errorf("unknown solar event %q", s)
+}
+
+// Times are the solar events of a day. Events that don't happen, eg: sunset
+// during the polar summer, are zero.
+type Times struct {
+	Dawn    time.Time `json:"dawn"`
+	Sunrise time.Time `json:"sunrise"`
+	Noon    time.Time `json:"noon"`
+	Sunset  time.Time `json:"sunset"`
+	Dusk    time.Time `json:"dusk"`
+}
+
+// Get returns the time of e.
+func (t Times) Get(e Event) time.Time {
+	switch e {
+	case Dawn:
+		return t.Dawn
+	case Sunrise:
+		return t.Sunrise
+	case Noon:
+		return t.Noon
+	case Sunset:
+		return t.Sunset
+	case Dusk:
+		return t.Dusk
+	}
+	return time.Time{}
+}
+
+const (
+	j2000     = 2451545.0
+	unixEpoch = 2440587.5
+	// Angles of the sun's center below the horizon, allowing for refraction
+	// and the size of the sun at sunrise and sunset.
+	sunriseAngle  = -0.833
+	twilightAngle = -6
+	obliquity     = 23.4397
+)
+
+// TimesOn returns the solar events at c on the calendar day of date, in
+// date's location.
+func TimesOn(date time.Time, c Coordinates) Times {
+	y, m, d := date.Date()
+	noonUTC := time.Date(y, m, d, 12, 0, 0, 0, time.UTC)
+	n := math.Round(julian(noonUTC) - j2000)
+
+	// Mean solar noon
+	jStar := n - c.Longitude/360
+	transit, sinDecl := position(jStar)
+	cosDecl := math.Cos(math.Asin(sinDecl))
+
+	around := func(angle float64) (time.Time, time.Time) {
+		cosHour := (sin(angle) - sin(c.Latitude)*sinDecl) / (cos(c.Latitude) * cosDecl)
+		if cosHour < -1 || cosHour > 1 {
+			return time.Time{}, time.Time{}
+		}
+		hour := math.Acos(cosHour) * 180 / math.Pi
+		return fromJulian(transit-hour/360, date.Location()), fromJulian(transit+hour/360, date.Location())
+	}
+
+	t := Times{Noon: fromJulian(transit, date.Location())}
+	t.Sunrise, t.Sunset = around(sunriseAngle)
+	t.Dawn, t.Dusk = around(twilightAngle)
+	return t
+}
+
+// Elevation returns the angle in degrees of the sun above the horizon at c
+// at t, negative when it is below.
+func Elevation(t time.Time, c Coordinates) float64 {
+	j := julian(t)
+	// Mean solar noon nearest t
+	jStar := math.Round(j-j2000+c.Longitude/360) - c.Longitude/360
+	transit, sinDecl := position(jStar)
+	cosDecl := math.Cos(math.Asin(sinDecl))
+
+	hour := (j - transit) * 360
+	sinElevation := sin(c.Latitude)*sinDecl + cos(c.Latitude)*cosDecl*cos(hour)
+	return math.Asin(sinElevation) * 180 / math.Pi
+}
+
+// position returns the Julian date of solar transit and the sine of the sun's
+// declination on the day of mean solar noon jStar, in days since J2000.
+func position(jStar float64) (float64, float64) {
+	// Solar mean anomaly
+	mean := math.Mod(357.5291+0.98560028*jStar, 360)
+	// Equation of the center
+	center := 1.9148*sin(mean) + 0.02*sin(2*mean) + 0.0003*sin(3*mean)
+	// Ecliptic longitude
+	lambda := math.Mod(mean+center+180+102.9372, 360)
+	transit := j2000 + jStar + 0.0053*sin(mean) - 0.0069*sin(2*lambda)
+	// Declination of the sun
+	return transit, sin(lambda) * sin(obliquity)
+}
+
+// Next returns the first time e happens at c after after, or false if it
+// doesn't happen in the next year.
+func Next(e Event, c Coordinates, after time.Time) (time.Time, bool) {
+	for day := 0; day <= 366; day++ {
+		t := TimesOn(after.AddDate(0, 0, day), c).Get(e)
+		if !t.IsZero() && t.After(after) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func julian(t time.Time) float64 {
+	return float64(t.Unix())/86400 + unixEpoch
+}
+
+func fromJulian(j float64, loc *time.Location) time.Time {
+	secs := (j - unixEpoch) * 86400
+	return time.Unix(0, int64(math.Round(secs))*int64(time.Second)).In(loc)
+}
+
+func sin(deg float64) float64 {
+	return math.Sin(deg * math.Pi / 180)
+}
+
+func cos(deg float64) float64 {
+	return math.Cos(deg * math.Pi / 180)
+}
@@ -0,0 +1,119 @@
+package solar_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/solar"
+)
+
+func TestTimesOn(t *testing.T) {
+	london := solar.Coordinates{Latitude: 51.5074, Longitude: -0.1278}
+	sydney := solar.Coordinates{Latitude: -33.8688, Longitude: 151.2093}
+	tromso := solar.Coordinates{Latitude: 69.6492, Longitude: 18.9553}
+
+	londonTZ, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip("no time zone data")
+	}
+	sydneyTZ, _ := time.LoadLocation("Australia/Sydney")
+
+	tests := []struct {
+		name   string
+		at     solar.Coordinates
+		date   time.Time
+		event  solar.Event
+		want   string
+		wantOK bool
+	}{
+		{"LondonSunrise", london, time.Date(2024, 6, 21, 0, 0, 0, 0, londonTZ), solar.Sunrise, "2024-06-21 04:43", true},
+		{"LondonSunset", london, time.Date(2024, 6, 21, 0, 0, 0, 0, londonTZ), solar.Sunset, "2024-06-21 21:21", true},
+		{"LondonNoon", london, time.Date(2024, 6, 21, 0, 0, 0, 0, londonTZ), solar.Noon, "2024-06-21 13:02", true},
+		{"LondonDawn", london, time.Date(2024, 12, 21, 0, 0, 0, 0, londonTZ), solar.Dawn, "2024-12-21 07:25", true},
+		{"LondonDusk", london, time.Date(2024, 12, 21, 0, 0, 0, 0, londonTZ), solar.Dusk, "2024-12-21 16:35", true},
+		{"SydneySunrise", sydney, time.Date(2024, 12, 21, 0, 0, 0, 0, sydneyTZ), solar.Sunrise, "2024-12-21 05:41", true},
+		{"SydneySunset", sydney, time.Date(2024, 12, 21, 0, 0, 0, 0, sydneyTZ), solar.Sunset, "2024-12-21 20:05", true},
+		{"MidnightSun", tromso, time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC), solar.Sunset, "", false},
+		{"PolarNight", tromso, time.Date(2024, 12, 21, 0, 0, 0, 0, time.UTC), solar.Sunrise, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := solar.TimesOn(tt.date, tt.at).Get(tt.event)
+			if got.IsZero() == tt.wantOK {
+				t.Fatalf("Expected ok %v, got %v", tt.wantOK, got)
+			}
+			if !tt.wantOK {
+				return
+			}
+			want, err := time.ParseInLocation("2006-01-02 15:04", tt.want, tt.date.Location())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := got.Sub(want); diff < -2*time.Minute || diff > 2*time.Minute {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	london := solar.Coordinates{Latitude: 51.5074, Longitude: -0.1278}
+	tromso := solar.Coordinates{Latitude: 69.6492, Longitude: 18.9553}
+
+	t.Run("LaterToday", func(t *testing.T) {
+		after := time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC)
+		got, ok := solar.Next(solar.Sunset, london, after)
+		if !ok || got.Day() != 21 {
+			t.Errorf("Expected sunset on the 21st, got %s", got)
+		}
+	})
+
+	t.Run("Tomorrow", func(t *testing.T) {
+		after := time.Date(2024, 6, 21, 22, 0, 0, 0, time.UTC)
+		got, ok := solar.Next(solar.Sunset, london, after)
+		if !ok || got.Day() != 22 {
+			t.Errorf("Expected sunset on the 22nd, got %s", got)
+		}
+	})
+
+	t.Run("AfterPolarNight", func(t *testing.T) {
+		after := time.Date(2024, 12, 21, 0, 0, 0, 0, time.UTC)
+		got, ok := solar.Next(solar.Sunrise, tromso, after)
+		if !ok || got.Year() != 2025 || got.Month() != time.January {
+			t.Errorf("Expected sunrise in January, got %s", got)
+		}
+	})
+
+	t.Run("ParseEvent", func(t *testing.T) {
+		if e, err := solar.ParseEvent("SunSet"); err != nil || e != solar.Sunset {
+			t.Errorf("Expected sunset, got %q %v", e, err)
+		}
+		if _, err := solar.ParseEvent("teatime"); err == nil {
+			t.Errorf("Expected an error")
+		}
+	})
+}
+
+func TestElevation(t *testing.T) {
+	london := solar.Coordinates{Latitude: 51.5074, Longitude: -0.1278}
+	noon := solar.TimesOn(time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC), london).Noon
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want float64
+	}{
+		// 90 - latitude + axial tilt
+		{"MidsummerNoon", noon, 61.9},
+		{"MidsummerMidnight", noon.Add(12 * time.Hour), -15.0},
+		{"WinterNoon", solar.TimesOn(time.Date(2024, 12, 21, 0, 0, 0, 0, time.UTC), london).Noon, 15.0},
+		{"Sunrise", solar.TimesOn(time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC), london).Sunrise, -0.833},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := solar.Elevation(tt.at, london); got < tt.want-0.5 || got > tt.want+0.5 {
+				t.Errorf("Expected %.1f°, got %.1f°", tt.want, got)
+			}
+		})
+	}
+}
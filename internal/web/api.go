@@ -0,0 +1,199 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+)
+
+// api serves the JSON REST API. Commands go through the same
+// LIFXClient.HandleCommand path as MQTT so both behave identically.
+type api struct {
+	lc *lifx.LIFXClient
+}
+
+// maxImageBytes limits the size of images posted to devices.
+const maxImageBytes = 10 << 20
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// GET /devices
+func (a *api) handleDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.lc.Devices())
+}
+
+// GET /devices/{id}
+// POST /devices/{id}
+// POST /devices/{id}/image
+func (a *api) handleDevice(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/devices/")
+	if image := strings.TrimSuffix(id, "/image"); image != id {
+		a.handleImage(w, r, image)
+		return
+	}
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound, lifx.ErrNotFound)
+		return
+	}
+
+	state := a.lc.Device(id)
+	if state == nil {
+		writeError(w, http.StatusNotFound, lifx.ErrNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, state)
+	case http.MethodPost:
+		a.handleCommand(w, r, id)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// GET /groups
+func (a *api) handleGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, a.lc.Groups())
+}
+
+// POST /groups/{name}
+func (a *api) handleGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/groups/")
+	a.handleCommand(w, r, "group/"+name)
+}
+
+// POST /scene
+//
+// The body maps device ids (or "group/{name}") to the command for each, all of
+// which are applied at the same time.
+func (a *api) handleScene(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	var scene map[string]*mqtt.Command
+	if err := json.NewDecoder(r.Body).Decode(&scene); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	logging.Info("%s %s %d devices", r.Method, r.URL.Path, len(scene))
+
+	errs := make(map[string]string)
+	for id, err := range a.lc.ApplyScene(r.Context(), scene) {
+		errs[id] = err.Error()
+	}
+
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusBadGateway, errs)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /discover
+func (a *api) handleDiscover(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	logging.Info("%s %s", r.Method, r.URL.Path)
+	a.lc.HandleCommand(r.Context(), "discover", nil)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// POST /devices/{id}/image
+//
+// The body is a PNG, GIF or JPEG, or raw RGB pixels with ?format=rgb and
+// optionally &width= and &height=. ?loops= sets how many times an animation
+// plays.
+func (a *api) handleImage(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImageBytes))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	image := &mqtt.Image{Data: data, Format: r.URL.Query().Get("format")}
+	for name, v := range map[string]*int{"width": &image.Width, "height": &image.Height, "loops": &image.Loops} {
+		if q := r.URL.Query().Get(name); q != "" {
+			if *v, err = strconv.Atoi(q); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s: %w", name, err))
+				return
+			}
+		}
+	}
+	logging.Info("%s %s %d bytes", r.Method, r.URL.Path, len(data))
+
+	a.runCommand(w, r, id, &mqtt.Command{Image: image})
+}
+
+func (a *api) handleCommand(w http.ResponseWriter, r *http.Request, id string) {
+	var command mqtt.Command
+	if err := json.NewDecoder(r.Body).Decode(&command); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	logging.Info("%s %s %s", r.Method, r.URL.Path, command.String())
+
+	a.runCommand(w, r, id, &command)
+}
+
+func (a *api) runCommand(w http.ResponseWriter, r *http.Request, id string, command *mqtt.Command) {
+	if err := a.lc.HandleCommand(r.Context(), id, command); err != nil {
+		if errors.Is(err, lifx.ErrNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if errors.Is(err, lifx.ErrInvalidImage) || errors.Is(err, lifx.ErrInvalidText) || errors.Is(err, lifx.ErrInvalidButtons) || errors.Is(err, lifx.ErrInvalidRelay) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		logging.Warn("Error writing response: %s", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &errorResponse{Error: err.Error()})
+}
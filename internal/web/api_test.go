@@ -0,0 +1,70 @@
+package web_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"github.com/denwilliams/go-lifx-mqtt/internal/web"
+)
+
+type nopEmitter struct{}
+
+func (nopEmitter) EmitStatus(context.Context, string, string, interface{}) error {
+	return nil
+}
+
+func (nopEmitter) EmitRetainedStatus(context.Context, string, string, interface{}) error {
+	return nil
+}
+
+func (nopEmitter) EmitEvent(context.Context, string, string, interface{}) error {
+	return nil
+}
+
+func TestAPI(t *testing.T) {
+	logging.Init(&strings.Builder{}, 0)
+
+	lc := lifx.NewClient(nopEmitter{})
+	handler := web.CreateHandler(lc, web.NewHub(), web.NewHealth(lc, nil, web.DefaultReadinessConfig), nil)
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		want   string
+	}{
+		{"ListDevices", http.MethodGet, "/devices", "", http.StatusOK, "[]\n"},
+		{"UnknownDevice", http.MethodGet, "/devices/d073d5000000", "", http.StatusNotFound, `{"error":"not found"}` + "\n"},
+		{"CommandUnknownDevice", http.MethodPost, "/devices/d073d5000000", `{"brightness":0}`, http.StatusNotFound, ""},
+		{"ImageUnknownDevice", http.MethodPost, "/devices/d073d5000000/image", "GIF89a", http.StatusNotFound, ""},
+		{"ImageBadLoops", http.MethodPost, "/devices/d073d5000000/image?loops=forever", "GIF89a", http.StatusBadRequest, ""},
+		{"ImageWrongMethod", http.MethodGet, "/devices/d073d5000000/image", "", http.StatusMethodNotAllowed, ""},
+		{"ListGroups", http.MethodGet, "/groups", "", http.StatusOK, "{}\n"},
+		{"CommandUnknownGroup", http.MethodPost, "/groups/kitchen", `{"brightness":0}`, http.StatusNotFound, ""},
+		{"BadBody", http.MethodPost, "/groups/kitchen", `{`, http.StatusBadRequest, ""},
+		{"UI", http.MethodGet, "/", "", http.StatusOK, ""},
+		{"DiscoverWrongMethod", http.MethodGet, "/discover", "", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != c.status {
+				t.Errorf("Expected status %d, got %d: %s", c.status, rec.Code, rec.Body.String())
+			}
+			if c.want != "" && rec.Body.String() != c.want {
+				t.Errorf("Expected body %q, got %q", c.want, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+)
+
+// Connection reports whether a connection (eg: MQTT) is up.
+type Connection interface {
+	IsConnected() bool
+}
+
+// ReadinessConfig defines when the bridge is considered ready.
+type ReadinessConfig struct {
+	// RequireMQTT requires the MQTT client to be connected.
+	RequireMQTT bool
+	// MinDevices is the minimum number of loaded devices.
+	MinDevices int
+	// MaxRefreshAge is the maximum time since any device was last refreshed
+	// successfully. Zero disables the check.
+	MaxRefreshAge time.Duration
+}
+
+// DefaultReadinessConfig requires MQTT, at least one loaded device and a
+// successful refresh within the last 5 minutes.
+var DefaultReadinessConfig = ReadinessConfig{
+	RequireMQTT:   true,
+	MinDevices:    1,
+	MaxRefreshAge: 5 * time.Minute,
+}
+
+type mqttHealth struct {
+	Connected bool `json:"connected"`
+}
+
+type healthResponse struct {
+	Status  string       `json:"status"`
+	Reasons []string     `json:"reasons,omitempty"`
+	MQTT    mqttHealth   `json:"mqtt"`
+	LIFX    *lifx.Health `json:"lifx"`
+}
+
+// Health serves the liveness (/healthz) and readiness (/readyz) endpoints.
+type Health struct {
+	lc        *lifx.LIFXClient
+	mqtt      Connection
+	readiness ReadinessConfig
+}
+
+func NewHealth(lc *lifx.LIFXClient, mqtt Connection, readiness ReadinessConfig) *Health {
+	return &Health{lc: lc, mqtt: mqtt, readiness: readiness}
+}
+
+func (h *Health) report() *healthResponse {
+	return &healthResponse{
+		Status: "ok",
+		MQTT:   mqttHealth{Connected: h.mqtt != nil && h.mqtt.IsConnected()},
+		LIFX:   h.lc.Health(),
+	}
+}
+
+// GET /healthz
+//
+// Always OK while the process is serving requests, with the current state for
+// diagnostics.
+func (h *Health) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.report())
+}
+
+// GET /readyz
+//
+// OK only when the readiness criteria are met, otherwise 503 with the reasons.
+func (h *Health) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	report := h.report()
+	cfg := h.readiness
+
+	if cfg.RequireMQTT && !report.MQTT.Connected {
+		report.Reasons = append(report.Reasons, "mqtt disconnected")
+	}
+	if report.LIFX.Loaded < cfg.MinDevices {
+		report.Reasons = append(report.Reasons, fmt.Sprintf("%d of %d required devices loaded", report.LIFX.Loaded, cfg.MinDevices))
+	}
+	if cfg.MaxRefreshAge > 0 {
+		last := report.LIFX.LastRefresh
+		if last == nil || time.Since(*last) > cfg.MaxRefreshAge {
+			report.Reasons = append(report.Reasons, fmt.Sprintf("no successful refresh in %s", cfg.MaxRefreshAge))
+		}
+	}
+
+	if len(report.Reasons) > 0 {
+		report.Status = "unavailable"
+		writeJSON(w, http.StatusServiceUnavailable, report)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
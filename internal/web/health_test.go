@@ -0,0 +1,67 @@
+package web_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"github.com/denwilliams/go-lifx-mqtt/internal/web"
+)
+
+type fakeConnection bool
+
+func (c fakeConnection) IsConnected() bool {
+	return bool(c)
+}
+
+func TestHealth(t *testing.T) {
+	logging.Init(&strings.Builder{}, 0)
+
+	lc := lifx.NewClient(nopEmitter{})
+
+	cases := []struct {
+		name      string
+		path      string
+		mqtt      fakeConnection
+		readiness web.ReadinessConfig
+		status    int
+		reasons   int
+	}{
+		{"Liveness", "/healthz", false, web.DefaultReadinessConfig, http.StatusOK, 0},
+		{"NotReady", "/readyz", false, web.DefaultReadinessConfig, http.StatusServiceUnavailable, 3},
+		{"MQTTOnly", "/readyz", true, web.ReadinessConfig{RequireMQTT: true}, http.StatusOK, 0},
+		{"MQTTDown", "/readyz", false, web.ReadinessConfig{RequireMQTT: true}, http.StatusServiceUnavailable, 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			handler := web.CreateHandler(lc, web.NewHub(), web.NewHealth(lc, c.mqtt, c.readiness), nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, c.path, nil))
+
+			if rec.Code != c.status {
+				t.Errorf("Expected status %d, got %d: %s", c.status, rec.Code, rec.Body.String())
+			}
+
+			var body struct {
+				Reasons []string `json:"reasons"`
+				MQTT    struct {
+					Connected bool `json:"connected"`
+				} `json:"mqtt"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body.Reasons) != c.reasons {
+				t.Errorf("Expected %d reasons, got %q", c.reasons, body.Reasons)
+			}
+			if body.MQTT.Connected != bool(c.mqtt) {
+				t.Errorf("Expected mqtt connected %v, got %v", c.mqtt, body.MQTT.Connected)
+			}
+		})
+	}
+}
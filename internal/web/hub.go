@@ -0,0 +1,130 @@
+package web
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+)
+
+// subscriberBuffer is the number of events queued for a subscriber before
+// further events are dropped.
+const subscriberBuffer = 64
+
+// Event is a single status change streamed to live clients.
+type Event struct {
+	ID   string      `json:"id"`
+	Key  string      `json:"key"`
+	Data interface{} `json:"data"`
+	Time time.Time   `json:"time"`
+}
+
+// Filter selects which events a subscriber receives. Empty fields match
+// everything.
+type Filter struct {
+	IDs  []string
+	Keys []string
+}
+
+func (f Filter) matches(e *Event) bool {
+	return matchesAny(f.IDs, e.ID) && matchesAny(f.Keys, e.Key)
+}
+
+func matchesAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type subscriber struct {
+	filter Filter
+	events chan *Event
+}
+
+// Hub is a lifx.StatusEmitter that fans out every status to subscribed live
+// clients (SSE and WebSocket). It is meant to be composed with the MQTT
+// emitter using lifx.NewMultiEmitter.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+	// retained holds the last retained event per device and key so new
+	// subscribers start with it, like an MQTT retained message.
+	retained map[string]*Event
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[*subscriber]struct{}),
+		retained:    make(map[string]*Event),
+	}
+}
+
+func (h *Hub) EmitStatus(ctx context.Context, id string, statusKey string, data interface{}) error {
+	h.publish(&Event{ID: id, Key: statusKey, Data: data, Time: time.Now().UTC()}, false)
+	return nil
+}
+
+func (h *Hub) EmitRetainedStatus(ctx context.Context, id string, statusKey string, data interface{}) error {
+	h.publish(&Event{ID: id, Key: statusKey, Data: data, Time: time.Now().UTC()}, true)
+	return nil
+}
+
+// EmitEvent streams an event with its key prefixed by "event/", eg:
+// "event/relays", so it can't be mistaken for a status.
+func (h *Hub) EmitEvent(ctx context.Context, id string, eventKey string, data interface{}) error {
+	h.publish(&Event{ID: id, Key: "event/" + eventKey, Data: data, Time: time.Now().UTC()}, false)
+	return nil
+}
+
+func (h *Hub) publish(e *Event, retained bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if retained {
+		h.retained[e.ID+"/"+e.Key] = e
+	}
+
+	for s := range h.subscribers {
+		if !s.filter.matches(e) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			logging.Debug("Dropping event %s/%s for slow subscriber", e.ID, e.Key)
+		}
+	}
+}
+
+// Subscribe registers a subscriber for events matching filter. The returned
+// function must be called to unsubscribe.
+func (h *Hub) Subscribe(filter Filter) (<-chan *Event, func()) {
+	s := &subscriber{filter: filter, events: make(chan *Event, subscriberBuffer)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, e := range h.retained {
+		if !filter.matches(e) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+		}
+	}
+	h.subscribers[s] = struct{}{}
+
+	return s.events, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers, s)
+	}
+}
@@ -0,0 +1,90 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"github.com/denwilliams/go-lifx-mqtt/internal/schedule"
+)
+
+// schedules serves the scheduler's entries.
+type schedules struct {
+	s *schedule.Scheduler
+}
+
+// GET /schedules
+// POST /schedules
+func (h *schedules) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, h.s.Entries())
+	case http.MethodPost:
+		h.put(w, r, "", http.StatusCreated)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// GET /schedules/{id}
+// PUT /schedules/{id}
+// DELETE /schedules/{id}
+func (h *schedules) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/schedules/")
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound, schedule.ErrNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		e, err := h.s.Entry(id)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, e)
+	case http.MethodPut:
+		h.put(w, r, id, http.StatusOK)
+	case http.MethodDelete:
+		logging.Info("%s %s", r.Method, r.URL.Path)
+		if err := h.s.Delete(id); err != nil {
+			if errors.Is(err, schedule.ErrNotFound) {
+				writeError(w, http.StatusNotFound, err)
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// put saves the entry in the body, with id if it isn't empty.
+func (h *schedules) put(w http.ResponseWriter, r *http.Request, id string, status int) {
+	var e schedule.Entry
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if id != "" {
+		e.ID = id
+	}
+	logging.Info("%s %s", r.Method, r.URL.Path)
+
+	saved, err := h.s.Put(e)
+	if err != nil {
+		if errors.Is(err, schedule.ErrInvalid) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		// Saved, but not persisted
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, status, saved)
+}
@@ -0,0 +1,65 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"github.com/denwilliams/go-lifx-mqtt/internal/schedule"
+	"github.com/denwilliams/go-lifx-mqtt/internal/web"
+)
+
+func TestSchedules(t *testing.T) {
+	logging.Init(&strings.Builder{}, 0)
+
+	lc := lifx.NewClient(nopEmitter{})
+	scheduler, err := schedule.New(lc, schedule.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := web.CreateHandler(lc, web.NewHub(), web.NewHealth(lc, nil, web.DefaultReadinessConfig), scheduler)
+
+	// Run in order, each case builds on the last
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		want   string
+	}{
+		{"Empty", http.MethodGet, "/schedules", "", http.StatusOK, "[]\n"},
+		{"Create", http.MethodPost, "/schedules", `{"cron":"0 23 * * *","target":"group/kitchen","command":{"power":false}}`, http.StatusCreated, ""},
+		{"Put", http.MethodPut, "/schedules/night", `{"cron":"0 23 * * *","target":"group/kitchen","command":{"power":false},"disabled":true}`, http.StatusOK, ""},
+		{"Get", http.MethodGet, "/schedules/night", "", http.StatusOK, `"disabled":true`},
+		{"Invalid", http.MethodPut, "/schedules/night", `{"cron":"every night"}`, http.StatusBadRequest, ""},
+		{"SolarWithoutCoordinates", http.MethodPost, "/schedules", `{"solar":"sunset","target":"group/kitchen","command":{"power":true}}`, http.StatusBadRequest, ""},
+		{"BadBody", http.MethodPost, "/schedules", `{`, http.StatusBadRequest, ""},
+		{"Delete", http.MethodDelete, "/schedules/night", "", http.StatusNoContent, ""},
+		{"DeleteUnknown", http.MethodDelete, "/schedules/night", "", http.StatusNotFound, ""},
+		{"GetUnknown", http.MethodGet, "/schedules/night", "", http.StatusNotFound, `{"error":"not found"}` + "\n"},
+		{"WrongMethod", http.MethodPatch, "/schedules", "", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != c.status {
+				t.Errorf("Expected status %d, got %d: %s", c.status, rec.Code, rec.Body.String())
+			}
+			if c.want != "" && !strings.Contains(rec.Body.String(), c.want) {
+				t.Errorf("Expected body %q, got %q", c.want, rec.Body.String())
+			}
+		})
+	}
+
+	if entries := scheduler.Entries(); len(entries) != 1 || entries[0].Cron != "0 23 * * *" {
+		t.Errorf("Expected the created schedule to remain, got %+v", entries)
+	}
+}
@@ -4,17 +4,43 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
 	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"github.com/denwilliams/go-lifx-mqtt/internal/schedule"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func CreateHandler() *http.ServeMux {
+// CreateHandler serves the API, UI, health and metrics. The schedule
+// endpoints are only served if scheduler isn't nil.
+func CreateHandler(lc *lifx.LIFXClient, hub *Hub, health *Health, scheduler *schedule.Scheduler) *http.ServeMux {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
 		logging.Info("%s /", r.Method)
 		fmt.Fprintf(w, "OK")
 	})
 	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", health.handleLiveness)
+	mux.HandleFunc("/readyz", health.handleReadiness)
+
+	api := &api{lc: lc}
+	mux.HandleFunc("/devices", api.handleDevices)
+	mux.HandleFunc("/devices/", api.handleDevice)
+	mux.HandleFunc("/groups", api.handleGroups)
+	mux.HandleFunc("/groups/", api.handleGroup)
+	mux.HandleFunc("/scene", api.handleScene)
+	mux.HandleFunc("/discover", api.handleDiscover)
+
+	if scheduler != nil {
+		schedules := &schedules{s: scheduler}
+		mux.HandleFunc("/schedules", schedules.handleSchedules)
+		mux.HandleFunc("/schedules/", schedules.handleSchedule)
+	}
+
+	stream := &stream{lc: lc, hub: hub}
+	mux.HandleFunc("/events", stream.handleEvents)
+	mux.HandleFunc("/ws", stream.handleWebSocket)
+
+	mux.Handle("/", uiHandler())
 
 	return mux
 }
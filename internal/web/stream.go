@@ -0,0 +1,185 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"github.com/denwilliams/go-lifx-mqtt/internal/mqtt"
+	"github.com/gorilla/websocket"
+)
+
+// heartbeatInterval keeps idle streams open through proxies.
+const heartbeatInterval = 30 * time.Second
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// streamCommand is a command sent by a WebSocket client.
+type streamCommand struct {
+	ID      string        `json:"id"`
+	Command *mqtt.Command `json:"command"`
+}
+
+// streamResult reports the outcome of a streamCommand back to the client.
+type streamResult struct {
+	ID    string `json:"id"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type stream struct {
+	lc  *lifx.LIFXClient
+	hub *Hub
+}
+
+// parseFilter reads the id and key query parameters. Each may be repeated or
+// comma separated.
+func parseFilter(r *http.Request) Filter {
+	split := func(values []string) []string {
+		var out []string
+		for _, v := range values {
+			for _, s := range strings.Split(v, ",") {
+				if s != "" {
+					out = append(out, s)
+				}
+			}
+		}
+		return out
+	}
+
+	q := r.URL.Query()
+	return Filter{IDs: split(q["id"]), Keys: split(q["key"])}
+}
+
+// GET /events
+//
+// Streams status events as Server-Sent Events.
+func (s *stream) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+
+	events, unsubscribe := s.hub.Subscribe(parseFilter(r))
+	defer unsubscribe()
+
+	logging.Info("%s %s SSE client connected", r.Method, r.URL.Path)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			logging.Info("%s %s SSE client disconnected", r.Method, r.URL.Path)
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case e := <-events:
+			data, err := json.Marshal(e)
+			if err != nil {
+				logging.Warn("Error serializing event: %s", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+		}
+		flusher.Flush()
+	}
+}
+
+// GET /ws
+//
+// Streams status events over a WebSocket. Clients may send
+// {"id": "...", "command": {...}} messages which are handled like MQTT
+// commands, each answered with a result message.
+func (s *stream) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logging.Warn("Error upgrading WebSocket: %s", err)
+		return
+	}
+	defer conn.Close()
+
+	events, unsubscribe := s.hub.Subscribe(parseFilter(r))
+	defer unsubscribe()
+
+	logging.Info("%s %s WebSocket client connected", r.Method, r.URL.Path)
+
+	// Only the write loop below writes to conn, so results go through here.
+	results := make(chan *streamResult, subscriberBuffer)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for {
+			var sc streamCommand
+			if err := conn.ReadJSON(&sc); err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					logging.Debug("Error reading WebSocket: %s", err)
+				}
+				return
+			}
+			logging.Info("WebSocket command %s %v", sc.ID, sc.Command)
+
+			go func() {
+				result := &streamResult{ID: sc.ID, OK: true}
+				// Unknown devices are errors, as they are in the REST API,
+				// rather than ignored as they are over MQTT
+				err := fmt.Errorf("%w: device %s", lifx.ErrNotFound, sc.ID)
+				if s.lc.Device(sc.ID) != nil {
+					err = s.lc.HandleCommand(r.Context(), sc.ID, sc.Command)
+				}
+				if err != nil {
+					result.OK = false
+					result.Error = err.Error()
+				}
+				select {
+				case results <- result:
+				case <-done:
+				}
+			}()
+		}
+	}()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+		select {
+		case <-done:
+			logging.Info("%s %s WebSocket client disconnected", r.Method, r.URL.Path)
+			return
+		case <-heartbeat.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+		case result := <-results:
+			err = conn.WriteJSON(result)
+		case e := <-events:
+			err = conn.WriteJSON(e)
+		}
+		if err != nil {
+			logging.Debug("Error writing WebSocket: %s", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package web_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denwilliams/go-lifx-mqtt/internal/lifx"
+	"github.com/denwilliams/go-lifx-mqtt/internal/logging"
+	"github.com/denwilliams/go-lifx-mqtt/internal/web"
+	"github.com/gorilla/websocket"
+)
+
+func TestHub(t *testing.T) {
+	ctx := context.Background()
+	hub := web.NewHub()
+
+	hub.EmitRetainedStatus(ctx, "a", "info", "retained")
+
+	all, unsubscribeAll := hub.Subscribe(web.Filter{})
+	defer unsubscribeAll()
+	filtered, unsubscribeFiltered := hub.Subscribe(web.Filter{IDs: []string{"b"}, Keys: []string{"power"}})
+	defer unsubscribeFiltered()
+
+	hub.EmitStatus(ctx, "a", "power", true)
+	hub.EmitStatus(ctx, "b", "color", nil)
+	hub.EmitStatus(ctx, "b", "power", false)
+
+	expectEvents := func(t *testing.T, events <-chan *web.Event, want ...string) {
+		t.Helper()
+		for _, w := range want {
+			select {
+			case e := <-events:
+				if got := e.ID + "/" + e.Key; got != w {
+					t.Errorf("Expected event %s, got %s", w, got)
+				}
+			default:
+				t.Fatalf("Expected event %s, got nothing", w)
+			}
+		}
+		select {
+		case e := <-events:
+			t.Errorf("Unexpected event %s/%s", e.ID, e.Key)
+		default:
+		}
+	}
+
+	t.Run("All", func(t *testing.T) {
+		expectEvents(t, all, "a/info", "a/power", "b/color", "b/power")
+	})
+	t.Run("Filtered", func(t *testing.T) {
+		expectEvents(t, filtered, "b/power")
+	})
+}
+
+func TestStream(t *testing.T) {
+	logging.Init(&strings.Builder{}, 0)
+
+	hub := web.NewHub()
+	lc := lifx.NewClient(hub)
+	server := httptest.NewServer(web.CreateHandler(lc, hub, web.NewHealth(lc, nil, web.DefaultReadinessConfig), nil))
+	defer server.Close()
+
+	t.Run("SSE", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events?id=a&key=power", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		hub.EmitStatus(ctx, "b", "power", true)
+		hub.EmitStatus(ctx, "a", "power", true)
+
+		scanner := bufio.NewScanner(resp.Body)
+		var lines []string
+		for scanner.Scan() && len(lines) < 2 {
+			if scanner.Text() != "" {
+				lines = append(lines, scanner.Text())
+			}
+		}
+		if len(lines) < 2 || lines[0] != "event: status" {
+			t.Fatalf("Unexpected stream %q", lines)
+		}
+
+		var e web.Event
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.ID != "a" || e.Key != "power" || e.Data != true {
+			t.Errorf("Unexpected event %+v", e)
+		}
+	})
+
+	t.Run("WebSocket", func(t *testing.T) {
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?key=color"
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+
+		// Unknown devices are errors, as they are in the REST API
+		if err := conn.WriteJSON(map[string]interface{}{"id": "d073d5000000", "command": map[string]interface{}{"brightness": 0}}); err != nil {
+			t.Fatal(err)
+		}
+		var result map[string]interface{}
+		if err := conn.ReadJSON(&result); err != nil {
+			t.Fatal(err)
+		}
+		if result["id"] != "d073d5000000" || result["ok"] != false || !strings.Contains(fmt.Sprint(result["error"]), lifx.ErrNotFound.Error()) {
+			t.Errorf("Unexpected result %v", result)
+		}
+
+		hub.EmitStatus(context.Background(), "a", "power", true)
+		hub.EmitStatus(context.Background(), "a", "color", "red")
+
+		var e web.Event
+		if err := conn.ReadJSON(&e); err != nil {
+			t.Fatal(err)
+		}
+		if e.ID != "a" || e.Key != "color" || e.Data != "red" {
+			t.Errorf("Unexpected event %+v", e)
+		}
+	})
+}
@@ -0,0 +1,218 @@
+// Web UI for the bridge, built only on its own HTTP API:
+// GET /devices, POST /devices/{id}, POST /discover and the /events stream.
+(function () {
+  "use strict";
+
+  const container = document.getElementById("devices");
+  const template = document.getElementById("device-template");
+  const cards = new Map();
+
+  async function request(method, path, body) {
+    const res = await fetch(path, {
+      method: method,
+      headers: body ? { "Content-Type": "application/json" } : {},
+      body: body ? JSON.stringify(body) : undefined,
+    });
+    if (!res.ok) {
+      let message = res.statusText;
+      try {
+        message = (await res.json()).error || message;
+      } catch (e) {
+        // not JSON
+      }
+      throw new Error(message);
+    }
+    return res.status === 200 ? res.json() : null;
+  }
+
+  function sendCommand(id, command) {
+    const card = cards.get(id);
+    request("POST", "/devices/" + id, command).catch(function (err) {
+      if (card) {
+        card.querySelector(".error").textContent = err.message;
+      }
+    });
+  }
+
+  function hsbToRgb(hue, saturation, brightness) {
+    // hue/saturation are 0-255, brightness is a percentage
+    const h = (hue / 255) * 360;
+    const s = saturation / 255;
+    const v = brightness / 100;
+    const f = function (n) {
+      const k = (n + h / 60) % 6;
+      return Math.round(255 * (v - v * s * Math.max(0, Math.min(k, 4 - k, 1))));
+    };
+    return "rgb(" + f(5) + "," + f(3) + "," + f(1) + ")";
+  }
+
+  function since(time) {
+    const seconds = Math.round((Date.now() - new Date(time).getTime()) / 1000);
+    if (seconds < 60) {
+      return seconds + "s ago";
+    }
+    if (seconds < 3600) {
+      return Math.round(seconds / 60) + "m ago";
+    }
+    return Math.round(seconds / 3600) + "h ago";
+  }
+
+  function createCard(device) {
+    const card = template.content.firstElementChild.cloneNode(true);
+    const id = device.id;
+
+    card.querySelector(".power").addEventListener("change", function (e) {
+      sendCommand(id, { power: e.target.checked });
+    });
+    card.querySelector(".white").addEventListener("click", function () {
+      sendCommand(id, {
+        brightness: Number(card.querySelector(".brightness").value),
+        temp: Number(card.querySelector(".kelvin").value),
+      });
+    });
+    card.querySelector(".color").addEventListener("change", function (e) {
+      sendCommand(id, { color: e.target.value });
+    });
+
+    const grid = card.querySelector(".grid");
+    card.querySelector(".clear").addEventListener("click", function () {
+      grid.querySelectorAll("div").forEach(function (cell) {
+        cell.dataset.color = "";
+        cell.style.background = "";
+      });
+    });
+    card.querySelector(".paint").addEventListener("click", function () {
+      const rows = [];
+      grid.querySelectorAll("div").forEach(function (cell) {
+        const row = Number(cell.dataset.row);
+        rows[row] = rows[row] || [];
+        rows[row][Number(cell.dataset.col)] = cell.dataset.color || "";
+      });
+      sendCommand(id, { board: rows });
+    });
+
+    container.appendChild(card);
+    cards.set(id, card);
+    return card;
+  }
+
+  function buildGrid(card, device) {
+    const grid = card.querySelector(".grid");
+    if (grid.dataset.size === device.width + "x" + device.height) {
+      return;
+    }
+    grid.dataset.size = device.width + "x" + device.height;
+    grid.innerHTML = "";
+    grid.style.gridTemplateColumns = "repeat(" + device.width + ", 1fr)";
+    for (let row = 0; row < device.height; row++) {
+      for (let col = 0; col < device.width; col++) {
+        const cell = document.createElement("div");
+        cell.dataset.row = row;
+        cell.dataset.col = col;
+        const paint = function (e) {
+          if (e.type === "mousedown" || e.buttons === 1) {
+            cell.dataset.color = card.querySelector(".brush").value;
+            cell.style.background = cell.dataset.color;
+          }
+        };
+        cell.addEventListener("mousedown", paint);
+        cell.addEventListener("mouseenter", paint);
+        grid.appendChild(cell);
+      }
+    }
+  }
+
+  function render(device) {
+    const card = cards.get(device.id) || createCard(device);
+
+    card.querySelector(".label").textContent = device.label || device.id;
+    card.querySelector(".power").checked = device.power;
+
+    const meta = [device.id, device.product || device.type];
+    if (device.group) {
+      meta.push(device.group);
+    }
+    if (device.info) {
+      meta.push("fw " + device.info.firmware, device.info.rssi + " dBm");
+    }
+    meta.push(device.last_seen ? "seen " + since(device.last_seen) : "not seen yet");
+    card.querySelector(".meta").textContent = meta.join(" · ");
+
+    card.querySelector(".error").textContent = device.error
+      ? device.error.message + " (" + since(device.error.time) + ")"
+      : "";
+
+    const isLight = device.type === "light" || device.type === "matrix";
+    card.querySelector(".light").hidden = !isLight;
+    if (isLight && device.color) {
+      card.style.borderLeftColor = device.power
+        ? hsbToRgb(device.color.hue, device.color.saturation, Math.max(device.color.brightness, 30))
+        : "#ccc";
+    }
+
+    const relays = card.querySelector(".relays");
+    relays.hidden = !device.relays;
+    relays.innerHTML = "";
+    (device.relays || []).forEach(function (on, i) {
+      const label = document.createElement("label");
+      const input = document.createElement("input");
+      input.type = "checkbox";
+      input.checked = on;
+      input.addEventListener("change", function () {
+        const command = {};
+        command["relay" + i] = input.checked;
+        sendCommand(device.id, command);
+      });
+      label.append(input, " relay " + i);
+      relays.appendChild(label);
+    });
+
+    const board = card.querySelector(".board");
+    board.hidden = device.type !== "matrix" || !device.width;
+    if (!board.hidden) {
+      buildGrid(card, device);
+    }
+  }
+
+  async function load() {
+    const devices = await request("GET", "/devices");
+    devices.forEach(render);
+  }
+
+  async function reload(id) {
+    try {
+      render(await request("GET", "/devices/" + id));
+    } catch (e) {
+      // the device may have gone away
+    }
+  }
+
+  function connect() {
+    const badge = document.getElementById("connection");
+    const events = new EventSource("/events");
+    events.onopen = function () {
+      badge.textContent = "live";
+      badge.classList.add("live");
+      load();
+    };
+    events.onerror = function () {
+      badge.textContent = "reconnecting";
+      badge.classList.remove("live");
+    };
+    events.addEventListener("status", function (e) {
+      reload(JSON.parse(e.data).id);
+    });
+  }
+
+  document.getElementById("discover").addEventListener("click", function () {
+    request("POST", "/discover").catch(function (err) {
+      alert(err.message);
+    });
+    // New devices show up once loaded
+    setTimeout(load, 15000);
+  });
+
+  // Keep "last seen" and newly loaded devices current between events
+  setInterval(load, 30000);
+  connect();
+})();